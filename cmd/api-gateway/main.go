@@ -15,6 +15,7 @@ import (
 	"crm-dialer-integration/internal/repository"
 	"crm-dialer-integration/pkg/config"
 	"crm-dialer-integration/pkg/logger"
+	"crm-dialer-integration/pkg/nats"
 )
 
 func main() {
@@ -33,6 +34,14 @@ func main() {
 		log.Fatal("Failed to initialize repository", zap.Error(err))
 	}
 
+	// Initialize NATS, used to notify flow engines about flow changes
+	natsClient, err := nats.NewClient(cfg.NatsURL, log)
+	if err != nil {
+		log.Warn("Failed to connect to NATS, flow changes apply on the next cache reload", zap.Error(err))
+	} else {
+		defer natsClient.Close()
+	}
+
 	// Create fiber app
 	app := fiber.New(fiber.Config{
 		ErrorHandler: middleware.ErrorHandler,
@@ -75,7 +84,9 @@ func main() {
 	handlers.SetupAuthRoutes(api, cfg.JWTSecret, repo, log)
 	handlers.SetupWebhookRoutes(api, log)
 	handlers.SetupCRMRoutes(api, cfg, repo, log)
-	handlers.SetupFlowRoutes(api, repo, log)
+	handlers.SetupFlowRoutes(api, repo, natsClient, log)
+	handlers.SetupExecutionRoutes(api, repo, log)
+	handlers.SetupPendingRunRoutes(api, repo, log)
 	handlers.SetupDialerRoutes(api, log)
 
 	// Fallback to index.html for SPA (should be last)
@@ -2,14 +2,19 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"os"
 	"os/signal"
 	"syscall"
 
 	"github.com/joho/godotenv"
+	"github.com/nats-io/nats.go"
 	"go.uber.org/zap"
 
+	"crm-dialer-integration/internal/repository"
 	"crm-dialer-integration/internal/services/amocrm"
+	"crm-dialer-integration/internal/services/queue"
 	"crm-dialer-integration/pkg/config"
 	"crm-dialer-integration/pkg/logger"
 )
@@ -24,6 +29,12 @@ func main() {
 	// Initialize logger
 	log := logger.New(cfg.LogLevel)
 
+	// Initialize repository
+	repo, err := repository.New(cfg.DatabaseURL, log)
+	if err != nil {
+		log.Fatal("Failed to initialize repository", zap.Error(err))
+	}
+
 	// Initialize AmoCRM service
 	amocrmService, err := amocrm.NewService(cfg, log)
 	if err != nil {
@@ -53,18 +64,130 @@ func main() {
 		}
 	}
 
+	// Initialize NATS
+	nc, err := nats.Connect(cfg.NatsURL)
+	if err != nil {
+		log.Fatal("Failed to connect to NATS", zap.Error(err))
+	}
+	defer nc.Close()
+
+	// Отвечаем на запросы данных сделки от Flow Engine
+	_, err = nc.Subscribe("crm.get_lead", func(msg *nats.Msg) {
+		var request struct {
+			LeadID int `json:"lead_id"`
+		}
+		if err := json.Unmarshal(msg.Data, &request); err != nil {
+			reply(log, msg, nil, err)
+			return
+		}
+
+		data, err := amocrmService.GetLeadData(context.Background(), request.LeadID)
+		reply(log, msg, data, err)
+	})
+	if err != nil {
+		log.Fatal("Failed to subscribe to NATS", zap.Error(err))
+	}
+
+	// Связанные сущности для узла enrich
+	_, err = nc.Subscribe("crm.get_lead_contacts", func(msg *nats.Msg) {
+		var request struct {
+			LeadID int `json:"lead_id"`
+		}
+		if err := json.Unmarshal(msg.Data, &request); err != nil {
+			reply(log, msg, nil, err)
+			return
+		}
+
+		contacts, err := amocrmService.GetLeadContactsData(context.Background(), request.LeadID)
+		reply(log, msg, map[string]interface{}{"contacts": contacts}, err)
+	})
+	if err != nil {
+		log.Fatal("Failed to subscribe to NATS", zap.Error(err))
+	}
+
+	_, err = nc.Subscribe("crm.get_lead_company", func(msg *nats.Msg) {
+		var request struct {
+			LeadID int `json:"lead_id"`
+		}
+		if err := json.Unmarshal(msg.Data, &request); err != nil {
+			reply(log, msg, nil, err)
+			return
+		}
+
+		data, err := amocrmService.GetLeadCompanyData(context.Background(), request.LeadID)
+		reply(log, msg, data, err)
+	})
+	if err != nil {
+		log.Fatal("Failed to subscribe to NATS", zap.Error(err))
+	}
+
+	_, err = nc.Subscribe("crm.get_user", func(msg *nats.Msg) {
+		var request struct {
+			UserID int `json:"user_id"`
+		}
+		if err := json.Unmarshal(msg.Data, &request); err != nil {
+			reply(log, msg, nil, err)
+			return
+		}
+
+		data, err := amocrmService.GetUserData(context.Background(), request.UserID)
+		reply(log, msg, data, err)
+	})
+	if err != nil {
+		log.Fatal("Failed to subscribe to NATS", zap.Error(err))
+	}
+
+	// Команды Flow Engine выполняются через очередь с ограничением частоты запросов
+	commands := amocrm.NewCommandProcessor(amocrmService, queue.NewQueueService(log), repo, log)
+
+	_, err = nc.Subscribe("crm.add_note", func(msg *nats.Msg) {
+		if err := commands.HandleAddNote(context.Background(), msg.Data); err != nil {
+			log.Error("Failed to handle add_note command", zap.Error(err))
+		}
+	})
+	if err != nil {
+		log.Fatal("Failed to subscribe to NATS", zap.Error(err))
+	}
+
+	_, err = nc.Subscribe("crm.create_task", func(msg *nats.Msg) {
+		if err := commands.HandleCreateTask(context.Background(), msg.Data); err != nil {
+			log.Error("Failed to handle create_task command", zap.Error(err))
+		}
+	})
+	if err != nil {
+		log.Fatal("Failed to subscribe to NATS", zap.Error(err))
+	}
+
 	// Setup graceful shutdown
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 
 	log.Info("CRM Service started")
 
-	// В реальном приложении здесь бы был gRPC сервер или другой способ
-	// предоставления функциональности другим сервисам
-	// Пока просто ждем сигнала завершения
+	// Другие сервисы обращаются к CRM через NATS request/reply (crm.*)
 
 	<-quit
 	log.Info("Shutting down CRM Service...")
 
 	// Здесь можно добавить graceful shutdown логику
 }
+
+// reply отвечает на NATS запрос в формате {"data": ..., "error": "...", "not_found": true}
+func reply(log *zap.Logger, msg *nats.Msg, data interface{}, err error) {
+	response := map[string]interface{}{}
+	if err != nil {
+		response["error"] = err.Error()
+		if errors.Is(err, amocrm.ErrLeadNotFound) || errors.Is(err, amocrm.ErrEntityNotFound) {
+			response["not_found"] = true
+		}
+	} else {
+		response["data"] = data
+	}
+
+	payload, _ := json.Marshal(response)
+	if err := msg.Respond(payload); err != nil {
+		log.Error("Failed to respond to request",
+			zap.String("subject", msg.Subject),
+			zap.Error(err))
+	}
+}
@@ -6,7 +6,9 @@ import (
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
+	"github.com/go-redis/redis/v8"
 	"github.com/joho/godotenv"
 	"github.com/nats-io/nats.go"
 	"go.uber.org/zap"
@@ -42,6 +44,50 @@ func main() {
 
 	// Initialize Flow Engine with NATS
 	engine := flowengine.NewFlowEngineWithNATS(log, repo, nc)
+	engine.SetMaxParallelBranches(cfg.FlowBranchWorkers)
+
+	// Duplicate events are skipped using idempotency keys stored in Redis,
+	// throttle nodes count runs there as well
+	if opt, err := redis.ParseURL(cfg.RedisURL); err != nil {
+		log.Warn("Failed to parse Redis URL, duplicate events will not be skipped and throttle nodes will fail", zap.Error(err))
+	} else {
+		rdb := redis.NewClient(opt)
+		defer rdb.Close()
+		if err := rdb.Ping(context.Background()).Err(); err != nil {
+			log.Warn("Failed to connect to Redis, duplicate events will not be skipped and throttle nodes will fail", zap.Error(err))
+		} else {
+			engine.SetDeduplicator(flowengine.NewDeduplicator(rdb, time.Duration(cfg.FlowDedupTTL)*time.Second))
+			engine.SetThrottle(flowengine.NewThrottle(rdb))
+		}
+	}
+
+	// Load compiled flows, the gateway notifies about changes on flows.changed
+	flowCache := flowengine.NewFlowCache(repo, log)
+	if err := flowCache.Load(context.Background()); err != nil {
+		log.Fatal("Failed to load flows", zap.Error(err))
+	}
+	engine.SetFlowCache(flowCache)
+
+	_, err = nc.Subscribe(flowengine.FlowsChangedSubject, func(msg *nats.Msg) {
+		if err := flowCache.HandleChange(context.Background(), msg.Data); err != nil {
+			log.Error("Failed to refresh flow cache", zap.Error(err))
+		}
+	})
+	if err != nil {
+		log.Fatal("Failed to subscribe to NATS", zap.Error(err))
+	}
+
+	// crm-service loads leads for resumed runs and data for enrich nodes
+	crmClient := flowengine.NewCRMClient(nc, time.Duration(cfg.CRMRequestTimeout)*time.Second)
+	engine.SetCRMLookup(crmClient)
+
+	// Start scheduler for runs paused by delay nodes and queued by throttle nodes
+	scheduler := flowengine.NewScheduler(engine, repo, crmClient, log, time.Duration(cfg.FlowSchedulerInterval)*time.Second)
+
+	schedulerCtx, stopScheduler := context.WithCancel(context.Background())
+	defer stopScheduler()
+	go scheduler.Run(schedulerCtx)
+	go flowCache.Run(schedulerCtx, time.Duration(cfg.FlowCacheInterval)*time.Second)
 
 	// Subscribe to lead events
 	_, err = nc.Subscribe("webhooks.amocrm.lead_*", func(msg *nats.Msg) {
@@ -53,6 +53,7 @@ func main() {
 	var processor *amocrm.WebhookProcessor
 	if amocrmService != nil {
 		processor = amocrm.NewWebhookProcessorWithNATS(amocrmService, log, nc)
+		processor.SetSnapshotStore(repo)
 	}
 
 	// Subscribe to webhook events
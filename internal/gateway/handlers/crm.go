@@ -8,6 +8,7 @@ import (
 	"github.com/gofiber/fiber/v2"
 	"go.uber.org/zap"
 
+	"crm-dialer-integration/internal/models"
 	"crm-dialer-integration/internal/repository"
 	"crm-dialer-integration/internal/services/amocrm"
 	"crm-dialer-integration/pkg/config"
@@ -56,6 +57,7 @@ func SetupCRMRoutes(router fiber.Router, cfg *config.Config, repo *repository.Re
 
 	// Pipelines endpoints
 	crm.Get("/pipelines", handler.GetPipelines)
+	crm.Post("/pipelines/sync", handler.SyncPipelines)
 }
 
 func (h *CRMHandler) GetAuthURL(c *fiber.Ctx) error {
@@ -126,35 +128,102 @@ func (h *CRMHandler) GetPipelines(c *fiber.Ctx) error {
 		})
 	}
 
-	/*
-		// Сначала пробуем получить из базы данных
-		pipelines, err := h.repo.GetAmoCRMPipelines(c.Context())
+	// Сначала пробуем получить из базы данных
+	pipelines, err := h.repo.GetAmoCRMPipelines(c.Context())
+	if err != nil {
+		h.logger.Error("Failed to get pipelines from database", zap.Error(err))
+	}
+
+	if len(pipelines) == 0 {
+		// Если в базе нет, получаем из AmoCRM и сохраняем
+		pipelines, err = h.syncPipelines(c)
 		if err != nil {
-			h.logger.Error("Failed to get pipelines from database", zap.Error(err))
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error":   "Failed to get pipelines",
+				"details": err.Error(),
+			})
 		}
+	}
 
-		if len(pipelines) == 0 {
-			// Если в базе нет, получаем из AmoCRM
-			pipelines, err = h.amocrmService.GetPipelines(c.Context())
-			if err != nil {
-				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-					"error":   "Failed to get fields",
-					"details": err,
-				})
-			}
+	return c.JSON(pipelines)
+}
 
-			// Сохраняем в базу данных
-			for _, pipeline := range pipelines {
-				if err := h.repo.SaveAmoCRMPipeline(c.Context(), pipeline); err != nil {
-					h.logger.Error("Failed to save pipeline", zap.Error(err))
-				}
-			}
+func (h *CRMHandler) SyncPipelines(c *fiber.Ctx) error {
+	if h.amocrmService == nil {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"error": "AmoCRM service is not available",
+		})
+	}
+
+	pipelines, err := h.syncPipelines(c)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   "Failed to sync pipelines",
+			"details": err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Pipelines sync completed",
+		"count":   len(pipelines),
+	})
+}
+
+// syncPipelines загружает воронки из AmoCRM и сохраняет их в базу данных
+func (h *CRMHandler) syncPipelines(c *fiber.Ctx) ([]*models.AmoCRMPipeline, error) {
+	rawPipelines, err := h.amocrmService.GetPipelines(c.Context())
+	if err != nil {
+		return nil, err
+	}
+
+	pipelines := make([]*models.AmoCRMPipeline, 0, len(rawPipelines))
+	for _, raw := range rawPipelines {
+		pipeline := pipelineFromMap(raw)
+		if err := h.repo.UpsertAmoCRMPipeline(c.Context(), pipeline); err != nil {
+			h.logger.Error("Failed to upsert pipeline",
+				zap.Int64("pipeline_id", pipeline.ID),
+				zap.Error(err))
 		}
+		pipelines = append(pipelines, pipeline)
+	}
 
-		return c.JSON(pipelines)
+	return pipelines, nil
+}
 
-	*/
-	return nil
+func pipelineFromMap(raw map[string]interface{}) *models.AmoCRMPipeline {
+	pipeline := &models.AmoCRMPipeline{
+		ID:       int64(toInt(raw["id"])),
+		Sort:     toInt(raw["sort"]),
+		Statuses: []*models.AmoCRMStatus{},
+	}
+	pipeline.Name, _ = raw["name"].(string)
+	pipeline.IsMain, _ = raw["is_main"].(bool)
+
+	statuses, _ := raw["statuses"].([]map[string]interface{})
+	for _, rawStatus := range statuses {
+		status := &models.AmoCRMStatus{
+			ID:         int64(toInt(rawStatus["id"])),
+			PipelineID: pipeline.ID,
+			Sort:       toInt(rawStatus["sort"]),
+		}
+		status.Name, _ = rawStatus["name"].(string)
+		pipeline.Statuses = append(pipeline.Statuses, status)
+	}
+
+	return pipeline
+}
+
+func toInt(value interface{}) int {
+	switch v := value.(type) {
+	case int:
+		return v
+	case int64:
+		return int(v)
+	case float64:
+		return int(v)
+	default:
+		return 0
+	}
 }
 
 func (h *CRMHandler) GetFields(c *fiber.Ctx) error {
@@ -0,0 +1,216 @@
+package handlers
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.uber.org/zap"
+
+	"crm-dialer-integration/internal/models"
+	"crm-dialer-integration/internal/repository"
+)
+
+func SetupExecutionRoutes(router fiber.Router, repo *repository.Repository, logger *zap.Logger) {
+	executions := router.Group("/executions")
+
+	// List flow executions
+	executions.Get("/", func(c *fiber.Ctx) error {
+		filter, err := parseExecutionFilter(c)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":   "Invalid filter",
+				"details": err.Error(),
+			})
+		}
+
+		list, err := repo.GetFlowExecutions(c.Context(), filter)
+		if err != nil {
+			logger.Error("Failed to get flow executions", zap.Error(err))
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to get flow executions",
+			})
+		}
+
+		return c.JSON(fiber.Map{
+			"data":  list,
+			"page":  filter.Offset/filter.Limit + 1,
+			"limit": filter.Limit,
+			"count": len(list),
+		})
+	})
+
+	// Get flow execution with its steps
+	executions.Get("/:id", func(c *fiber.Ctx) error {
+		executionID := c.Params("id")
+
+		execution, err := repo.GetFlowExecutionByID(c.Context(), executionID)
+		if err != nil {
+			logger.Error("Failed to get flow execution", zap.String("execution_id", executionID), zap.Error(err))
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to get flow execution",
+			})
+		}
+
+		if execution == nil {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Flow execution not found",
+			})
+		}
+
+		return c.JSON(execution)
+	})
+}
+
+// setupFlowExecutionStatsRoutes registers execution stats under /flows/:id
+func setupFlowExecutionStatsRoutes(flows fiber.Router, repo *repository.Repository, logger *zap.Logger) {
+	// Count executions of a flow by outcome and runs per arm of its split nodes
+	flows.Get("/:id/executions/stats", func(c *fiber.Ctx) error {
+		flowID := c.Params("id")
+		ctx := c.Context()
+
+		filter, err := parseExecutionFilter(c)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":   "Invalid filter",
+				"details": err.Error(),
+			})
+		}
+		filter.FlowID = flowID
+
+		flow, err := repo.GetIntegrationFlowByID(ctx, flowID)
+		if err != nil {
+			logger.Error("Failed to get flow", zap.String("flow_id", flowID), zap.Error(err))
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to get flow",
+			})
+		}
+		if flow == nil {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Flow not found",
+			})
+		}
+
+		stats, err := repo.GetFlowExecutionStats(ctx, filter)
+		if err != nil {
+			logger.Error("Failed to get flow execution stats", zap.String("flow_id", flowID), zap.Error(err))
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to get flow execution stats",
+			})
+		}
+
+		return c.JSON(stats)
+	})
+}
+
+func SetupPendingRunRoutes(router fiber.Router, repo *repository.Repository, logger *zap.Logger) {
+	pendingRuns := router.Group("/pending-runs")
+
+	// List flow runs paused by delay nodes
+	pendingRuns.Get("/", func(c *fiber.Ctx) error {
+		page, _ := strconv.Atoi(c.Query("page", "1"))
+		limit, _ := strconv.Atoi(c.Query("limit", "50"))
+		if page < 1 {
+			page = 1
+		}
+		if limit < 1 || limit > 250 {
+			limit = 50
+		}
+
+		filter := models.FlowPendingRunFilter{
+			FlowID: c.Query("flow_id"),
+			Status: c.Query("status"),
+			Limit:  limit,
+			Offset: (page - 1) * limit,
+		}
+		if leadID := c.Query("lead_id"); leadID != "" {
+			id, err := strconv.ParseInt(leadID, 10, 64)
+			if err != nil {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"error":   "Invalid filter",
+					"details": err.Error(),
+				})
+			}
+			filter.LeadID = id
+		}
+
+		runs, err := repo.GetFlowPendingRuns(c.Context(), filter)
+		if err != nil {
+			logger.Error("Failed to get pending flow runs", zap.Error(err))
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to get pending flow runs",
+			})
+		}
+
+		return c.JSON(fiber.Map{
+			"data":  runs,
+			"page":  page,
+			"limit": limit,
+			"count": len(runs),
+		})
+	})
+
+	// Cancel a paused run
+	pendingRuns.Delete("/:id", func(c *fiber.Ctx) error {
+		runID := c.Params("id")
+
+		cancelled, err := repo.CancelFlowPendingRun(c.Context(), runID)
+		if err != nil {
+			logger.Error("Failed to cancel pending flow run", zap.String("pending_run_id", runID), zap.Error(err))
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to cancel pending flow run",
+			})
+		}
+
+		if !cancelled {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Pending flow run not found or already resumed",
+			})
+		}
+
+		return c.SendStatus(fiber.StatusNoContent)
+	})
+}
+
+func parseExecutionFilter(c *fiber.Ctx) (models.FlowExecutionFilter, error) {
+	page, _ := strconv.Atoi(c.Query("page", "1"))
+	limit, _ := strconv.Atoi(c.Query("limit", "50"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 250 {
+		limit = 50
+	}
+
+	filter := models.FlowExecutionFilter{
+		FlowID:    c.Query("flow_id"),
+		EventType: c.Query("event_type"),
+		Outcome:   c.Query("outcome"),
+		Limit:     limit,
+		Offset:    (page - 1) * limit,
+	}
+
+	if leadID := c.Query("lead_id"); leadID != "" {
+		id, err := strconv.ParseInt(leadID, 10, 64)
+		if err != nil {
+			return filter, err
+		}
+		filter.LeadID = id
+	}
+	if from := c.Query("from"); from != "" {
+		t, err := time.Parse(time.RFC3339, from)
+		if err != nil {
+			return filter, err
+		}
+		filter.From = t
+	}
+	if to := c.Query("to"); to != "" {
+		t, err := time.Parse(time.RFC3339, to)
+		if err != nil {
+			return filter, err
+		}
+		filter.To = t
+	}
+
+	return filter, nil
+}
@@ -3,6 +3,9 @@ package handlers
 import (
 	"crm-dialer-integration/internal/models"
 	"crm-dialer-integration/internal/repository"
+	"crm-dialer-integration/internal/services/flowengine"
+	"crm-dialer-integration/pkg/nats"
+	"encoding/json"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
@@ -10,8 +13,10 @@ import (
 	"go.uber.org/zap"
 )
 
-func SetupFlowRoutes(router fiber.Router, repo *repository.Repository, logger *zap.Logger) {
+func SetupFlowRoutes(router fiber.Router, repo *repository.Repository, natsClient *nats.Client, logger *zap.Logger) {
 	flows := router.Group("/flows")
+	validator := flowengine.NewValidator(repo)
+	engine := flowengine.NewFlowEngine(logger, repo)
 
 	// Get all flows
 	flows.Get("/", func(c *fiber.Ctx) error {
@@ -26,6 +31,20 @@ func SetupFlowRoutes(router fiber.Router, repo *repository.Repository, logger *z
 		return c.JSON(flowsList)
 	})
 
+	// Simulate an unsaved flow against a sample event
+	flows.Post("/simulate", func(c *fiber.Ctx) error {
+		var body simulateRequest
+		if err := c.BodyParser(&body); err != nil || len(body.FlowData) == 0 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid request body",
+			})
+		}
+
+		return simulateFlow(c, engine, repo, logger, "", body.FlowData, &body)
+	})
+
+	setupFlowTemplateRoutes(flows, repo, validator, logger)
+
 	// Get flow by ID
 	flows.Get("/:id", func(c *fiber.Ctx) error {
 		flowID := c.Params("id")
@@ -63,6 +82,10 @@ func SetupFlowRoutes(router fiber.Router, repo *repository.Repository, logger *z
 		body.UpdatedAt = time.Now()
 
 		ctx := c.Context()
+		if rejected, err := rejectActivation(c, repo, validator, nil, &body, logger); rejected || err != nil {
+			return err
+		}
+
 		if err := repo.CreateIntegrationFlow(ctx, &body); err != nil {
 			logger.Error("Failed to create flow", zap.Error(err))
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
@@ -70,7 +93,49 @@ func SetupFlowRoutes(router fiber.Router, repo *repository.Repository, logger *z
 			})
 		}
 
-		return c.Status(fiber.StatusCreated).JSON(body)
+		response := flowResponse{
+			IntegrationFlow: &body,
+			Validation:      validateDraft(c, validator, &body, logger),
+		}
+
+		// Reload to return the draft version created with the flow
+		if flow, err := repo.GetIntegrationFlowByID(ctx, body.ID); err == nil && flow != nil {
+			response.IntegrationFlow = flow
+		}
+
+		return c.Status(fiber.StatusCreated).JSON(response)
+	})
+
+	// Reorder flows, the engine runs them for an event in this order
+	flows.Put("/order", func(c *fiber.Ctx) error {
+		var body struct {
+			FlowIDs []string `json:"flow_ids"`
+		}
+		if err := c.BodyParser(&body); err != nil || len(body.FlowIDs) == 0 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid request body",
+			})
+		}
+
+		ctx := c.Context()
+		if err := repo.ReorderIntegrationFlows(ctx, body.FlowIDs); err != nil {
+			logger.Error("Failed to reorder flows", zap.Error(err))
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to reorder flows",
+			})
+		}
+
+		// Priority changes every flow, so engines reload all of them
+		notifyFlowsChanged(natsClient, "", "reordered", logger)
+
+		flowsList, err := repo.GetIntegrationFlows(ctx)
+		if err != nil {
+			logger.Error("Failed to get flows", zap.Error(err))
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to get flows",
+			})
+		}
+		return c.JSON(flowsList)
 	})
 
 	// Update flow
@@ -89,6 +154,23 @@ func SetupFlowRoutes(router fiber.Router, repo *repository.Repository, logger *z
 		body.UpdatedAt = time.Now()
 
 		ctx := c.Context()
+		existing, err := repo.GetIntegrationFlowByID(ctx, flowID)
+		if err != nil {
+			logger.Error("Failed to get flow", zap.String("flow_id", flowID), zap.Error(err))
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to get flow",
+			})
+		}
+		if existing == nil {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Flow not found",
+			})
+		}
+
+		if rejected, err := rejectActivation(c, repo, validator, existing, &body, logger); rejected || err != nil {
+			return err
+		}
+
 		if err := repo.UpdateIntegrationFlow(ctx, &body); err != nil {
 			logger.Error("Failed to update flow", zap.String("flow_id", flowID), zap.Error(err))
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
@@ -96,9 +178,96 @@ func SetupFlowRoutes(router fiber.Router, repo *repository.Repository, logger *z
 			})
 		}
 
-		return c.JSON(body)
+		// is_active and name apply to the published version right away
+		notifyFlowsChanged(natsClient, flowID, "updated", logger)
+
+		response := flowResponse{
+			IntegrationFlow: &body,
+			Validation:      validateDraft(c, validator, &body, logger),
+		}
+		if flow, err := repo.GetIntegrationFlowByID(ctx, flowID); err == nil && flow != nil {
+			response.IntegrationFlow = flow
+		}
+
+		return c.JSON(response)
+	})
+
+	// Validate flow, either the stored one or the flow_data sent in the body
+	flows.Post("/:id/validate", func(c *fiber.Ctx) error {
+		flowID := c.Params("id")
+		ctx := c.Context()
+
+		var body struct {
+			FlowData json.RawMessage `json:"flow_data"`
+		}
+		if len(c.Body()) > 0 {
+			if err := c.BodyParser(&body); err != nil {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"error": "Invalid request body",
+				})
+			}
+		}
+
+		flowData := body.FlowData
+		if len(flowData) == 0 {
+			flow, err := repo.GetIntegrationFlowByID(ctx, flowID)
+			if err != nil {
+				logger.Error("Failed to get flow", zap.String("flow_id", flowID), zap.Error(err))
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+					"error": "Failed to get flow",
+				})
+			}
+			if flow == nil {
+				return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+					"error": "Flow not found",
+				})
+			}
+			flowData = flow.FlowData
+		}
+
+		result, err := validator.ValidateFlow(ctx, flowID, flowData)
+		if err != nil {
+			logger.Error("Failed to validate flow", zap.String("flow_id", flowID), zap.Error(err))
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to validate flow",
+			})
+		}
+
+		return c.JSON(result)
 	})
 
+	// Simulate a stored flow against a sample event
+	flows.Post("/:id/simulate", func(c *fiber.Ctx) error {
+		flowID := c.Params("id")
+		ctx := c.Context()
+
+		var body simulateRequest
+		if err := c.BodyParser(&body); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid request body",
+			})
+		}
+
+		flow, err := repo.GetIntegrationFlowByID(ctx, flowID)
+		if err != nil {
+			logger.Error("Failed to get flow", zap.String("flow_id", flowID), zap.Error(err))
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to get flow",
+			})
+		}
+		if flow == nil {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Flow not found",
+			})
+		}
+
+		return simulateFlow(c, engine, repo, logger, flow.ID, flow.FlowData, &body)
+	})
+
+	setupFlowVersionRoutes(flows, repo, validator, natsClient, logger)
+	setupFlowPortableRoutes(flows, repo, validator, logger)
+	setupFlowExecutionStatsRoutes(flows, repo, logger)
+
 	// Delete flow
 	flows.Delete("/:id", func(c *fiber.Ctx) error {
 		flowID := c.Params("id")
@@ -110,7 +279,127 @@ func SetupFlowRoutes(router fiber.Router, repo *repository.Repository, logger *z
 				"error": "Failed to delete flow",
 			})
 		}
+		notifyFlowsChanged(natsClient, flowID, "deleted", logger)
 
 		return c.SendStatus(fiber.StatusNoContent)
 	})
 }
+
+// notifyFlowsChanged asks flow engines to reload the flow. Without NATS they
+// pick the change up on their periodic reload.
+func notifyFlowsChanged(natsClient *nats.Client, flowID, action string, logger *zap.Logger) {
+	if natsClient == nil {
+		return
+	}
+
+	change := flowengine.FlowsChanged{FlowID: flowID, Action: action}
+	if err := natsClient.Publish(flowengine.FlowsChangedSubject, change); err != nil {
+		logger.Warn("Failed to publish flow change",
+			zap.String("flow_id", flowID),
+			zap.String("action", action),
+			zap.Error(err))
+	}
+}
+
+// rejectInvalidFlow validates an active flow and writes a 422 response when it
+// has errors. Inactive flows are saved regardless of their state, publishing
+// validates the draft again.
+// flowResponse is a saved flow with the validation of its draft. Draft errors
+// don't block saving, they block publishing.
+type flowResponse struct {
+	*models.IntegrationFlow
+	Validation *flowengine.ValidationResult `json:"validation,omitempty"`
+}
+
+// validateDraft validates the saved working copy. A failed validation is only
+// logged, the flow is saved either way.
+func validateDraft(c *fiber.Ctx, validator *flowengine.Validator, flow *models.IntegrationFlow, logger *zap.Logger) *flowengine.ValidationResult {
+	result, err := validator.ValidateFlow(c.Context(), flow.ID, flow.FlowData)
+	if err != nil {
+		logger.Warn("Failed to validate flow draft", zap.String("flow_id", flow.ID), zap.Error(err))
+		return nil
+	}
+	return result
+}
+
+// rejectActivation refuses to turn a flow on when it has no valid published
+// version. The engine runs the published version, so that is the one checked,
+// not the draft being saved. existing is nil for a new flow.
+func rejectActivation(c *fiber.Ctx, repo *repository.Repository, validator *flowengine.Validator, existing, flow *models.IntegrationFlow, logger *zap.Logger) (bool, error) {
+	if !flow.IsActive || (existing != nil && existing.IsActive) {
+		return false, nil
+	}
+
+	if existing == nil || existing.PublishedVersion == 0 {
+		return true, c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{
+			"error": "Flow has no published version and cannot be activated",
+		})
+	}
+
+	ctx := c.Context()
+	published, err := repo.GetIntegrationFlowVersion(ctx, existing.ID, existing.PublishedVersion)
+	if err != nil || published == nil {
+		logger.Error("Failed to get published flow version", zap.String("flow_id", existing.ID), zap.Error(err))
+		return true, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to get published flow version",
+		})
+	}
+
+	result, err := validator.ValidateFlow(ctx, existing.ID, published.FlowData)
+	if err != nil {
+		logger.Error("Failed to validate flow", zap.String("flow_id", existing.ID), zap.Error(err))
+		return true, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to validate flow",
+		})
+	}
+
+	if !result.Valid {
+		return true, c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{
+			"error":      "Published version has validation errors and cannot be activated",
+			"validation": result,
+		})
+	}
+
+	return false, nil
+}
+
+type simulateRequest struct {
+	FlowData    json.RawMessage        `json:"flow_data"`
+	Event       map[string]interface{} `json:"event"`
+	ExecutionID string                 `json:"execution_id"`
+}
+
+// simulateFlow runs the flow against the event from the body, or against the
+// event of a recorded execution when execution_id is given.
+func simulateFlow(c *fiber.Ctx, engine *flowengine.FlowEngine, repo *repository.Repository, logger *zap.Logger, flowID string, flowData json.RawMessage, body *simulateRequest) error {
+	ctx := c.Context()
+	event := body.Event
+
+	if body.ExecutionID != "" {
+		execution, err := repo.GetFlowExecutionByID(ctx, body.ExecutionID)
+		if err != nil {
+			logger.Error("Failed to get flow execution", zap.String("execution_id", body.ExecutionID), zap.Error(err))
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to get flow execution",
+			})
+		}
+		if execution == nil {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Flow execution not found",
+			})
+		}
+		if err := json.Unmarshal(execution.EventData, &event); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to decode execution event",
+			})
+		}
+	}
+
+	if event == nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Event or execution_id is required",
+		})
+	}
+
+	return c.JSON(engine.Simulate(ctx, flowID, flowData, event))
+}
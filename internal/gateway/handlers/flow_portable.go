@@ -0,0 +1,153 @@
+package handlers
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"crm-dialer-integration/internal/models"
+	"crm-dialer-integration/internal/repository"
+	"crm-dialer-integration/internal/services/flowengine"
+)
+
+func setupFlowPortableRoutes(flows fiber.Router, repo *repository.Repository, validator *flowengine.Validator, logger *zap.Logger) {
+	// Import a flow exported from another environment. Names are mapped onto
+	// ids of this account, the flow is created inactive as a draft.
+	flows.Post("/import", func(c *fiber.Ctx) error {
+		var bundle flowengine.FlowBundle
+		if err := c.BodyParser(&bundle); err != nil || len(bundle.FlowData) == 0 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid request body",
+			})
+		}
+		if bundle.Format != flowengine.FlowBundleFormat || bundle.Version != flowengine.FlowBundleVersion {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": fmt.Sprintf("Unsupported bundle, expected format %s version %d", flowengine.FlowBundleFormat, flowengine.FlowBundleVersion),
+			})
+		}
+
+		ctx := c.Context()
+		catalog, err := flowengine.LoadReferenceCatalog(ctx, repo)
+		if err != nil {
+			logger.Error("Failed to load reference catalog", zap.Error(err))
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to load pipelines, fields, buckets and schedulers",
+			})
+		}
+
+		flowData, unresolved, err := flowengine.ImportFlowData(bundle.FlowData, catalog)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":   "Invalid flow_data",
+				"details": err.Error(),
+			})
+		}
+		if len(unresolved) > 0 {
+			return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{
+				"error":      "Flow references entities that don't exist in this environment",
+				"unresolved": unresolved,
+			})
+		}
+
+		flow := &models.IntegrationFlow{
+			ID:             uuid.New().String(),
+			Name:           c.Query("name", bundle.Name),
+			FlowData:       flowData,
+			StopProcessing: bundle.StopProcessing,
+			CreatedAt:      time.Now(),
+			UpdatedAt:      time.Now(),
+		}
+
+		validation, err := validator.ValidateFlow(ctx, flow.ID, flow.FlowData)
+		if err != nil {
+			logger.Error("Failed to validate flow", zap.Error(err))
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to validate flow",
+			})
+		}
+
+		// Dry run only reports how the references map
+		if c.QueryBool("dry_run") {
+			return c.JSON(fiber.Map{
+				"flow":       flow,
+				"validation": validation,
+			})
+		}
+
+		if err := repo.CreateIntegrationFlow(ctx, flow); err != nil {
+			logger.Error("Failed to create flow", zap.Error(err))
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to create flow",
+			})
+		}
+
+		logger.Info("Flow imported", zap.String("flow_id", flow.ID), zap.String("name", flow.Name))
+
+		if created, err := repo.GetIntegrationFlowByID(ctx, flow.ID); err == nil && created != nil {
+			flow = created
+		}
+
+		return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+			"flow":       flow,
+			"validation": validation,
+		})
+	})
+
+	// Export a flow with pipelines, statuses, fields, buckets, schedulers and
+	// subflows referenced by name
+	flows.Get("/:id/export", func(c *fiber.Ctx) error {
+		flowID := c.Params("id")
+		ctx := c.Context()
+
+		flow, err := repo.GetIntegrationFlowByID(ctx, flowID)
+		if err != nil {
+			logger.Error("Failed to get flow", zap.String("flow_id", flowID), zap.Error(err))
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to get flow",
+			})
+		}
+		if flow == nil {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Flow not found",
+			})
+		}
+
+		flowData := flow.FlowData
+		if number := c.QueryInt("version"); number > 0 {
+			version, err := repo.GetIntegrationFlowVersion(ctx, flowID, number)
+			if err != nil {
+				logger.Error("Failed to get flow version", zap.String("flow_id", flowID), zap.Int("version", number), zap.Error(err))
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+					"error": "Failed to get flow version",
+				})
+			}
+			if version == nil {
+				return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+					"error": "Flow version not found",
+				})
+			}
+			flowData = version.FlowData
+		}
+
+		catalog, err := flowengine.LoadReferenceCatalog(ctx, repo)
+		if err != nil {
+			logger.Error("Failed to load reference catalog", zap.Error(err))
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to load pipelines, fields, buckets and schedulers",
+			})
+		}
+
+		bundle, err := flowengine.ExportFlow(flow, flowData, catalog)
+		if err != nil {
+			return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{
+				"error":   "Failed to export flow",
+				"details": err.Error(),
+			})
+		}
+
+		return c.JSON(bundle)
+	})
+}
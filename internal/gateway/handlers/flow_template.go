@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+	"go.uber.org/zap"
+
+	"crm-dialer-integration/internal/repository"
+	"crm-dialer-integration/internal/services/flowengine"
+)
+
+type instantiateTemplateRequest struct {
+	Name   string                 `json:"name"`
+	Params map[string]interface{} `json:"params"`
+}
+
+func setupFlowTemplateRoutes(flows fiber.Router, repo *repository.Repository, validator *flowengine.Validator, logger *zap.Logger) {
+	// List built-in flow templates
+	flows.Get("/templates", func(c *fiber.Ctx) error {
+		templates, err := flowengine.FlowTemplates()
+		if err != nil {
+			logger.Error("Failed to load flow templates", zap.Error(err))
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to load flow templates",
+			})
+		}
+
+		return c.JSON(templates)
+	})
+
+	// Get template by ID
+	flows.Get("/templates/:template", func(c *fiber.Ctx) error {
+		template, err := flowengine.GetFlowTemplate(c.Params("template"))
+		if err != nil {
+			logger.Error("Failed to load flow templates", zap.Error(err))
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to load flow templates",
+			})
+		}
+		if template == nil {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Flow template not found",
+			})
+		}
+
+		return c.JSON(template)
+	})
+
+	// Create an inactive flow from a template with the given parameters
+	flows.Post("/templates/:template/instantiate", func(c *fiber.Ctx) error {
+		templateID := c.Params("template")
+
+		var body instantiateTemplateRequest
+		if err := c.BodyParser(&body); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid request body",
+			})
+		}
+
+		template, err := flowengine.GetFlowTemplate(templateID)
+		if err != nil {
+			logger.Error("Failed to load flow templates", zap.Error(err))
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to load flow templates",
+			})
+		}
+		if template == nil {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Flow template not found",
+			})
+		}
+
+		flow, err := template.Instantiate(body.Name, body.Params)
+		if err != nil {
+			var paramsErr *flowengine.TemplateParamsError
+			if errors.As(err, &paramsErr) {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"error":  "Invalid template parameters",
+					"params": paramsErr.Params,
+				})
+			}
+			logger.Error("Failed to instantiate flow template", zap.String("template_id", templateID), zap.Error(err))
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to instantiate flow template",
+			})
+		}
+
+		ctx := c.Context()
+
+		// Templates are valid as shipped, so errors come from the parameters:
+		// a pipeline, status or bucket that doesn't exist
+		validation, err := validator.ValidateFlow(ctx, flow.ID, flow.FlowData)
+		if err != nil {
+			logger.Error("Failed to validate flow", zap.String("template_id", templateID), zap.Error(err))
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to validate flow",
+			})
+		}
+		if !validation.Valid {
+			return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{
+				"error":      "Flow created from the template has validation errors",
+				"validation": validation,
+			})
+		}
+
+		if err := repo.CreateIntegrationFlow(ctx, flow); err != nil {
+			logger.Error("Failed to create flow", zap.Error(err))
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to create flow",
+			})
+		}
+
+		logger.Info("Flow created from template",
+			zap.String("flow_id", flow.ID),
+			zap.String("template_id", template.ID),
+			zap.Int("template_version", template.Version))
+
+		if created, err := repo.GetIntegrationFlowByID(ctx, flow.ID); err == nil && created != nil {
+			flow = created
+		}
+
+		return c.Status(fiber.StatusCreated).JSON(flow)
+	})
+}
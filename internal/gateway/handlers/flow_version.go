@@ -0,0 +1,232 @@
+package handlers
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"go.uber.org/zap"
+
+	"crm-dialer-integration/internal/models"
+	"crm-dialer-integration/internal/repository"
+	"crm-dialer-integration/internal/services/flowengine"
+	"crm-dialer-integration/pkg/nats"
+)
+
+func setupFlowVersionRoutes(flows fiber.Router, repo *repository.Repository, validator *flowengine.Validator, natsClient *nats.Client, logger *zap.Logger) {
+	// List flow versions
+	flows.Get("/:id/versions", func(c *fiber.Ctx) error {
+		flowID := c.Params("id")
+
+		versions, err := repo.GetIntegrationFlowVersions(c.Context(), flowID)
+		if err != nil {
+			logger.Error("Failed to get flow versions", zap.String("flow_id", flowID), zap.Error(err))
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to get flow versions",
+			})
+		}
+
+		return c.JSON(versions)
+	})
+
+	// Diff two versions, by default the published one against the draft
+	flows.Get("/:id/versions/diff", func(c *fiber.Ctx) error {
+		flowID := c.Params("id")
+		ctx := c.Context()
+
+		flow, err := repo.GetIntegrationFlowByID(ctx, flowID)
+		if err != nil {
+			logger.Error("Failed to get flow", zap.String("flow_id", flowID), zap.Error(err))
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to get flow",
+			})
+		}
+		if flow == nil {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Flow not found",
+			})
+		}
+
+		to := flow.DraftVersion
+		if to == 0 {
+			to = flow.PublishedVersion
+		}
+		from, err := strconv.Atoi(c.Query("from", strconv.Itoa(flow.PublishedVersion)))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid from version",
+			})
+		}
+		if to, err = strconv.Atoi(c.Query("to", strconv.Itoa(to))); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid to version",
+			})
+		}
+
+		versions := make([]*models.IntegrationFlowVersion, 0, 2)
+		for _, number := range []int{from, to} {
+			version, err := repo.GetIntegrationFlowVersion(ctx, flowID, number)
+			if err != nil {
+				logger.Error("Failed to get flow version", zap.String("flow_id", flowID), zap.Int("version", number), zap.Error(err))
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+					"error": "Failed to get flow version",
+				})
+			}
+			if version == nil {
+				return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+					"error":   "Flow version not found",
+					"version": number,
+				})
+			}
+			versions = append(versions, version)
+		}
+
+		diff, err := flowengine.DiffFlows(versions[0].FlowData, versions[1].FlowData)
+		if err != nil {
+			return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{
+				"error":   "Failed to diff flow versions",
+				"details": err.Error(),
+			})
+		}
+
+		return c.JSON(fiber.Map{
+			"from": from,
+			"to":   to,
+			"diff": diff,
+		})
+	})
+
+	// Get flow version with its graph
+	flows.Get("/:id/versions/:version", func(c *fiber.Ctx) error {
+		flowID := c.Params("id")
+		number, err := strconv.Atoi(c.Params("version"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid version",
+			})
+		}
+
+		version, err := repo.GetIntegrationFlowVersion(c.Context(), flowID, number)
+		if err != nil {
+			logger.Error("Failed to get flow version", zap.String("flow_id", flowID), zap.Int("version", number), zap.Error(err))
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to get flow version",
+			})
+		}
+		if version == nil {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Flow version not found",
+			})
+		}
+
+		return c.JSON(version)
+	})
+
+	// Publish the draft, the engine starts running it for new events
+	flows.Post("/:id/publish", func(c *fiber.Ctx) error {
+		flowID := c.Params("id")
+		ctx := c.Context()
+
+		flow, err := repo.GetIntegrationFlowByID(ctx, flowID)
+		if err != nil {
+			logger.Error("Failed to get flow", zap.String("flow_id", flowID), zap.Error(err))
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to get flow",
+			})
+		}
+		if flow == nil {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Flow not found",
+			})
+		}
+		if flow.DraftVersion == 0 {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error": "Flow has no draft to publish",
+			})
+		}
+
+		draft, err := repo.GetIntegrationFlowVersion(ctx, flowID, flow.DraftVersion)
+		if err != nil || draft == nil {
+			logger.Error("Failed to get flow draft", zap.String("flow_id", flowID), zap.Error(err))
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to get flow draft",
+			})
+		}
+
+		result, err := validator.ValidateFlow(ctx, flowID, draft.FlowData)
+		if err != nil {
+			logger.Error("Failed to validate flow", zap.String("flow_id", flowID), zap.Error(err))
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to validate flow",
+			})
+		}
+		if !result.Valid {
+			return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{
+				"error":      "Flow has validation errors and cannot be published",
+				"validation": result,
+			})
+		}
+
+		if err := repo.PublishIntegrationFlowVersion(ctx, flowID, draft.Version); err != nil {
+			logger.Error("Failed to publish flow", zap.String("flow_id", flowID), zap.Int("version", draft.Version), zap.Error(err))
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to publish flow",
+			})
+		}
+
+		logger.Info("Flow published", zap.String("flow_id", flowID), zap.Int("version", draft.Version))
+		notifyFlowsChanged(natsClient, flowID, "published", logger)
+		return c.JSON(fiber.Map{
+			"published_version": draft.Version,
+		})
+	})
+
+	// Roll back to an earlier version, publishing it again
+	flows.Post("/:id/versions/:version/rollback", func(c *fiber.Ctx) error {
+		flowID := c.Params("id")
+		ctx := c.Context()
+
+		number, err := strconv.Atoi(c.Params("version"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid version",
+			})
+		}
+
+		version, err := repo.GetIntegrationFlowVersion(ctx, flowID, number)
+		if err != nil {
+			logger.Error("Failed to get flow version", zap.String("flow_id", flowID), zap.Int("version", number), zap.Error(err))
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to get flow version",
+			})
+		}
+		if version == nil {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Flow version not found",
+			})
+		}
+		if version.Status == repository.FlowVersionDraft {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error": "Drafts are published, not rolled back to",
+			})
+		}
+
+		if err := repo.RollbackIntegrationFlow(ctx, flowID, number); err != nil {
+			if errors.Is(err, repository.ErrNoFlowVersion) {
+				return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+					"error": "Flow version not found",
+				})
+			}
+			logger.Error("Failed to roll back flow", zap.String("flow_id", flowID), zap.Int("version", number), zap.Error(err))
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to roll back flow",
+			})
+		}
+
+		logger.Info("Flow rolled back", zap.String("flow_id", flowID), zap.Int("version", number))
+		notifyFlowsChanged(natsClient, flowID, "rolled_back", logger)
+		return c.JSON(fiber.Map{
+			"published_version": number,
+		})
+	})
+}
@@ -15,6 +15,27 @@ type AmoCRMField struct {
 	UpdatedAt  time.Time `db:"updated_at" json:"updated_at"`
 }
 
+// AmoCRMPipeline represents a pipeline from AmoCRM with its statuses
+type AmoCRMPipeline struct {
+	ID        int64           `db:"id" json:"id"`
+	Name      string          `db:"name" json:"name"`
+	Sort      int             `db:"sort" json:"sort"`
+	IsMain    bool            `db:"is_main" json:"is_main"`
+	Statuses  []*AmoCRMStatus `db:"-" json:"statuses"`
+	CreatedAt time.Time       `db:"created_at" json:"created_at"`
+	UpdatedAt time.Time       `db:"updated_at" json:"updated_at"`
+}
+
+// AmoCRMStatus represents a pipeline status from AmoCRM
+type AmoCRMStatus struct {
+	ID         int64     `db:"id" json:"id"`
+	PipelineID int64     `db:"pipeline_id" json:"pipeline_id"`
+	Name       string    `db:"name" json:"name"`
+	Sort       int       `db:"sort" json:"sort"`
+	CreatedAt  time.Time `db:"created_at" json:"created_at"`
+	UpdatedAt  time.Time `db:"updated_at" json:"updated_at"`
+}
+
 // DialerScheduler represents a scheduler from dialer system
 type DialerScheduler struct {
 	ID        string    `db:"id" json:"id"` // UUID
@@ -42,12 +63,28 @@ type DialerCampaign struct {
 
 // IntegrationFlow represents a React Flow configuration
 type IntegrationFlow struct {
-	ID        string          `db:"id" json:"id"`
-	Name      string          `db:"name" json:"name"`
-	FlowData  json.RawMessage `db:"flow_data" json:"flow_data"`
-	IsActive  bool            `db:"is_active" json:"is_active"`
-	CreatedAt time.Time       `db:"created_at" json:"created_at"`
-	UpdatedAt time.Time       `db:"updated_at" json:"updated_at"`
+	ID               string          `db:"id" json:"id"`
+	Name             string          `db:"name" json:"name"`
+	FlowData         json.RawMessage `db:"flow_data" json:"flow_data"`
+	IsActive         bool            `db:"is_active" json:"is_active"`
+	Priority         int             `db:"priority" json:"priority"`
+	StopProcessing   bool            `db:"stop_processing" json:"stop_processing"`
+	PublishedVersion int             `db:"published_version" json:"published_version,omitempty"`
+	DraftVersion     int             `db:"-" json:"draft_version,omitempty"`
+	CreatedAt        time.Time       `db:"created_at" json:"created_at"`
+	UpdatedAt        time.Time       `db:"updated_at" json:"updated_at"`
+}
+
+// IntegrationFlowVersion is a saved graph of a flow. A flow has at most one
+// draft, one published version and any number of archived ones.
+type IntegrationFlowVersion struct {
+	ID          string          `db:"id" json:"id"`
+	FlowID      string          `db:"flow_id" json:"flow_id"`
+	Version     int             `db:"version" json:"version"`
+	FlowData    json.RawMessage `db:"flow_data" json:"flow_data,omitempty"`
+	Status      string          `db:"status" json:"status"`
+	CreatedAt   time.Time       `db:"created_at" json:"created_at"`
+	PublishedAt *time.Time      `db:"published_at" json:"published_at,omitempty"`
 }
 
 // WebhookLog represents a webhook log entry
@@ -58,3 +95,115 @@ type WebhookLog struct {
 	ProcessedAt time.Time       `db:"processed_at" json:"processed_at"`
 	Status      string          `db:"status" json:"status"`
 }
+
+// FlowExecution represents one run of an event through an integration flow
+type FlowExecution struct {
+	ID             string               `db:"id" json:"id"`
+	FlowID         string               `db:"flow_id" json:"flow_id"`
+	EventType      string               `db:"event_type" json:"event_type"`
+	LeadID         int64                `db:"lead_id" json:"lead_id"`
+	EventData      json.RawMessage      `db:"event_data" json:"event_data"`
+	Outcome        string               `db:"outcome" json:"outcome"`
+	Error          string               `db:"error" json:"error,omitempty"`
+	ResumedFrom    string               `db:"resumed_from" json:"resumed_from,omitempty"`
+	FlowVersion    int                  `db:"flow_version" json:"flow_version,omitempty"`
+	IdempotencyKey string               `db:"idempotency_key" json:"idempotency_key,omitempty"`
+	DuplicateOf    string               `db:"duplicate_of" json:"duplicate_of,omitempty"`
+	StartedAt      time.Time            `db:"started_at" json:"started_at"`
+	FinishedAt     time.Time            `db:"finished_at" json:"finished_at"`
+	DurationMs     int64                `db:"duration_ms" json:"duration_ms"`
+	Steps          []*FlowExecutionStep `db:"-" json:"steps,omitempty"`
+}
+
+// FlowExecutionStep represents a node visited during a flow execution
+type FlowExecutionStep struct {
+	ID          string            `db:"id" json:"id"`
+	ExecutionID string            `db:"execution_id" json:"execution_id"`
+	Position    int               `db:"position" json:"position"`
+	NodeID      string            `db:"node_id" json:"node_id"`
+	NodeType    string            `db:"node_type" json:"node_type"`
+	Branch      string            `db:"branch" json:"branch,omitempty"`
+	Status      string            `db:"status" json:"status"`
+	Condition   json.RawMessage   `db:"condition" json:"condition,omitempty"`
+	ActionType  string            `db:"action_type" json:"action_type,omitempty"`
+	Messages    json.RawMessage   `db:"messages" json:"messages,omitempty"`
+	Details     json.RawMessage   `db:"details" json:"details,omitempty"`
+	Error       string            `db:"error" json:"error,omitempty"`
+	StartedAt   time.Time         `db:"started_at" json:"started_at"`
+	DurationMs  int64             `db:"duration_ms" json:"duration_ms"`
+	Results     []*FlowStepResult `db:"-" json:"results,omitempty"`
+}
+
+// FlowStepResult is the outcome of a command published by a flow step and
+// executed by another service
+type FlowStepResult struct {
+	ID          string    `db:"id" json:"id"`
+	ExecutionID string    `db:"execution_id" json:"execution_id"`
+	StepID      string    `db:"step_id" json:"step_id"`
+	Command     string    `db:"command" json:"command"`
+	Status      string    `db:"status" json:"status"`
+	Error       string    `db:"error" json:"error,omitempty"`
+	CreatedAt   time.Time `db:"created_at" json:"created_at"`
+}
+
+// FlowPendingRun is a flow run paused by a delay node until ResumeAt
+type FlowPendingRun struct {
+	ID             string          `db:"id" json:"id"`
+	FlowID         string          `db:"flow_id" json:"flow_id"`
+	FlowData       json.RawMessage `db:"flow_data" json:"-"`
+	FlowVersion    int             `db:"flow_version" json:"flow_version,omitempty"`
+	IdempotencyKey string          `db:"idempotency_key" json:"idempotency_key,omitempty"`
+	NodeID         string          `db:"node_id" json:"node_id"`
+	ExecutionID    string          `db:"execution_id" json:"execution_id,omitempty"`
+	LeadID         int64           `db:"lead_id" json:"lead_id"`
+	EventType      string          `db:"event_type" json:"event_type"`
+	EventData      json.RawMessage `db:"event_data" json:"event_data"`
+	Status         string          `db:"status" json:"status"`
+	Attempts       int             `db:"attempts" json:"attempts"`
+	Error          string          `db:"error" json:"error,omitempty"`
+	ResumeAt       time.Time       `db:"resume_at" json:"resume_at"`
+	CreatedAt      time.Time       `db:"created_at" json:"created_at"`
+	UpdatedAt      time.Time       `db:"updated_at" json:"updated_at"`
+}
+
+// FlowPendingRunFilter narrows down the list of paused flow runs
+type FlowPendingRunFilter struct {
+	FlowID string
+	LeadID int64
+	Status string
+	Limit  int
+	Offset int
+}
+
+// FlowExecutionStats summarizes the executions of a flow
+type FlowExecutionStats struct {
+	Total    int64             `json:"total"`
+	Outcomes map[string]int64  `json:"outcomes"`
+	Splits   []*FlowSplitStats `json:"splits"`
+}
+
+// FlowSplitStats counts the runs that took each arm of a split node
+type FlowSplitStats struct {
+	NodeID string          `json:"node_id"`
+	Arms   []*FlowSplitArm `json:"arms"`
+}
+
+// FlowSplitArm is an outgoing edge of a split node with the runs and distinct leads routed to it
+type FlowSplitArm struct {
+	Arm    string `json:"arm"`
+	EdgeID string `json:"edge_id"`
+	Runs   int64  `json:"runs"`
+	Leads  int64  `json:"leads"`
+}
+
+// FlowExecutionFilter narrows down the list of flow executions
+type FlowExecutionFilter struct {
+	FlowID    string
+	LeadID    int64
+	EventType string
+	Outcome   string
+	From      time.Time
+	To        time.Time
+	Limit     int
+	Offset    int
+}
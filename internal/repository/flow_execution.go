@@ -0,0 +1,347 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"crm-dialer-integration/internal/models"
+)
+
+func (r *Repository) CreateFlowExecution(ctx context.Context, execution *models.FlowExecution) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := `
+        INSERT INTO flow_executions (id, flow_id, flow_version, event_type, lead_id, event_data, outcome, error, resumed_from,
+                                     idempotency_key, duplicate_of, started_at, finished_at, duration_ms)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
+    `
+
+	if _, err := tx.ExecContext(ctx, query,
+		execution.ID, execution.FlowID, nullableInt(int64(execution.FlowVersion)), execution.EventType, nullableInt(execution.LeadID),
+		execution.EventData, execution.Outcome, nullableString(execution.Error), nullableString(execution.ResumedFrom),
+		nullableString(execution.IdempotencyKey), nullableString(execution.DuplicateOf),
+		execution.StartedAt, execution.FinishedAt, execution.DurationMs); err != nil {
+		return fmt.Errorf("failed to create flow execution: %w", err)
+	}
+
+	stepQuery := `
+        INSERT INTO flow_execution_steps (id, execution_id, position, node_id, node_type, branch, status, condition, action_type, messages, details, error, started_at, duration_ms)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
+    `
+
+	for _, step := range execution.Steps {
+		if _, err := tx.ExecContext(ctx, stepQuery,
+			step.ID, execution.ID, step.Position, step.NodeID, step.NodeType, nullableString(step.Branch), step.Status,
+			nullableJSON(step.Condition), nullableString(step.ActionType), nullableJSON(step.Messages),
+			nullableJSON(step.Details), nullableString(step.Error), step.StartedAt, step.DurationMs); err != nil {
+			return fmt.Errorf("failed to create flow execution step: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit flow execution: %w", err)
+	}
+
+	return nil
+}
+
+func (r *Repository) GetFlowExecutions(ctx context.Context, filter models.FlowExecutionFilter) ([]*models.FlowExecution, error) {
+	var conditions []string
+	var args []interface{}
+
+	addCondition := func(condition string, value interface{}) {
+		args = append(args, value)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+
+	if filter.FlowID != "" {
+		addCondition("flow_id = $%d", filter.FlowID)
+	}
+	if filter.LeadID != 0 {
+		addCondition("lead_id = $%d", filter.LeadID)
+	}
+	if filter.EventType != "" {
+		addCondition("event_type = $%d", filter.EventType)
+	}
+	if filter.Outcome != "" {
+		addCondition("outcome = $%d", filter.Outcome)
+	}
+	if !filter.From.IsZero() {
+		addCondition("started_at >= $%d", filter.From)
+	}
+	if !filter.To.IsZero() {
+		addCondition("started_at < $%d", filter.To)
+	}
+
+	where := ""
+	if len(conditions) > 0 {
+		where = "WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = 50
+	}
+	args = append(args, limit, filter.Offset)
+
+	query := fmt.Sprintf(`
+        SELECT id, flow_id, COALESCE(flow_version, 0), event_type, COALESCE(lead_id, 0), event_data, outcome, COALESCE(error, ''),
+               COALESCE(resumed_from::text, ''), COALESCE(idempotency_key, ''), COALESCE(duplicate_of::text, ''),
+               started_at, finished_at, duration_ms
+        FROM flow_executions
+        %s
+        ORDER BY started_at DESC
+        LIMIT $%d OFFSET $%d
+    `, where, len(args)-1, len(args))
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query flow executions: %w", err)
+	}
+	defer rows.Close()
+
+	executions := []*models.FlowExecution{}
+	for rows.Next() {
+		var execution models.FlowExecution
+		if err := rows.Scan(&execution.ID, &execution.FlowID, &execution.FlowVersion, &execution.EventType, &execution.LeadID,
+			&execution.EventData, &execution.Outcome, &execution.Error, &execution.ResumedFrom,
+			&execution.IdempotencyKey, &execution.DuplicateOf,
+			&execution.StartedAt, &execution.FinishedAt, &execution.DurationMs); err != nil {
+			return nil, fmt.Errorf("failed to scan flow execution: %w", err)
+		}
+		executions = append(executions, &execution)
+	}
+
+	return executions, nil
+}
+
+// GetFlowExecutionStats counts executions by outcome and the runs that took
+// each arm of split nodes. FlowID, EventType, From and To of the filter apply.
+func (r *Repository) GetFlowExecutionStats(ctx context.Context, filter models.FlowExecutionFilter) (*models.FlowExecutionStats, error) {
+	var conditions []string
+	var args []interface{}
+
+	addCondition := func(condition string, value interface{}) {
+		args = append(args, value)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+
+	if filter.FlowID != "" {
+		addCondition("e.flow_id = $%d", filter.FlowID)
+	}
+	if filter.EventType != "" {
+		addCondition("e.event_type = $%d", filter.EventType)
+	}
+	if !filter.From.IsZero() {
+		addCondition("e.started_at >= $%d", filter.From)
+	}
+	if !filter.To.IsZero() {
+		addCondition("e.started_at < $%d", filter.To)
+	}
+
+	where := ""
+	if len(conditions) > 0 {
+		where = "AND " + strings.Join(conditions, " AND ")
+	}
+
+	stats := &models.FlowExecutionStats{
+		Outcomes: make(map[string]int64),
+		Splits:   []*models.FlowSplitStats{},
+	}
+
+	outcomeQuery := fmt.Sprintf(`
+        SELECT e.outcome, COUNT(*)
+        FROM flow_executions e
+        WHERE TRUE %s
+        GROUP BY e.outcome
+    `, where)
+
+	rows, err := r.db.QueryContext(ctx, outcomeQuery, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query flow execution outcomes: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var outcome string
+		var count int64
+		if err := rows.Scan(&outcome, &count); err != nil {
+			return nil, fmt.Errorf("failed to scan flow execution outcome: %w", err)
+		}
+		stats.Outcomes[outcome] = count
+		stats.Total += count
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read flow execution outcomes: %w", err)
+	}
+
+	splitQuery := fmt.Sprintf(`
+        SELECT s.node_id, s.details->>'arm', COALESCE(s.details->>'edge_id', ''), COUNT(*), COUNT(DISTINCT e.lead_id)
+        FROM flow_execution_steps s
+        JOIN flow_executions e ON e.id = s.execution_id
+        WHERE s.node_type = 'split' AND s.details->>'arm' IS NOT NULL %s
+        GROUP BY 1, 2, 3
+        ORDER BY 1, 2
+    `, where)
+
+	splitRows, err := r.db.QueryContext(ctx, splitQuery, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query split stats: %w", err)
+	}
+	defer splitRows.Close()
+
+	var current *models.FlowSplitStats
+	for splitRows.Next() {
+		var nodeID string
+		var arm models.FlowSplitArm
+		if err := splitRows.Scan(&nodeID, &arm.Arm, &arm.EdgeID, &arm.Runs, &arm.Leads); err != nil {
+			return nil, fmt.Errorf("failed to scan split stats: %w", err)
+		}
+		if current == nil || current.NodeID != nodeID {
+			current = &models.FlowSplitStats{NodeID: nodeID}
+			stats.Splits = append(stats.Splits, current)
+		}
+		current.Arms = append(current.Arms, &arm)
+	}
+	if err := splitRows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read split stats: %w", err)
+	}
+
+	return stats, nil
+}
+
+func (r *Repository) GetFlowExecutionByID(ctx context.Context, id string) (*models.FlowExecution, error) {
+	query := `
+        SELECT id, flow_id, COALESCE(flow_version, 0), event_type, COALESCE(lead_id, 0), event_data, outcome, COALESCE(error, ''),
+               COALESCE(resumed_from::text, ''), COALESCE(idempotency_key, ''), COALESCE(duplicate_of::text, ''),
+               started_at, finished_at, duration_ms
+        FROM flow_executions
+        WHERE id = $1
+    `
+
+	var execution models.FlowExecution
+	err := r.db.QueryRowContext(ctx, query, id).Scan(
+		&execution.ID, &execution.FlowID, &execution.FlowVersion, &execution.EventType, &execution.LeadID,
+		&execution.EventData, &execution.Outcome, &execution.Error, &execution.ResumedFrom,
+		&execution.IdempotencyKey, &execution.DuplicateOf,
+		&execution.StartedAt, &execution.FinishedAt, &execution.DurationMs)
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get flow execution: %w", err)
+	}
+
+	stepQuery := `
+        SELECT id, execution_id, position, node_id, node_type, COALESCE(branch, ''), status, condition,
+               COALESCE(action_type, ''), messages, details, COALESCE(error, ''), started_at, duration_ms
+        FROM flow_execution_steps
+        WHERE execution_id = $1
+        ORDER BY position
+    `
+
+	rows, err := r.db.QueryContext(ctx, stepQuery, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query flow execution steps: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var step models.FlowExecutionStep
+		var condition, messages, details []byte
+		if err := rows.Scan(&step.ID, &step.ExecutionID, &step.Position, &step.NodeID, &step.NodeType,
+			&step.Branch, &step.Status, &condition, &step.ActionType, &messages, &details, &step.Error,
+			&step.StartedAt, &step.DurationMs); err != nil {
+			return nil, fmt.Errorf("failed to scan flow execution step: %w", err)
+		}
+		step.Condition = condition
+		step.Messages = messages
+		step.Details = details
+		execution.Steps = append(execution.Steps, &step)
+	}
+
+	results, err := r.getFlowStepResults(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	for _, step := range execution.Steps {
+		step.Results = results[step.ID]
+	}
+
+	return &execution, nil
+}
+
+func (r *Repository) CreateFlowStepResult(ctx context.Context, result *models.FlowStepResult) error {
+	query := `
+        INSERT INTO flow_step_results (id, execution_id, step_id, command, status, error)
+        VALUES ($1, $2, $3, $4, $5, $6)
+        RETURNING created_at
+    `
+
+	err := r.db.QueryRowContext(ctx, query,
+		result.ID, result.ExecutionID, result.StepID, result.Command, result.Status, nullableString(result.Error),
+	).Scan(&result.CreatedAt)
+
+	if err != nil {
+		return fmt.Errorf("failed to create flow step result: %w", err)
+	}
+
+	return nil
+}
+
+// getFlowStepResults returns command results of an execution grouped by step id
+func (r *Repository) getFlowStepResults(ctx context.Context, executionID string) (map[string][]*models.FlowStepResult, error) {
+	query := `
+        SELECT id, execution_id, step_id, command, status, COALESCE(error, ''), created_at
+        FROM flow_step_results
+        WHERE execution_id = $1
+        ORDER BY created_at
+    `
+
+	rows, err := r.db.QueryContext(ctx, query, executionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query flow step results: %w", err)
+	}
+	defer rows.Close()
+
+	results := make(map[string][]*models.FlowStepResult)
+	for rows.Next() {
+		var result models.FlowStepResult
+		if err := rows.Scan(&result.ID, &result.ExecutionID, &result.StepID, &result.Command,
+			&result.Status, &result.Error, &result.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan flow step result: %w", err)
+		}
+		results[result.StepID] = append(results[result.StepID], &result)
+	}
+
+	return results, nil
+}
+
+func nullableString(value string) interface{} {
+	if value == "" {
+		return nil
+	}
+	return value
+}
+
+func nullableInt(value int64) interface{} {
+	if value == 0 {
+		return nil
+	}
+	return value
+}
+
+func nullableJSON(value json.RawMessage) interface{} {
+	if len(value) == 0 {
+		return nil
+	}
+	return []byte(value)
+}
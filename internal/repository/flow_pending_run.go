@@ -0,0 +1,212 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"crm-dialer-integration/internal/models"
+)
+
+const flowPendingRunColumns = `
+        id, flow_id, flow_data, COALESCE(flow_version, 0), COALESCE(idempotency_key, ''), node_id, COALESCE(execution_id::text, ''), COALESCE(lead_id, 0),
+        event_type, event_data, status, attempts, COALESCE(error, ''), resume_at, created_at, updated_at
+    `
+
+func (r *Repository) CreateFlowPendingRun(ctx context.Context, run *models.FlowPendingRun) error {
+	query := `
+        INSERT INTO flow_pending_runs (id, flow_id, flow_data, flow_version, idempotency_key, node_id, execution_id, lead_id,
+                                       event_type, event_data, status, resume_at)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+        RETURNING created_at, updated_at
+    `
+
+	err := r.db.QueryRowContext(ctx, query,
+		run.ID, run.FlowID, run.FlowData, nullableInt(int64(run.FlowVersion)), nullableString(run.IdempotencyKey), run.NodeID, nullableString(run.ExecutionID), nullableInt(run.LeadID),
+		run.EventType, run.EventData, run.Status, run.ResumeAt,
+	).Scan(&run.CreatedAt, &run.UpdatedAt)
+
+	if err != nil {
+		return fmt.Errorf("failed to create flow pending run: %w", err)
+	}
+
+	return nil
+}
+
+// ClaimDueFlowPendingRuns marks up to limit due runs as running and returns them.
+// Runs left in running state longer than staleAfter (e.g. after a crash) are claimed again.
+func (r *Repository) ClaimDueFlowPendingRuns(ctx context.Context, limit int, staleAfter time.Duration) ([]*models.FlowPendingRun, error) {
+	query := fmt.Sprintf(`
+        UPDATE flow_pending_runs
+        SET status = 'running', claimed_at = NOW()
+        WHERE id IN (
+            SELECT id FROM flow_pending_runs
+            WHERE (status = 'pending' AND resume_at <= NOW())
+               OR (status = 'running' AND claimed_at < $2)
+            ORDER BY resume_at, created_at
+            LIMIT $1
+            FOR UPDATE SKIP LOCKED
+        )
+        RETURNING %s
+    `, flowPendingRunColumns)
+
+	rows, err := r.db.QueryContext(ctx, query, limit, time.Now().Add(-staleAfter))
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim flow pending runs: %w", err)
+	}
+	defer rows.Close()
+
+	return scanFlowPendingRuns(rows)
+}
+
+// FinishFlowPendingRun sets the final status of a run: completed, failed or cancelled
+func (r *Repository) FinishFlowPendingRun(ctx context.Context, id, status, errMsg string) error {
+	query := `
+        UPDATE flow_pending_runs
+        SET status = $2, error = $3, attempts = attempts + 1
+        WHERE id = $1
+    `
+
+	if _, err := r.db.ExecContext(ctx, query, id, status, nullableString(errMsg)); err != nil {
+		return fmt.Errorf("failed to finish flow pending run: %w", err)
+	}
+
+	return nil
+}
+
+// RescheduleFlowPendingRun returns a claimed run to the queue after a failed attempt
+func (r *Repository) RescheduleFlowPendingRun(ctx context.Context, id string, resumeAt time.Time, errMsg string) error {
+	query := `
+        UPDATE flow_pending_runs
+        SET status = 'pending', resume_at = $2, error = $3, attempts = attempts + 1, claimed_at = NULL
+        WHERE id = $1
+    `
+
+	if _, err := r.db.ExecContext(ctx, query, id, resumeAt, nullableString(errMsg)); err != nil {
+		return fmt.Errorf("failed to reschedule flow pending run: %w", err)
+	}
+
+	return nil
+}
+
+// PostponeFlowPendingRun returns a claimed run to the queue without counting an
+// attempt, e.g. when the throttle window it waits for is still full
+func (r *Repository) PostponeFlowPendingRun(ctx context.Context, id string, resumeAt time.Time) error {
+	query := `
+        UPDATE flow_pending_runs
+        SET status = 'pending', resume_at = $2, claimed_at = NULL
+        WHERE id = $1
+    `
+
+	if _, err := r.db.ExecContext(ctx, query, id, resumeAt); err != nil {
+		return fmt.Errorf("failed to postpone flow pending run: %w", err)
+	}
+
+	return nil
+}
+
+// CancelFlowPendingRun cancels a run that hasn't been resumed yet
+func (r *Repository) CancelFlowPendingRun(ctx context.Context, id string) (bool, error) {
+	query := `
+        UPDATE flow_pending_runs
+        SET status = 'cancelled'
+        WHERE id = $1 AND status = 'pending'
+    `
+
+	result, err := r.db.ExecContext(ctx, query, id)
+	if err != nil {
+		return false, fmt.Errorf("failed to cancel flow pending run: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get affected rows: %w", err)
+	}
+
+	return affected > 0, nil
+}
+
+// CancelFlowPendingRunsForLead cancels all waiting runs of a lead
+func (r *Repository) CancelFlowPendingRunsForLead(ctx context.Context, leadID int64) (int64, error) {
+	query := `
+        UPDATE flow_pending_runs
+        SET status = 'cancelled', error = 'lead deleted'
+        WHERE lead_id = $1 AND status = 'pending'
+    `
+
+	result, err := r.db.ExecContext(ctx, query, leadID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to cancel flow pending runs: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get affected rows: %w", err)
+	}
+
+	return affected, nil
+}
+
+func (r *Repository) GetFlowPendingRuns(ctx context.Context, filter models.FlowPendingRunFilter) ([]*models.FlowPendingRun, error) {
+	var conditions []string
+	var args []interface{}
+
+	addCondition := func(condition string, value interface{}) {
+		args = append(args, value)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+
+	if filter.FlowID != "" {
+		addCondition("flow_id = $%d", filter.FlowID)
+	}
+	if filter.LeadID != 0 {
+		addCondition("lead_id = $%d", filter.LeadID)
+	}
+	if filter.Status != "" {
+		addCondition("status = $%d", filter.Status)
+	}
+
+	where := ""
+	if len(conditions) > 0 {
+		where = "WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = 50
+	}
+	args = append(args, limit, filter.Offset)
+
+	query := fmt.Sprintf(`
+        SELECT %s
+        FROM flow_pending_runs
+        %s
+        ORDER BY resume_at
+        LIMIT $%d OFFSET $%d
+    `, flowPendingRunColumns, where, len(args)-1, len(args))
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query flow pending runs: %w", err)
+	}
+	defer rows.Close()
+
+	return scanFlowPendingRuns(rows)
+}
+
+func scanFlowPendingRuns(rows *sql.Rows) ([]*models.FlowPendingRun, error) {
+	runs := []*models.FlowPendingRun{}
+	for rows.Next() {
+		var run models.FlowPendingRun
+		if err := rows.Scan(&run.ID, &run.FlowID, &run.FlowData, &run.FlowVersion, &run.IdempotencyKey, &run.NodeID, &run.ExecutionID, &run.LeadID,
+			&run.EventType, &run.EventData, &run.Status, &run.Attempts, &run.Error,
+			&run.ResumeAt, &run.CreatedAt, &run.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan flow pending run: %w", err)
+		}
+		runs = append(runs, &run)
+	}
+
+	return runs, rows.Err()
+}
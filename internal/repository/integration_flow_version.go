@@ -0,0 +1,256 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"crm-dialer-integration/internal/models"
+)
+
+const (
+	FlowVersionDraft     = "draft"
+	FlowVersionPublished = "published"
+	FlowVersionArchived  = "archived"
+)
+
+// ErrNoFlowVersion is returned when the requested flow version doesn't exist
+var ErrNoFlowVersion = errors.New("flow version not found")
+
+// saveFlowDraft records the working copy of a flow as its draft version. An
+// existing draft is overwritten, an unchanged graph creates no version.
+func saveFlowDraft(ctx context.Context, tx *sql.Tx, flowID string, flowData json.RawMessage) error {
+	var latest int
+	var status string
+	var unchanged bool
+
+	err := tx.QueryRowContext(ctx, `
+        SELECT version, status, flow_data = $2
+        FROM integration_flow_versions
+        WHERE flow_id = $1
+        ORDER BY version DESC
+        LIMIT 1
+    `, flowID, []byte(flowData)).Scan(&latest, &status, &unchanged)
+
+	switch {
+	case err == sql.ErrNoRows:
+	case err != nil:
+		return fmt.Errorf("failed to get latest flow version: %w", err)
+	case unchanged:
+		return nil
+	case status == FlowVersionDraft:
+		if _, err := tx.ExecContext(ctx, `
+            UPDATE integration_flow_versions
+            SET flow_data = $3, created_at = NOW()
+            WHERE flow_id = $1 AND version = $2
+        `, flowID, latest, []byte(flowData)); err != nil {
+			return fmt.Errorf("failed to update flow draft: %w", err)
+		}
+		return nil
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+        INSERT INTO integration_flow_versions (flow_id, version, flow_data, status)
+        VALUES ($1, $2, $3, $4)
+    `, flowID, latest+1, []byte(flowData), FlowVersionDraft); err != nil {
+		return fmt.Errorf("failed to create flow draft: %w", err)
+	}
+
+	return nil
+}
+
+// GetPublishedIntegrationFlows returns every flow that has a published version,
+// with FlowData set to the published graph
+func (r *Repository) GetPublishedIntegrationFlows(ctx context.Context) ([]*models.IntegrationFlow, error) {
+	query := `
+        SELECT f.id, f.name, v.flow_data, f.is_active, f.priority, f.stop_processing, v.version, f.created_at, f.updated_at
+        FROM integration_flows f
+        JOIN integration_flow_versions v ON v.flow_id = f.id AND v.version = f.published_version
+        ORDER BY f.priority, f.name
+    `
+
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query published flows: %w", err)
+	}
+	defer rows.Close()
+
+	var flows []*models.IntegrationFlow
+	for rows.Next() {
+		var flow models.IntegrationFlow
+		if err := rows.Scan(&flow.ID, &flow.Name, &flow.FlowData, &flow.IsActive, &flow.Priority, &flow.StopProcessing,
+			&flow.PublishedVersion, &flow.CreatedAt, &flow.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan flow: %w", err)
+		}
+		flows = append(flows, &flow)
+	}
+
+	return flows, rows.Err()
+}
+
+// GetPublishedIntegrationFlow returns a flow with its published graph, or nil
+// when the flow doesn't exist or was never published
+func (r *Repository) GetPublishedIntegrationFlow(ctx context.Context, id string) (*models.IntegrationFlow, error) {
+	query := `
+        SELECT f.id, f.name, v.flow_data, f.is_active, f.priority, f.stop_processing, v.version, f.created_at, f.updated_at
+        FROM integration_flows f
+        JOIN integration_flow_versions v ON v.flow_id = f.id AND v.version = f.published_version
+        WHERE f.id = $1
+    `
+
+	var flow models.IntegrationFlow
+	err := r.db.QueryRowContext(ctx, query, id).Scan(&flow.ID, &flow.Name, &flow.FlowData, &flow.IsActive,
+		&flow.Priority, &flow.StopProcessing, &flow.PublishedVersion, &flow.CreatedAt, &flow.UpdatedAt)
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get published flow: %w", err)
+	}
+
+	return &flow, nil
+}
+
+// GetIntegrationFlowVersions lists versions of a flow, newest first, without their graphs
+func (r *Repository) GetIntegrationFlowVersions(ctx context.Context, flowID string) ([]*models.IntegrationFlowVersion, error) {
+	query := `
+        SELECT id, flow_id, version, status, created_at, published_at
+        FROM integration_flow_versions
+        WHERE flow_id = $1
+        ORDER BY version DESC
+    `
+
+	rows, err := r.db.QueryContext(ctx, query, flowID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query flow versions: %w", err)
+	}
+	defer rows.Close()
+
+	versions := []*models.IntegrationFlowVersion{}
+	for rows.Next() {
+		var version models.IntegrationFlowVersion
+		if err := rows.Scan(&version.ID, &version.FlowID, &version.Version, &version.Status,
+			&version.CreatedAt, &version.PublishedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan flow version: %w", err)
+		}
+		versions = append(versions, &version)
+	}
+
+	return versions, rows.Err()
+}
+
+func (r *Repository) GetIntegrationFlowVersion(ctx context.Context, flowID string, version int) (*models.IntegrationFlowVersion, error) {
+	query := `
+        SELECT id, flow_id, version, flow_data, status, created_at, published_at
+        FROM integration_flow_versions
+        WHERE flow_id = $1 AND version = $2
+    `
+
+	var result models.IntegrationFlowVersion
+	err := r.db.QueryRowContext(ctx, query, flowID, version).Scan(&result.ID, &result.FlowID, &result.Version,
+		&result.FlowData, &result.Status, &result.CreatedAt, &result.PublishedAt)
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get flow version: %w", err)
+	}
+
+	return &result, nil
+}
+
+// PublishIntegrationFlowVersion makes the version the one the engine runs and
+// archives the previously published version
+func (r *Repository) PublishIntegrationFlowVersion(ctx context.Context, flowID string, version int) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := publishFlowVersion(ctx, tx, flowID, version); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit flow publish: %w", err)
+	}
+
+	return nil
+}
+
+// RollbackIntegrationFlow publishes an earlier version again. The working copy
+// is reset to its graph and an unpublished draft is discarded.
+func (r *Repository) RollbackIntegrationFlow(ctx context.Context, flowID string, version int) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `
+        DELETE FROM integration_flow_versions
+        WHERE flow_id = $1 AND status = $2 AND version <> $3
+    `, flowID, FlowVersionDraft, version); err != nil {
+		return fmt.Errorf("failed to discard flow draft: %w", err)
+	}
+
+	if err := publishFlowVersion(ctx, tx, flowID, version); err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+        UPDATE integration_flows
+        SET flow_data = (SELECT flow_data FROM integration_flow_versions WHERE flow_id = $1 AND version = $2),
+            updated_at = NOW()
+        WHERE id = $1
+    `, flowID, version); err != nil {
+		return fmt.Errorf("failed to reset flow working copy: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit flow rollback: %w", err)
+	}
+
+	return nil
+}
+
+func publishFlowVersion(ctx context.Context, tx *sql.Tx, flowID string, version int) error {
+	if _, err := tx.ExecContext(ctx, `
+        UPDATE integration_flow_versions
+        SET status = $2
+        WHERE flow_id = $1 AND status = $3
+    `, flowID, FlowVersionArchived, FlowVersionPublished); err != nil {
+		return fmt.Errorf("failed to archive published flow version: %w", err)
+	}
+
+	result, err := tx.ExecContext(ctx, `
+        UPDATE integration_flow_versions
+        SET status = $3, published_at = NOW()
+        WHERE flow_id = $1 AND version = $2
+    `, flowID, version, FlowVersionPublished)
+	if err != nil {
+		return fmt.Errorf("failed to publish flow version: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get affected rows: %w", err)
+	}
+	if affected == 0 {
+		return ErrNoFlowVersion
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+        UPDATE integration_flows
+        SET published_version = $2
+        WHERE id = $1
+    `, flowID, version); err != nil {
+		return fmt.Errorf("failed to set published flow version: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,57 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+)
+
+func (r *Repository) GetLeadSnapshot(ctx context.Context, leadID int64) (map[string]interface{}, error) {
+	query := `SELECT data FROM amocrm_lead_snapshots WHERE lead_id = $1`
+
+	var raw []byte
+	err := r.db.QueryRowContext(ctx, query, leadID).Scan(&raw)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get lead snapshot: %w", err)
+	}
+
+	var data map[string]interface{}
+	if err := json.Unmarshal(raw, &data); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal lead snapshot: %w", err)
+	}
+
+	return data, nil
+}
+
+func (r *Repository) SaveLeadSnapshot(ctx context.Context, leadID int64, data map[string]interface{}) error {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("failed to marshal lead snapshot: %w", err)
+	}
+
+	query := `
+        INSERT INTO amocrm_lead_snapshots (lead_id, data)
+        VALUES ($1, $2)
+        ON CONFLICT (lead_id) DO UPDATE SET data = EXCLUDED.data
+    `
+
+	if _, err := r.db.ExecContext(ctx, query, leadID, raw); err != nil {
+		return fmt.Errorf("failed to save lead snapshot: %w", err)
+	}
+
+	return nil
+}
+
+func (r *Repository) DeleteLeadSnapshot(ctx context.Context, leadID int64) error {
+	query := `DELETE FROM amocrm_lead_snapshots WHERE lead_id = $1`
+
+	if _, err := r.db.ExecContext(ctx, query, leadID); err != nil {
+		return fmt.Errorf("failed to delete lead snapshot: %w", err)
+	}
+
+	return nil
+}
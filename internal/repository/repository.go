@@ -6,7 +6,7 @@ import (
 	"fmt"
 	"time"
 
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 	"go.uber.org/zap"
 
 	"crm-dialer-integration/internal/models"
@@ -98,6 +98,104 @@ func (r *Repository) UpsertAmoCRMField(ctx context.Context, field *models.AmoCRM
 	return nil
 }
 
+// AmoCRM Pipelines
+func (r *Repository) GetAmoCRMPipelines(ctx context.Context) ([]*models.AmoCRMPipeline, error) {
+	query := `
+        SELECT id, name, sort, is_main, created_at, updated_at
+        FROM amocrm_pipelines
+        ORDER BY sort, name
+    `
+
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query pipelines: %w", err)
+	}
+	defer rows.Close()
+
+	var pipelines []*models.AmoCRMPipeline
+	byID := make(map[int64]*models.AmoCRMPipeline)
+	for rows.Next() {
+		var pipeline models.AmoCRMPipeline
+		if err := rows.Scan(&pipeline.ID, &pipeline.Name, &pipeline.Sort, &pipeline.IsMain, &pipeline.CreatedAt, &pipeline.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan pipeline: %w", err)
+		}
+		pipeline.Statuses = []*models.AmoCRMStatus{}
+		pipelines = append(pipelines, &pipeline)
+		byID[pipeline.ID] = &pipeline
+	}
+
+	statusQuery := `
+        SELECT id, pipeline_id, name, sort, created_at, updated_at
+        FROM amocrm_statuses
+        ORDER BY pipeline_id, sort
+    `
+
+	statusRows, err := r.db.QueryContext(ctx, statusQuery)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query statuses: %w", err)
+	}
+	defer statusRows.Close()
+
+	for statusRows.Next() {
+		var status models.AmoCRMStatus
+		if err := statusRows.Scan(&status.ID, &status.PipelineID, &status.Name, &status.Sort, &status.CreatedAt, &status.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan status: %w", err)
+		}
+		if pipeline, ok := byID[status.PipelineID]; ok {
+			pipeline.Statuses = append(pipeline.Statuses, &status)
+		}
+	}
+
+	return pipelines, nil
+}
+
+func (r *Repository) UpsertAmoCRMPipeline(ctx context.Context, pipeline *models.AmoCRMPipeline) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := `
+        INSERT INTO amocrm_pipelines (id, name, sort, is_main, created_at, updated_at)
+        VALUES ($1, $2, $3, $4, $5, $6)
+        ON CONFLICT (id) DO UPDATE SET
+            name = EXCLUDED.name,
+            sort = EXCLUDED.sort,
+            is_main = EXCLUDED.is_main,
+            updated_at = EXCLUDED.updated_at
+    `
+
+	if _, err := tx.ExecContext(ctx, query,
+		pipeline.ID, pipeline.Name, pipeline.Sort, pipeline.IsMain,
+		time.Now(), time.Now()); err != nil {
+		return fmt.Errorf("failed to upsert pipeline: %w", err)
+	}
+
+	statusQuery := `
+        INSERT INTO amocrm_statuses (id, pipeline_id, name, sort, created_at, updated_at)
+        VALUES ($1, $2, $3, $4, $5, $6)
+        ON CONFLICT (pipeline_id, id) DO UPDATE SET
+            name = EXCLUDED.name,
+            sort = EXCLUDED.sort,
+            updated_at = EXCLUDED.updated_at
+    `
+
+	for _, status := range pipeline.Statuses {
+		if _, err := tx.ExecContext(ctx, statusQuery,
+			status.ID, pipeline.ID, status.Name, status.Sort,
+			time.Now(), time.Now()); err != nil {
+			return fmt.Errorf("failed to upsert status: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit pipeline: %w", err)
+	}
+
+	return nil
+}
+
 // Dialer entities
 func (r *Repository) GetDialerSchedulers(ctx context.Context) ([]*models.DialerScheduler, error) {
 	query := `
@@ -234,13 +332,20 @@ func (r *Repository) UpsertDialerBucket(ctx context.Context, bucket *models.Dial
 }
 
 // Integration Flows
-func (r *Repository) GetIntegrationFlows(ctx context.Context) ([]*models.IntegrationFlow, error) {
-	query := `
-        SELECT id, name, flow_data, is_active, created_at, updated_at
-        FROM integration_flows
-        ORDER BY name
+const integrationFlowColumns = `
+        f.id, f.name, f.flow_data, f.is_active, f.priority, f.stop_processing, COALESCE(f.published_version, 0),
+        COALESCE((SELECT v.version FROM integration_flow_versions v
+                  WHERE v.flow_id = f.id AND v.status = 'draft'), 0),
+        f.created_at, f.updated_at
     `
 
+func (r *Repository) GetIntegrationFlows(ctx context.Context) ([]*models.IntegrationFlow, error) {
+	query := fmt.Sprintf(`
+        SELECT %s
+        FROM integration_flows f
+        ORDER BY f.priority, f.name
+    `, integrationFlowColumns)
+
 	rows, err := r.db.QueryContext(ctx, query)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query flows: %w", err)
@@ -250,7 +355,8 @@ func (r *Repository) GetIntegrationFlows(ctx context.Context) ([]*models.Integra
 	var flows []*models.IntegrationFlow
 	for rows.Next() {
 		var flow models.IntegrationFlow
-		if err := rows.Scan(&flow.ID, &flow.Name, &flow.FlowData, &flow.IsActive, &flow.CreatedAt, &flow.UpdatedAt); err != nil {
+		if err := rows.Scan(&flow.ID, &flow.Name, &flow.FlowData, &flow.IsActive, &flow.Priority, &flow.StopProcessing,
+			&flow.PublishedVersion, &flow.DraftVersion, &flow.CreatedAt, &flow.UpdatedAt); err != nil {
 			return nil, fmt.Errorf("failed to scan flow: %w", err)
 		}
 		flows = append(flows, &flow)
@@ -260,15 +366,16 @@ func (r *Repository) GetIntegrationFlows(ctx context.Context) ([]*models.Integra
 }
 
 func (r *Repository) GetIntegrationFlowByID(ctx context.Context, id string) (*models.IntegrationFlow, error) {
-	query := `
-        SELECT id, name, flow_data, is_active, created_at, updated_at
-        FROM integration_flows
-        WHERE id = $1
-    `
+	query := fmt.Sprintf(`
+        SELECT %s
+        FROM integration_flows f
+        WHERE f.id = $1
+    `, integrationFlowColumns)
 
 	var flow models.IntegrationFlow
 	err := r.db.QueryRowContext(ctx, query, id).Scan(
-		&flow.ID, &flow.Name, &flow.FlowData, &flow.IsActive, &flow.CreatedAt, &flow.UpdatedAt)
+		&flow.ID, &flow.Name, &flow.FlowData, &flow.IsActive, &flow.Priority, &flow.StopProcessing,
+		&flow.PublishedVersion, &flow.DraftVersion, &flow.CreatedAt, &flow.UpdatedAt)
 
 	if err == sql.ErrNoRows {
 		return nil, nil
@@ -280,36 +387,110 @@ func (r *Repository) GetIntegrationFlowByID(ctx context.Context, id string) (*mo
 	return &flow, nil
 }
 
+// CreateIntegrationFlow saves a new flow. Its graph becomes draft version 1,
+// the engine doesn't run it until the draft is published. A flow without a
+// priority is placed after all other flows.
 func (r *Repository) CreateIntegrationFlow(ctx context.Context, flow *models.IntegrationFlow) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
 	query := `
-        INSERT INTO integration_flows (id, name, flow_data, is_active, created_at, updated_at)
-        VALUES ($1, $2, $3, $4, $5, $6)
+        INSERT INTO integration_flows (id, name, flow_data, is_active, priority, stop_processing, created_at, updated_at)
+        VALUES ($1, $2, $3, $4,
+                COALESCE(NULLIF($5, 0), (SELECT COALESCE(MAX(priority), 0) + 10 FROM integration_flows)),
+                $6, $7, $8)
+        RETURNING priority
     `
 
-	_, err := r.db.ExecContext(ctx, query,
-		flow.ID, flow.Name, flow.FlowData, flow.IsActive, time.Now(), time.Now())
+	err = tx.QueryRowContext(ctx, query,
+		flow.ID, flow.Name, flow.FlowData, flow.IsActive, flow.Priority, flow.StopProcessing, time.Now(), time.Now(),
+	).Scan(&flow.Priority)
 
 	if err != nil {
 		return fmt.Errorf("failed to create flow: %w", err)
 	}
 
+	if err := saveFlowDraft(ctx, tx, flow.ID, flow.FlowData); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit flow: %w", err)
+	}
+
 	return nil
 }
 
+// UpdateIntegrationFlow saves the working copy of a flow and records a changed
+// graph as its draft version. The published version keeps running. A zero
+// priority keeps the current one.
 func (r *Repository) UpdateIntegrationFlow(ctx context.Context, flow *models.IntegrationFlow) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
 	query := `
         UPDATE integration_flows
-        SET name = $2, flow_data = $3, is_active = $4, updated_at = $5
+        SET name = $2, flow_data = $3, is_active = $4, priority = COALESCE(NULLIF($5, 0), priority),
+            stop_processing = $6, updated_at = $7
         WHERE id = $1
     `
 
-	_, err := r.db.ExecContext(ctx, query,
-		flow.ID, flow.Name, flow.FlowData, flow.IsActive, time.Now())
+	_, err = tx.ExecContext(ctx, query,
+		flow.ID, flow.Name, flow.FlowData, flow.IsActive, flow.Priority, flow.StopProcessing, time.Now())
 
 	if err != nil {
 		return fmt.Errorf("failed to update flow: %w", err)
 	}
 
+	if err := saveFlowDraft(ctx, tx, flow.ID, flow.FlowData); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit flow: %w", err)
+	}
+
+	return nil
+}
+
+// ReorderIntegrationFlows sets the priority of the listed flows by their
+// position. Flows not in the list run after them, in their previous order.
+func (r *Repository) ReorderIntegrationFlows(ctx context.Context, flowIDs []string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for i, id := range flowIDs {
+		if _, err := tx.ExecContext(ctx, `
+            UPDATE integration_flows SET priority = $2 WHERE id = $1
+        `, id, (i+1)*10); err != nil {
+			return fmt.Errorf("failed to set flow priority: %w", err)
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+        UPDATE integration_flows f
+        SET priority = $2 + o.position * 10
+        FROM (SELECT id, ROW_NUMBER() OVER (ORDER BY priority, name) AS position
+              FROM integration_flows
+              WHERE NOT (id = ANY($1))) o
+        WHERE f.id = o.id
+    `, pq.Array(flowIDs), len(flowIDs)*10); err != nil {
+		return fmt.Errorf("failed to set flow priority: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit flow order: %w", err)
+	}
+
 	return nil
 }
 
@@ -0,0 +1,71 @@
+package amocrm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+var apiClient = &http.Client{Timeout: 30 * time.Second}
+
+// errAPINotFound оборачивает ответ 404, чтобы вызывающий код мог отличить
+// отсутствующую сущность от ошибки запроса
+var errAPINotFound = errors.New("not found")
+
+// apiRequest выполняет запрос к REST API v4 AmoCRM напрямую, для методов,
+// которых нет в библиотеке. result может быть nil.
+func (s *Service) apiRequest(ctx context.Context, method, path string, body, result interface{}) error {
+	token := s.GetToken()
+	if token == nil || token.AccessToken() == "" {
+		return fmt.Errorf("no AmoCRM access token")
+	}
+
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to marshal request: %w", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	domain := strings.TrimSuffix(strings.TrimPrefix(s.config.AmoCRMDomain, "https://"), "/")
+	req, err := http.NewRequestWithContext(ctx, method, "https://"+domain+path, reader)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token.AccessToken())
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := apiClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if resp.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("AmoCRM API %s %s: %w", method, path, errAPINotFound)
+	}
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("AmoCRM API %s %s returned %d: %s", method, path, resp.StatusCode, string(data))
+	}
+
+	if result != nil && len(data) > 0 {
+		if err := json.Unmarshal(data, result); err != nil {
+			return fmt.Errorf("failed to unmarshal response: %w", err)
+		}
+	}
+
+	return nil
+}
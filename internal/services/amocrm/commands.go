@@ -0,0 +1,238 @@
+package amocrm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"crm-dialer-integration/internal/models"
+	"crm-dialer-integration/internal/services/queue"
+)
+
+const (
+	StepResultSucceeded = "succeeded"
+	StepResultFailed    = "failed"
+)
+
+// StepResultRecorder сохраняет результат команды, опубликованной шагом потока
+type StepResultRecorder interface {
+	CreateFlowStepResult(ctx context.Context, result *models.FlowStepResult) error
+}
+
+// NoteCommand - команда crm.add_note от Flow Engine
+type NoteCommand struct {
+	EntityType  string                 `json:"entity_type"`
+	EntityID    int                    `json:"entity_id"`
+	NoteType    string                 `json:"note_type"`
+	Params      map[string]interface{} `json:"params"`
+	ExecutionID string                 `json:"execution_id,omitempty"`
+	StepID      string                 `json:"step_id,omitempty"`
+}
+
+// TaskCommand - команда crm.create_task от Flow Engine
+type TaskCommand struct {
+	EntityType        string `json:"entity_type"`
+	EntityID          int    `json:"entity_id"`
+	TaskTypeID        int    `json:"task_type_id"`
+	Text              string `json:"text"`
+	CompleteTill      int64  `json:"complete_till"`
+	ResponsibleUserID int    `json:"responsible_user_id,omitempty"`
+	ExecutionID       string `json:"execution_id,omitempty"`
+	StepID            string `json:"step_id,omitempty"`
+}
+
+// CommandProcessor выполняет команды Flow Engine через очередь с ограничением
+// частоты запросов к AmoCRM и сохраняет результат для шага потока
+type CommandProcessor struct {
+	service *Service
+	queue   *queue.QueueService
+	results StepResultRecorder
+	logger  *zap.Logger
+}
+
+func NewCommandProcessor(service *Service, queueService *queue.QueueService, results StepResultRecorder, logger *zap.Logger) *CommandProcessor {
+	cp := &CommandProcessor{
+		service: service,
+		queue:   queueService,
+		results: results,
+		logger:  logger,
+	}
+
+	queueService.RegisterHandler("add_note", cp.processNotes)
+	queueService.RegisterHandler("create_task", cp.processTasks)
+
+	return cp
+}
+
+// HandleAddNote ставит команду crm.add_note в очередь
+func (cp *CommandProcessor) HandleAddNote(ctx context.Context, data []byte) error {
+	var cmd NoteCommand
+	if err := json.Unmarshal(data, &cmd); err != nil {
+		return fmt.Errorf("failed to unmarshal add_note command: %w", err)
+	}
+
+	if cmd.EntityType == "" {
+		cmd.EntityType = "leads"
+	}
+	if cmd.NoteType == "" {
+		cmd.NoteType = "common"
+	}
+
+	if cmd.EntityID == 0 {
+		err := fmt.Errorf("add_note command has no entity_id")
+		cp.recordResult(ctx, "crm.add_note", cmd.ExecutionID, cmd.StepID, err)
+		return err
+	}
+
+	cp.queue.Collect("add_note", &cmd)
+	return nil
+}
+
+// processNotes добавляет примечания батча, группируя их по типу сущности.
+// Если запрос батча не прошел, примечания отправляются по одному, чтобы
+// результат каждого шага отражал ошибку его собственного примечания.
+func (cp *CommandProcessor) processNotes(ctx context.Context, entities []interface{}) error {
+	byEntityType := make(map[string][]*NoteCommand)
+	for _, entity := range entities {
+		cmd, ok := entity.(*NoteCommand)
+		if !ok {
+			continue
+		}
+		byEntityType[cmd.EntityType] = append(byEntityType[cmd.EntityType], cmd)
+	}
+
+	var firstErr error
+	for entityType, commands := range byEntityType {
+		notes := make([]*Note, 0, len(commands))
+		for _, cmd := range commands {
+			notes = append(notes, &Note{
+				EntityID: cmd.EntityID,
+				NoteType: cmd.NoteType,
+				Params:   cmd.Params,
+			})
+		}
+
+		err := cp.service.AddNotes(ctx, entityType, notes)
+		if err != nil && len(commands) > 1 {
+			cp.logger.Warn("Notes batch failed, adding notes one by one",
+				zap.String("entity_type", entityType),
+				zap.Int("count", len(commands)),
+				zap.Error(err))
+
+			err = nil
+			for i, cmd := range commands {
+				noteErr := cp.service.AddNote(ctx, entityType, notes[i])
+				cp.recordResult(ctx, "crm.add_note", cmd.ExecutionID, cmd.StepID, noteErr)
+				if noteErr != nil && err == nil {
+					err = noteErr
+				}
+			}
+		} else {
+			for _, cmd := range commands {
+				cp.recordResult(ctx, "crm.add_note", cmd.ExecutionID, cmd.StepID, err)
+			}
+		}
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	return firstErr
+}
+
+// HandleCreateTask ставит команду crm.create_task в очередь
+func (cp *CommandProcessor) HandleCreateTask(ctx context.Context, data []byte) error {
+	var cmd TaskCommand
+	if err := json.Unmarshal(data, &cmd); err != nil {
+		return fmt.Errorf("failed to unmarshal create_task command: %w", err)
+	}
+
+	if cmd.EntityType == "" {
+		cmd.EntityType = "leads"
+	}
+	if cmd.TaskTypeID == 0 {
+		cmd.TaskTypeID = 1
+	}
+
+	if cmd.EntityID == 0 {
+		err := fmt.Errorf("create_task command has no entity_id")
+		cp.recordResult(ctx, "crm.create_task", cmd.ExecutionID, cmd.StepID, err)
+		return err
+	}
+
+	cp.queue.Collect("create_task", &cmd)
+	return nil
+}
+
+// processTasks создает задачи батча одним запросом. Если запрос батча не прошел,
+// задачи создаются по одной, чтобы результат каждого шага отражал ошибку его задачи.
+func (cp *CommandProcessor) processTasks(ctx context.Context, entities []interface{}) error {
+	commands := make([]*TaskCommand, 0, len(entities))
+	tasks := make([]*Task, 0, len(entities))
+	for _, entity := range entities {
+		cmd, ok := entity.(*TaskCommand)
+		if !ok {
+			continue
+		}
+		commands = append(commands, cmd)
+		tasks = append(tasks, &Task{
+			EntityID:          cmd.EntityID,
+			EntityType:        cmd.EntityType,
+			TaskTypeID:        cmd.TaskTypeID,
+			Text:              cmd.Text,
+			CompleteTill:      cmd.CompleteTill,
+			ResponsibleUserID: cmd.ResponsibleUserID,
+		})
+	}
+
+	err := cp.service.CreateTasks(ctx, tasks)
+	if err == nil || len(commands) < 2 {
+		for _, cmd := range commands {
+			cp.recordResult(ctx, "crm.create_task", cmd.ExecutionID, cmd.StepID, err)
+		}
+		return err
+	}
+
+	cp.logger.Warn("Tasks batch failed, creating tasks one by one",
+		zap.Int("count", len(commands)),
+		zap.Error(err))
+
+	var firstErr error
+	for i, cmd := range commands {
+		taskErr := cp.service.CreateTask(ctx, tasks[i])
+		cp.recordResult(ctx, "crm.create_task", cmd.ExecutionID, cmd.StepID, taskErr)
+		if taskErr != nil && firstErr == nil {
+			firstErr = taskErr
+		}
+	}
+
+	return firstErr
+}
+
+func (cp *CommandProcessor) recordResult(ctx context.Context, command, executionID, stepID string, cause error) {
+	if cp.results == nil || executionID == "" || stepID == "" {
+		return
+	}
+
+	result := &models.FlowStepResult{
+		ID:          uuid.New().String(),
+		ExecutionID: executionID,
+		StepID:      stepID,
+		Command:     command,
+		Status:      StepResultSucceeded,
+	}
+	if cause != nil {
+		result.Status = StepResultFailed
+		result.Error = cause.Error()
+	}
+
+	if err := cp.results.CreateFlowStepResult(ctx, result); err != nil {
+		cp.logger.Error("Failed to save flow step result",
+			zap.String("execution_id", executionID),
+			zap.String("step_id", stepID),
+			zap.Error(err))
+	}
+}
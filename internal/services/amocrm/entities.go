@@ -0,0 +1,222 @@
+package amocrm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+
+	"go.uber.org/zap"
+)
+
+// Связанные со сделкой сущности для узла enrich Flow Engine. Библиотека не
+// отдает связи сделки и компании, поэтому запросы идут в REST API напрямую.
+
+// ErrEntityNotFound возвращается, если контакт, компания или пользователь не существует
+var ErrEntityNotFound = errors.New("entity not found")
+
+// maxContactsPerRequest - максимальный limit списка контактов в API
+const maxContactsPerRequest = 250
+
+type apiCustomField struct {
+	FieldID   int    `json:"field_id"`
+	FieldName string `json:"field_name"`
+	FieldCode string `json:"field_code"`
+	Values    []struct {
+		Value interface{} `json:"value"`
+	} `json:"values"`
+}
+
+type apiEntity struct {
+	ID                 int              `json:"id"`
+	Name               string           `json:"name"`
+	FirstName          string           `json:"first_name"`
+	LastName           string           `json:"last_name"`
+	ResponsibleUserID  int              `json:"responsible_user_id"`
+	CustomFieldsValues []apiCustomField `json:"custom_fields_values"`
+}
+
+type apiLeadLinks struct {
+	Embedded struct {
+		Contacts []struct {
+			ID     int  `json:"id"`
+			IsMain bool `json:"is_main"`
+		} `json:"contacts"`
+		Companies []struct {
+			ID int `json:"id"`
+		} `json:"companies"`
+	} `json:"_embedded"`
+}
+
+// getLeadLinks загружает ID контактов и компании сделки
+func (s *Service) getLeadLinks(ctx context.Context, leadID int) (*apiLeadLinks, error) {
+	var links apiLeadLinks
+	err := s.apiRequest(ctx, "GET", fmt.Sprintf("/api/v4/leads/%d?with=contacts", leadID), nil, &links)
+	if errors.Is(err, errAPINotFound) {
+		return nil, ErrLeadNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get lead links: %w", err)
+	}
+	return &links, nil
+}
+
+// GetLeadContactsData возвращает все контакты сделки, основной контакт первым.
+// Контакты в том же формате, что и contact события lead.add, с признаком is_main.
+func (s *Service) GetLeadContactsData(ctx context.Context, leadID int) ([]map[string]interface{}, error) {
+	links, err := s.getLeadLinks(ctx, leadID)
+	if err != nil {
+		return nil, err
+	}
+
+	contacts := []map[string]interface{}{}
+	if len(links.Embedded.Contacts) == 0 {
+		return contacts, nil
+	}
+
+	values := url.Values{}
+	values.Set("limit", strconv.Itoa(maxContactsPerRequest))
+	isMain := make(map[int]bool, len(links.Embedded.Contacts))
+	for i, link := range links.Embedded.Contacts {
+		if i == maxContactsPerRequest {
+			break
+		}
+		values.Add("filter[id][]", strconv.Itoa(link.ID))
+		isMain[link.ID] = link.IsMain
+	}
+
+	var response struct {
+		Embedded struct {
+			Contacts []apiEntity `json:"contacts"`
+		} `json:"_embedded"`
+	}
+	if err := s.apiRequest(ctx, "GET", "/api/v4/contacts?"+values.Encode(), nil, &response); err != nil {
+		s.logger.Error("Failed to get lead contacts",
+			zap.Error(err),
+			zap.Int("lead_id", leadID))
+		return nil, fmt.Errorf("failed to get lead contacts: %w", err)
+	}
+
+	byID := make(map[int]apiEntity, len(response.Embedded.Contacts))
+	for _, contact := range response.Embedded.Contacts {
+		byID[contact.ID] = contact
+	}
+
+	// Порядок связей сделки сохраняется, основной контакт идет первым
+	for _, main := range []bool{true, false} {
+		for _, link := range links.Embedded.Contacts {
+			contact, ok := byID[link.ID]
+			if !ok || link.IsMain != main {
+				continue
+			}
+			data := entityData(contact)
+			data["first_name"] = contact.FirstName
+			data["last_name"] = contact.LastName
+			data["is_main"] = link.IsMain
+			contacts = append(contacts, data)
+		}
+	}
+
+	return contacts, nil
+}
+
+// GetLeadCompanyData возвращает компанию сделки, nil - если ее нет
+func (s *Service) GetLeadCompanyData(ctx context.Context, leadID int) (map[string]interface{}, error) {
+	links, err := s.getLeadLinks(ctx, leadID)
+	if err != nil {
+		return nil, err
+	}
+	if len(links.Embedded.Companies) == 0 {
+		return nil, nil
+	}
+
+	var company apiEntity
+	err = s.apiRequest(ctx, "GET", fmt.Sprintf("/api/v4/companies/%d", links.Embedded.Companies[0].ID), nil, &company)
+	if errors.Is(err, errAPINotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		s.logger.Error("Failed to get lead company",
+			zap.Error(err),
+			zap.Int("lead_id", leadID))
+		return nil, fmt.Errorf("failed to get company: %w", err)
+	}
+
+	return entityData(company), nil
+}
+
+// GetUserData возвращает пользователя AmoCRM: id, name и email
+func (s *Service) GetUserData(ctx context.Context, userID int) (map[string]interface{}, error) {
+	var user struct {
+		ID    int    `json:"id"`
+		Name  string `json:"name"`
+		Email string `json:"email"`
+	}
+	err := s.apiRequest(ctx, "GET", fmt.Sprintf("/api/v4/users/%d", userID), nil, &user)
+	if errors.Is(err, errAPINotFound) {
+		return nil, ErrEntityNotFound
+	}
+	if err != nil {
+		s.logger.Error("Failed to get user",
+			zap.Error(err),
+			zap.Int("user_id", userID))
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	return map[string]interface{}{
+		"id":    user.ID,
+		"name":  user.Name,
+		"email": user.Email,
+	}, nil
+}
+
+// entityData переводит контакт или компанию в формат событий: телефоны и email
+// из системных полей и custom_fields по ID, коду и имени, как у сделки
+func entityData(entity apiEntity) map[string]interface{} {
+	fields := make(map[string]interface{})
+	phones := []interface{}{}
+	emails := []interface{}{}
+
+	for _, field := range entity.CustomFieldsValues {
+		if len(field.Values) == 0 {
+			continue
+		}
+		value := field.Values[0].Value
+
+		fields[fmt.Sprintf("field_%d", field.FieldID)] = value
+		if field.FieldCode != "" {
+			fields[field.FieldCode] = value
+		}
+		if field.FieldName != "" {
+			fields[field.FieldName] = value
+		}
+
+		for _, item := range field.Values {
+			switch field.FieldCode {
+			case "PHONE":
+				phones = append(phones, item.Value)
+			case "EMAIL":
+				emails = append(emails, item.Value)
+			}
+		}
+	}
+
+	data := map[string]interface{}{
+		"id":                  entity.ID,
+		"name":                entity.Name,
+		"responsible_user_id": entity.ResponsibleUserID,
+		"phone":               "",
+		"phones":              phones,
+		"email":               "",
+		"emails":              emails,
+		"custom_fields":       fields,
+	}
+	if len(phones) > 0 {
+		data["phone"] = phones[0]
+	}
+	if len(emails) > 0 {
+		data["email"] = emails[0]
+	}
+	return data
+}
@@ -3,6 +3,7 @@ package amocrm
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/url"
@@ -27,6 +28,9 @@ type Service struct {
 	tokenManager *TokenManager
 }
 
+// ErrLeadNotFound возвращается, если сделка удалена или не существует
+var ErrLeadNotFound = errors.New("lead not found")
+
 // TokenStored структура для хранения токенов
 type TokenStored struct {
 	AccessToken  string    `json:"access_token"`
@@ -310,13 +314,32 @@ func (s *Service) GetLeadByID(ctx context.Context, leadID int) (*amocrm.Lead, er
 		return nil, fmt.Errorf("failed to get lead: %w", err)
 	}
 
-	if statusCode == 404 {
-		return nil, fmt.Errorf("lead not found")
+	if statusCode == 404 || statusCode == 204 || lead == nil {
+		return nil, ErrLeadNotFound
 	}
 
 	return lead, nil
 }
 
+// GetLeadData возвращает сделку в том же формате, что и события вебхуков
+func (s *Service) GetLeadData(ctx context.Context, leadID int) (map[string]interface{}, error) {
+	lead, err := s.GetLeadByID(ctx, leadID)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		"lead_id":             lead.ID,
+		"lead_name":           lead.Name,
+		"status_id":           lead.StatusID,
+		"pipeline_id":         lead.PipelineID,
+		"price":               lead.Price,
+		"responsible_user_id": lead.ResponsibleUserID,
+		"updated_at":          lead.UpdatedAt,
+		"custom_fields":       extractLeadCustomFields(lead),
+	}, nil
+}
+
 // UpdateLeads обновляет сделки
 func (s *Service) UpdateLeads(ctx context.Context, leads []*amocrm.Lead) error {
 	// Батчинг до 200 сущностей как указано в требованиях
@@ -429,60 +452,97 @@ func (s *Service) GetCustomFields(ctx context.Context, entityType string) ([]*mo
 	return []*models.AmoCRMField{}, nil
 }
 
-// AddNote добавляет примечание к сущности
-func (s *Service) AddNote(ctx context.Context, entityType string, entityID int, text string) error {
-	note := &amocrm.Notes{
-		EntityID: entityID,
-		NoteType: "common", // Обычное примечание
-		Params: &amocrm.NotesParams{
-			Text: text,
-		},
-		CreatedAt: int(time.Now().Unix()),
-		UpdatedAt: int(time.Now().Unix()),
-	}
-
-	switch entityType {
-	case "leads":
-		// Для сделок
-		notes, err, statusCode := s.client.Leads().AddNotes([]*amocrm.Notes{note})
-		if err != nil {
-			s.logger.Error("Failed to add note to lead",
-				zap.Error(err),
-				zap.Int("entity_id", entityID),
-				zap.Int("status_code", statusCode))
-			return fmt.Errorf("failed to add note: %w", err)
-		}
+// Note описывает примечание для /api/v4/{entity_type}/notes.
+// Params зависят от типа: common - text; service_message - service, text;
+// call_in/call_out - uniq, duration, source, link, phone.
+type Note struct {
+	EntityID int                    `json:"entity_id"`
+	NoteType string                 `json:"note_type"`
+	Params   map[string]interface{} `json:"params"`
+}
 
-		if len(notes) > 0 {
-			s.logger.Info("Note added successfully to lead",
-				zap.Int("note_id", notes[0].ID),
-				zap.Int("entity_id", entityID))
-		}
+// NoteTypes - поддерживаемые типы примечаний
+var NoteTypes = map[string]bool{
+	"common":          true,
+	"service_message": true,
+	"call_in":         true,
+	"call_out":        true,
+}
 
-	case "contacts":
-		// Для контактов
-		notes, err, statusCode := s.client.Contacts().AddNotes([]*amocrm.Notes{note})
-		if err != nil {
-			s.logger.Error("Failed to add note to contact",
-				zap.Error(err),
-				zap.Int("entity_id", entityID),
-				zap.Int("status_code", statusCode))
-			return fmt.Errorf("failed to add note: %w", err)
+// AddNotes добавляет примечания любого поддерживаемого типа одним запросом
+func (s *Service) AddNotes(ctx context.Context, entityType string, notes []*Note) error {
+	if entityType != "leads" && entityType != "contacts" {
+		return fmt.Errorf("unsupported entity type: %s", entityType)
+	}
+
+	for _, note := range notes {
+		if !NoteTypes[note.NoteType] {
+			return fmt.Errorf("unsupported note type: %s", note.NoteType)
 		}
+	}
 
-		if len(notes) > 0 {
-			s.logger.Info("Note added successfully to contact",
-				zap.Int("note_id", notes[0].ID),
-				zap.Int("entity_id", entityID))
+	if err := s.apiRequest(ctx, "POST", "/api/v4/"+entityType+"/notes", notes, nil); err != nil {
+		s.logger.Error("Failed to add notes",
+			zap.Error(err),
+			zap.String("entity_type", entityType),
+			zap.Int("count", len(notes)))
+		return fmt.Errorf("failed to add notes: %w", err)
+	}
+
+	s.logger.Info("Notes added successfully",
+		zap.String("entity_type", entityType),
+		zap.Int("count", len(notes)))
+
+	return nil
+}
+
+// AddNote добавляет одно примечание к сущности
+func (s *Service) AddNote(ctx context.Context, entityType string, note *Note) error {
+	return s.AddNotes(ctx, entityType, []*Note{note})
+}
+
+// Task описывает задачу для /api/v4/tasks. CompleteTill - unix timestamp срока выполнения.
+type Task struct {
+	EntityID          int    `json:"entity_id,omitempty"`
+	EntityType        string `json:"entity_type,omitempty"`
+	TaskTypeID        int    `json:"task_type_id"`
+	Text              string `json:"text"`
+	CompleteTill      int64  `json:"complete_till"`
+	ResponsibleUserID int    `json:"responsible_user_id,omitempty"`
+}
+
+// CreateTasks создает задачи одним запросом
+func (s *Service) CreateTasks(ctx context.Context, tasks []*Task) error {
+	if len(tasks) == 0 {
+		return nil
+	}
+
+	for _, task := range tasks {
+		if task.Text == "" {
+			return fmt.Errorf("task text is empty")
 		}
+		if task.CompleteTill == 0 {
+			return fmt.Errorf("task has no complete_till")
+		}
+	}
 
-	default:
-		return fmt.Errorf("unsupported entity type: %s", entityType)
+	if err := s.apiRequest(ctx, "POST", "/api/v4/tasks", tasks, nil); err != nil {
+		s.logger.Error("Failed to create tasks",
+			zap.Error(err),
+			zap.Int("count", len(tasks)))
+		return fmt.Errorf("failed to create tasks: %w", err)
 	}
 
+	s.logger.Info("Tasks created successfully", zap.Int("count", len(tasks)))
+
 	return nil
 }
 
+// CreateTask создает одну задачу
+func (s *Service) CreateTask(ctx context.Context, task *Task) error {
+	return s.CreateTasks(ctx, []*Task{task})
+}
+
 // GetPipelines получает список воронок со статусами
 func (s *Service) GetPipelines(ctx context.Context) ([]map[string]interface{}, error) {
 	// Начинаем формировать структуру для запроса массива воронок и этапов
@@ -13,9 +13,28 @@ import (
 )
 
 type WebhookProcessor struct {
-	service *Service
-	logger  *zap.Logger
-	nc      *nats.Conn
+	service   *Service
+	logger    *zap.Logger
+	nc        *nats.Conn
+	snapshots LeadSnapshotStore
+}
+
+// LeadSnapshotStore хранит последнее известное состояние сделок,
+// чтобы передавать предыдущие значения полей в Flow Engine
+type LeadSnapshotStore interface {
+	GetLeadSnapshot(ctx context.Context, leadID int64) (map[string]interface{}, error)
+	SaveLeadSnapshot(ctx context.Context, leadID int64, data map[string]interface{}) error
+	DeleteLeadSnapshot(ctx context.Context, leadID int64) error
+}
+
+// snapshotFields - поля события, предыдущие значения которых попадают в "previous"
+var snapshotFields = []string{
+	"lead_name",
+	"status_id",
+	"pipeline_id",
+	"price",
+	"responsible_user_id",
+	"custom_fields",
 }
 
 func NewWebhookProcessor(service *Service, logger *zap.Logger) *WebhookProcessor {
@@ -39,6 +58,11 @@ func (wp *WebhookProcessor) SetNATSConnection(nc *nats.Conn) {
 	wp.nc = nc
 }
 
+// SetSnapshotStore устанавливает хранилище состояний сделок
+func (wp *WebhookProcessor) SetSnapshotStore(store LeadSnapshotStore) {
+	wp.snapshots = store
+}
+
 // ProcessLeadWebhook обрабатывает вебхук сделки
 func (wp *WebhookProcessor) ProcessLeadWebhook(ctx context.Context, eventType string, data map[string]interface{}) error {
 	wp.logger.Info("Processing lead webhook",
@@ -48,12 +72,14 @@ func (wp *WebhookProcessor) ProcessLeadWebhook(ctx context.Context, eventType st
 	// Извлекаем ID сделки из данных вебхука
 	// Структура вебхука может отличаться в зависимости от события
 	var leadID int
+	var webhookLead map[string]interface{}
 
 	// Пробуем разные варианты структуры данных
 	if leads, ok := data["leads"].(map[string]interface{}); ok {
 		// Формат: {"leads": {"add": [{"id": 123, ...}]}}
 		if eventLeads, ok := leads[eventType].([]interface{}); ok && len(eventLeads) > 0 {
 			if lead, ok := eventLeads[0].(map[string]interface{}); ok {
+				webhookLead = lead
 				if id, ok := lead["id"].(float64); ok {
 					leadID = int(id)
 				}
@@ -61,6 +87,7 @@ func (wp *WebhookProcessor) ProcessLeadWebhook(ctx context.Context, eventType st
 		}
 	} else if id, ok := data["id"].(float64); ok {
 		// Простой формат: {"id": 123, ...}
+		webhookLead = data
 		leadID = int(id)
 	}
 
@@ -68,6 +95,9 @@ func (wp *WebhookProcessor) ProcessLeadWebhook(ctx context.Context, eventType st
 		return fmt.Errorf("lead ID not found in webhook data")
 	}
 
+	// AmoCRM присылает часть старых значений в самом вебхуке (old_status_id и т.п.)
+	oldValues := extractOldValues(webhookLead)
+
 	// Получаем полные данные сделки
 	lead, err := wp.service.GetLeadByID(ctx, leadID)
 	if err != nil {
@@ -79,13 +109,13 @@ func (wp *WebhookProcessor) ProcessLeadWebhook(ctx context.Context, eventType st
 	case "add":
 		return wp.handleLeadAdd(ctx, lead)
 	case "update":
-		return wp.handleLeadUpdate(ctx, lead)
+		return wp.handleLeadUpdate(ctx, lead, oldValues)
 	case "delete":
 		return wp.handleLeadDelete(ctx, leadID)
 	case "status":
-		return wp.handleLeadStatusChange(ctx, lead)
+		return wp.handleLeadStatusChange(ctx, lead, oldValues)
 	case "responsible":
-		return wp.handleLeadResponsibleChange(ctx, lead)
+		return wp.handleLeadResponsibleChange(ctx, lead, oldValues)
 	default:
 		wp.logger.Warn("Unknown webhook event type",
 			zap.String("event_type", eventType))
@@ -193,6 +223,8 @@ func (wp *WebhookProcessor) handleLeadAdd(ctx context.Context, lead *amocrm.Lead
 		eventData["contact"] = contactData
 	}
 
+	wp.attachPrevious(ctx, eventData, nil)
+
 	// Публикуем событие для обработки Flow Engine
 	if err := wp.PublishEvent(ctx, eventData); err != nil {
 		wp.logger.Error("Failed to publish event", zap.Error(err))
@@ -202,7 +234,7 @@ func (wp *WebhookProcessor) handleLeadAdd(ctx context.Context, lead *amocrm.Lead
 	return nil
 }
 
-func (wp *WebhookProcessor) handleLeadUpdate(ctx context.Context, lead *amocrm.Lead) error {
+func (wp *WebhookProcessor) handleLeadUpdate(ctx context.Context, lead *amocrm.Lead, oldValues map[string]interface{}) error {
 	wp.logger.Info("Lead updated",
 		zap.Int("lead_id", lead.ID),
 		zap.String("name", lead.Name))
@@ -220,6 +252,8 @@ func (wp *WebhookProcessor) handleLeadUpdate(ctx context.Context, lead *amocrm.L
 		"custom_fields":       wp.extractCustomFields(lead),
 	}
 
+	wp.attachPrevious(ctx, eventData, oldValues)
+
 	// Публикуем событие для обработки Flow Engine
 	if err := wp.PublishEvent(ctx, eventData); err != nil {
 		wp.logger.Error("Failed to publish event", zap.Error(err))
@@ -240,6 +274,14 @@ func (wp *WebhookProcessor) handleLeadDelete(ctx context.Context, leadID int) er
 		"deleted_at": time.Now().Unix(),
 	}
 
+	if wp.snapshots != nil {
+		if err := wp.snapshots.DeleteLeadSnapshot(ctx, int64(leadID)); err != nil {
+			wp.logger.Error("Failed to delete lead snapshot",
+				zap.Int("lead_id", leadID),
+				zap.Error(err))
+		}
+	}
+
 	// Публикуем событие для обработки Flow Engine
 	if err := wp.PublishEvent(ctx, eventData); err != nil {
 		wp.logger.Error("Failed to publish event", zap.Error(err))
@@ -249,7 +291,7 @@ func (wp *WebhookProcessor) handleLeadDelete(ctx context.Context, leadID int) er
 	return nil
 }
 
-func (wp *WebhookProcessor) handleLeadStatusChange(ctx context.Context, lead *amocrm.Lead) error {
+func (wp *WebhookProcessor) handleLeadStatusChange(ctx context.Context, lead *amocrm.Lead, oldValues map[string]interface{}) error {
 	wp.logger.Info("Lead status changed",
 		zap.Int("lead_id", lead.ID),
 		zap.Int("status_id", lead.StatusID),
@@ -284,6 +326,8 @@ func (wp *WebhookProcessor) handleLeadStatusChange(ctx context.Context, lead *am
 		eventData["contact_ids"] = contactIDs
 	}
 
+	wp.attachPrevious(ctx, eventData, oldValues)
+
 	// Публикуем событие для обработки Flow Engine
 	if err := wp.PublishEvent(ctx, eventData); err != nil {
 		wp.logger.Error("Failed to publish event", zap.Error(err))
@@ -293,7 +337,7 @@ func (wp *WebhookProcessor) handleLeadStatusChange(ctx context.Context, lead *am
 	return nil
 }
 
-func (wp *WebhookProcessor) handleLeadResponsibleChange(ctx context.Context, lead *amocrm.Lead) error {
+func (wp *WebhookProcessor) handleLeadResponsibleChange(ctx context.Context, lead *amocrm.Lead, oldValues map[string]interface{}) error {
 	wp.logger.Info("Lead responsible changed",
 		zap.Int("lead_id", lead.ID),
 		zap.Int("responsible_user_id", lead.ResponsibleUserID))
@@ -310,6 +354,8 @@ func (wp *WebhookProcessor) handleLeadResponsibleChange(ctx context.Context, lea
 		"custom_fields":       wp.extractCustomFields(lead),
 	}
 
+	wp.attachPrevious(ctx, eventData, oldValues)
+
 	// Публикуем событие для обработки Flow Engine
 	if err := wp.PublishEvent(ctx, eventData); err != nil {
 		wp.logger.Error("Failed to publish event", zap.Error(err))
@@ -319,8 +365,70 @@ func (wp *WebhookProcessor) handleLeadResponsibleChange(ctx context.Context, lea
 	return nil
 }
 
+// attachPrevious добавляет в событие "previous" с предыдущими значениями полей
+// сделки и сохраняет текущие значения как новый снимок. Значения old_* из
+// вебхука имеют приоритет над сохраненным снимком.
+func (wp *WebhookProcessor) attachPrevious(ctx context.Context, eventData map[string]interface{}, oldValues map[string]interface{}) {
+	leadID, _ := eventData["lead_id"].(int)
+	previous := make(map[string]interface{})
+
+	if wp.snapshots != nil {
+		snapshot, err := wp.snapshots.GetLeadSnapshot(ctx, int64(leadID))
+		if err != nil {
+			wp.logger.Error("Failed to get lead snapshot",
+				zap.Int("lead_id", leadID),
+				zap.Error(err))
+		}
+		for key, value := range snapshot {
+			previous[key] = value
+		}
+	}
+	for key, value := range oldValues {
+		previous[key] = value
+	}
+
+	if len(previous) > 0 {
+		eventData["previous"] = previous
+	}
+
+	if wp.snapshots == nil {
+		return
+	}
+
+	// Обновляем снимок только теми полями, которые есть в событии
+	snapshot := make(map[string]interface{}, len(snapshotFields))
+	for key, value := range previous {
+		snapshot[key] = value
+	}
+	for _, key := range snapshotFields {
+		if value, ok := eventData[key]; ok {
+			snapshot[key] = value
+		}
+	}
+	if err := wp.snapshots.SaveLeadSnapshot(ctx, int64(leadID), snapshot); err != nil {
+		wp.logger.Error("Failed to save lead snapshot",
+			zap.Int("lead_id", leadID),
+			zap.Error(err))
+	}
+}
+
+// extractOldValues извлекает поля old_* из данных сделки вебхука
+func extractOldValues(webhookLead map[string]interface{}) map[string]interface{} {
+	oldValues := make(map[string]interface{})
+	for key, value := range webhookLead {
+		if field := strings.TrimPrefix(key, "old_"); field != key && field != "" {
+			oldValues[field] = value
+		}
+	}
+	return oldValues
+}
+
 // extractCustomFields извлекает кастомные поля в удобном формате
 func (wp *WebhookProcessor) extractCustomFields(lead *amocrm.Lead) map[string]interface{} {
+	return extractLeadCustomFields(lead)
+}
+
+func extractLeadCustomFields(lead *amocrm.Lead) map[string]interface{} {
 	fields := make(map[string]interface{})
 
 	if lead.CustomFieldsValues != nil {
@@ -0,0 +1,183 @@
+package flowengine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// Узлы start, action, delay и subflow продолжаются по всем исходящим ребрам (ребра
+// error - только после ошибки действия, см. failure.go). Несколько
+// ребер - это параллельные ветки: каждая получает свою копию данных запуска,
+// а шаги трассировки помечаются веткой ("e1", вложенные - "e1/e4").
+
+// BranchResult is the outcome of one branch of a fan-out
+type BranchResult struct {
+	Branch  string `json:"branch"`
+	EdgeID  string `json:"edge_id,omitempty"`
+	Target  string `json:"target"`
+	Outcome string `json:"outcome"`
+	Error   string `json:"error,omitempty"`
+}
+
+type branchKey struct{}
+
+func withBranch(ctx context.Context, branch string) context.Context {
+	return context.WithValue(ctx, branchKey{}, branch)
+}
+
+func branchFromContext(ctx context.Context) string {
+	branch, _ := ctx.Value(branchKey{}).(string)
+	return branch
+}
+
+// SetMaxParallelBranches sets how many branches may run concurrently across
+// all runs of the engine. 1 or less runs branches one after another.
+func (fe *FlowEngine) SetMaxParallelBranches(n int) {
+	if n <= 1 {
+		fe.branchSlots = nil
+		return
+	}
+	fe.branchSlots = make(chan struct{}, n)
+}
+
+func outgoingEdges(nodeID string, config *FlowConfig) []FlowEdge {
+	var edges []FlowEdge
+	if config.edgesBySource != nil {
+		for _, i := range config.edgesBySource[nodeID] {
+			edges = append(edges, config.Edges[i])
+		}
+		return edges
+	}
+
+	for _, edge := range config.Edges {
+		if edge.Source == nodeID {
+			edges = append(edges, edge)
+		}
+	}
+	return edges
+}
+
+// followEdges продолжает выполнение по всем исходящим ребрам узла, кроме ребер error
+func (fe *FlowEngine) followEdges(ctx context.Context, step *ExecutionStep, node *FlowNode, config *FlowConfig, data map[string]interface{}) (bool, error) {
+	return fe.fanOut(ctx, step, node, config, regularEdges(outgoingEdges(node.ID, config)), data)
+}
+
+// fanOut выполняет ребра как параллельные ветки
+func (fe *FlowEngine) fanOut(ctx context.Context, step *ExecutionStep, node *FlowNode, config *FlowConfig, edges []FlowEdge, data map[string]interface{}) (bool, error) {
+	switch len(edges) {
+	case 0:
+		return true, nil
+	case 1:
+		nextNode := fe.findNodeByID(edges[0].Target, config)
+		if nextNode == nil {
+			return false, fmt.Errorf("node not found: %s", edges[0].Target)
+		}
+		return fe.executeNode(ctx, nextNode, config, data)
+	}
+
+	results := make([]BranchResult, len(edges))
+	matched := make([]bool, len(edges))
+	errs := make([]error, len(edges))
+
+	parent := branchFromContext(ctx)
+	sequential, _ := node.Data["sequential"].(bool)
+
+	var wg sync.WaitGroup
+	for i, edge := range edges {
+		label := edge.ID
+		if label == "" {
+			label = edge.Target
+		}
+		if parent != "" {
+			label = parent + "/" + label
+		}
+		results[i] = BranchResult{Branch: label, EdgeID: edge.ID, Target: edge.Target}
+
+		run := func(i int, edge FlowEdge, branchCtx context.Context) {
+			nextNode := fe.findNodeByID(edge.Target, config)
+			if nextNode == nil {
+				errs[i] = fmt.Errorf("node not found: %s", edge.Target)
+				return
+			}
+			matched[i], errs[i] = fe.executeNode(branchCtx, nextNode, config, copyData(data))
+		}
+		branchCtx := withBranch(ctx, label)
+
+		// Свободный слот пула - ветка уходит в горутину, иначе выполняется здесь же.
+		// Так вложенные ветки не ждут слоты, занятые их же родителями.
+		if !sequential && fe.acquireBranchSlot() {
+			wg.Add(1)
+			go func(i int, edge FlowEdge) {
+				defer wg.Done()
+				defer fe.releaseBranchSlot()
+				run(i, edge, branchCtx)
+			}(i, edge)
+			continue
+		}
+		run(i, edge, branchCtx)
+	}
+	wg.Wait()
+
+	anyMatched := false
+	for i := range results {
+		switch {
+		case errs[i] != nil:
+			results[i].Outcome = OutcomeFailed
+			results[i].Error = errs[i].Error()
+		case matched[i]:
+			results[i].Outcome = OutcomeCompleted
+			anyMatched = true
+		default:
+			results[i].Outcome = OutcomeNoMatch
+		}
+	}
+	step.setDetail("branches", results)
+
+	// Ветки независимы: ошибка одной не отменяет остальные, но проваливает запуск
+	if err := errors.Join(errs...); err != nil {
+		return false, err
+	}
+	return anyMatched, nil
+}
+
+func (fe *FlowEngine) acquireBranchSlot() bool {
+	if fe.branchSlots == nil {
+		return false
+	}
+	select {
+	case fe.branchSlots <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+func (fe *FlowEngine) releaseBranchSlot() {
+	<-fe.branchSlots
+}
+
+// copyData копирует данные запуска для ветки, включая вложенные карты и списки
+func copyData(data map[string]interface{}) map[string]interface{} {
+	return copyValue(data).(map[string]interface{})
+}
+
+func copyValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			result[key] = copyValue(item)
+		}
+		return result
+	case []interface{}:
+		result := make([]interface{}, len(v))
+		for i, item := range v {
+			result[i] = copyValue(item)
+		}
+		return result
+	default:
+		return value
+	}
+}
@@ -0,0 +1,262 @@
+package flowengine
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"crm-dialer-integration/internal/models"
+	"crm-dialer-integration/internal/repository"
+)
+
+// FlowsChangedSubject is published by the gateway after a flow is changed,
+// published, rolled back or deleted
+const FlowsChangedSubject = "flows.changed"
+
+// FlowsChanged is the payload of FlowsChangedSubject. An empty FlowID asks
+// for a full reload.
+type FlowsChanged struct {
+	FlowID string `json:"flow_id,omitempty"`
+	Action string `json:"action,omitempty"`
+}
+
+// compiledFlow - опубликованная версия потока, разобранная один раз:
+// граф с индексами узлов и ребер, триггер и настройки дедупликации стартового узла
+type compiledFlow struct {
+	flow    *models.IntegrationFlow
+	config  *FlowConfig
+	trigger *Trigger
+	dedup   *dedupSettings
+
+	// canStop - поток может остановить обработку события следующими потоками
+	canStop bool
+}
+
+func compileFlow(flow *models.IntegrationFlow) (*compiledFlow, error) {
+	config, err := parseFlowConfig(flow.FlowData)
+	if err != nil {
+		return nil, err
+	}
+
+	trigger, err := parseTrigger(config)
+	if err != nil {
+		return nil, err
+	}
+
+	dedup, err := parseDedup(config)
+	if err != nil {
+		return nil, err
+	}
+
+	canStop := flow.StopProcessing
+	for _, node := range config.Nodes {
+		if stop, _ := node.Data["stop_processing"].(bool); stop && node.Type == "end" {
+			canStop = true
+		}
+	}
+
+	return &compiledFlow{flow: flow, config: config, trigger: trigger, dedup: dedup, canStop: canStop}, nil
+}
+
+// compileFlows разбирает потоки, пропуская те, что не удалось разобрать
+func compileFlows(logger *zap.Logger, flows []*models.IntegrationFlow) []*compiledFlow {
+	compiled := make([]*compiledFlow, 0, len(flows))
+	for _, flow := range flows {
+		c, err := compileFlow(flow)
+		if err != nil {
+			logger.Error("Failed to compile flow, skipping",
+				zap.String("flow_id", flow.ID),
+				zap.Error(err))
+			continue
+		}
+		compiled = append(compiled, c)
+	}
+	return compiled
+}
+
+// FlowCache holds the compiled published versions of all flows. It is
+// refreshed per flow on FlowsChangedSubject and fully reloaded periodically.
+type FlowCache struct {
+	repo   *repository.Repository
+	logger *zap.Logger
+
+	// loadMu не дает полной перезагрузке затереть более свежее обновление одного потока
+	loadMu sync.Mutex
+
+	mu    sync.RWMutex
+	flows map[string]*compiledFlow
+	index *triggerIndex
+}
+
+func NewFlowCache(repo *repository.Repository, logger *zap.Logger) *FlowCache {
+	return &FlowCache{
+		repo:   repo,
+		logger: logger,
+		flows:  make(map[string]*compiledFlow),
+		index:  newTriggerIndex(nil),
+	}
+}
+
+// Load replaces the cache with the published versions from the database
+func (c *FlowCache) Load(ctx context.Context) error {
+	c.loadMu.Lock()
+	defer c.loadMu.Unlock()
+
+	flows, err := c.repo.GetPublishedIntegrationFlows(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to load flows: %w", err)
+	}
+
+	compiled := make(map[string]*compiledFlow, len(flows))
+	for _, flow := range compileFlows(c.logger, flows) {
+		compiled[flow.flow.ID] = flow
+	}
+
+	c.mu.Lock()
+	c.flows = compiled
+	c.rebuildIndexLocked()
+	c.mu.Unlock()
+
+	c.logger.Info("Flow cache loaded", zap.Int("flows", len(compiled)))
+	return nil
+}
+
+// Refresh reloads one flow, removing it when it was deleted or unpublished
+func (c *FlowCache) Refresh(ctx context.Context, flowID string) error {
+	c.loadMu.Lock()
+	defer c.loadMu.Unlock()
+
+	flow, err := c.repo.GetPublishedIntegrationFlow(ctx, flowID)
+	if err != nil {
+		return fmt.Errorf("failed to load flow: %w", err)
+	}
+
+	var compiled *compiledFlow
+	if flow != nil {
+		if compiled, err = compileFlow(flow); err != nil {
+			// Старая версия остается в кеше до исправления потока
+			return fmt.Errorf("failed to compile flow %s: %w", flowID, err)
+		}
+	}
+
+	c.mu.Lock()
+	if compiled != nil {
+		c.flows[flowID] = compiled
+	} else {
+		delete(c.flows, flowID)
+	}
+	c.rebuildIndexLocked()
+	c.mu.Unlock()
+
+	c.logger.Info("Flow cache refreshed",
+		zap.String("flow_id", flowID),
+		zap.Bool("published", compiled != nil))
+	return nil
+}
+
+// HandleChange applies a FlowsChangedSubject message
+func (c *FlowCache) HandleChange(ctx context.Context, payload []byte) error {
+	var change FlowsChanged
+	if len(payload) > 0 {
+		if err := json.Unmarshal(payload, &change); err != nil {
+			return fmt.Errorf("failed to unmarshal flow change: %w", err)
+		}
+	}
+
+	if change.FlowID == "" {
+		return c.Load(ctx)
+	}
+	return c.Refresh(ctx, change.FlowID)
+}
+
+// Run reloads the cache every interval until the context is cancelled. It
+// is a safety net for missed change notifications.
+func (c *FlowCache) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if err := c.Load(ctx); err != nil {
+			c.logger.Error("Failed to reload flow cache", zap.Error(err))
+		}
+	}
+}
+
+// rebuildIndexLocked пересобирает индекс триггеров в порядке приоритета потоков
+func (c *FlowCache) rebuildIndexLocked() {
+	flows := make([]*compiledFlow, 0, len(c.flows))
+	for _, flow := range c.flows {
+		flows = append(flows, flow)
+	}
+	sort.Slice(flows, func(i, j int) bool {
+		if flows[i].flow.Priority != flows[j].flow.Priority {
+			return flows[i].flow.Priority < flows[j].flow.Priority
+		}
+		if flows[i].flow.Name != flows[j].flow.Name {
+			return flows[i].flow.Name < flows[j].flow.Name
+		}
+		return flows[i].flow.ID < flows[j].flow.ID
+	})
+
+	c.index = newTriggerIndex(flows)
+}
+
+func (c *FlowCache) triggers() *triggerIndex {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.index
+}
+
+func (c *FlowCache) get(flowID string) *compiledFlow {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.flows[flowID]
+}
+
+// SetFlowCache makes the engine read published flows from the cache instead
+// of querying the database for every event
+func (fe *FlowEngine) SetFlowCache(cache *FlowCache) {
+	fe.cache = cache
+}
+
+// activeTriggers возвращает индекс триггеров активных потоков: из кеша или из базы
+func (fe *FlowEngine) activeTriggers(ctx context.Context) (*triggerIndex, error) {
+	if fe.cache != nil {
+		return fe.cache.triggers(), nil
+	}
+
+	flows, err := fe.repo.GetPublishedIntegrationFlows(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get flows: %w", err)
+	}
+	return newTriggerIndex(compileFlows(fe.logger, flows)), nil
+}
+
+// publishedFlow возвращает опубликованную версию потока, nil - если ее нет
+func (fe *FlowEngine) publishedFlow(ctx context.Context, flowID string) (*compiledFlow, error) {
+	if fe.cache != nil {
+		if flow := fe.cache.get(flowID); flow != nil {
+			return flow, nil
+		}
+	}
+
+	if fe.repo == nil {
+		return nil, fmt.Errorf("loading flows requires a repository")
+	}
+	flow, err := fe.repo.GetPublishedIntegrationFlow(ctx, flowID)
+	if err != nil || flow == nil {
+		return nil, err
+	}
+	return compileFlow(flow)
+}
@@ -0,0 +1,327 @@
+package flowengine
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// evaluateCondition evaluates conditionData of a condition node. It is either
+// a single rule
+//
+//	{"field": "...", "fieldType": "...", "operator": "equals", "value": "..."}
+//
+// or a group of rules and nested groups
+//
+//	{"combinator": "and", "not": false, "rules": [...]}
+func (fe *FlowEngine) evaluateCondition(nodeData, inputData map[string]interface{}) (bool, *ConditionTrace) {
+	conditionData, ok := nodeData["conditionData"].(map[string]interface{})
+	if !ok {
+		return false, nil
+	}
+
+	trace := evaluateRule(conditionData, inputData)
+	return trace.Result, trace
+}
+
+func evaluateRule(rule, inputData map[string]interface{}) *ConditionTrace {
+	var trace *ConditionTrace
+	if rules, ok := rule["rules"].([]interface{}); ok {
+		trace = evaluateGroup(rule, rules, inputData)
+	} else {
+		trace = evaluateLeaf(rule, inputData)
+	}
+
+	if not, _ := rule["not"].(bool); not {
+		trace.Not = true
+		trace.Result = !trace.Result
+	}
+
+	return trace
+}
+
+func evaluateGroup(group map[string]interface{}, rules []interface{}, inputData map[string]interface{}) *ConditionTrace {
+	combinator := groupCombinator(group)
+	trace := &ConditionTrace{
+		Combinator: combinator,
+		Rules:      make([]*ConditionTrace, 0, len(rules)),
+		Result:     combinator == "and",
+	}
+
+	// Все правила вычисляются без short-circuit, чтобы трассировка показывала каждое
+	for _, raw := range rules {
+		rule, ok := raw.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		sub := evaluateRule(rule, inputData)
+		trace.Rules = append(trace.Rules, sub)
+
+		if combinator == "and" {
+			trace.Result = trace.Result && sub.Result
+		} else {
+			trace.Result = trace.Result || sub.Result
+		}
+	}
+
+	return trace
+}
+
+func groupCombinator(group map[string]interface{}) string {
+	combinator, _ := group["combinator"].(string)
+	combinator = strings.ToLower(combinator)
+	if combinator == "" {
+		return "and"
+	}
+	return combinator
+}
+
+func evaluateLeaf(rule, inputData map[string]interface{}) *ConditionTrace {
+	field, _ := rule["field"].(string)
+	fieldType, _ := rule["fieldType"].(string)
+	operator, _ := rule["operator"].(string)
+	value := rule["value"]
+
+	inputValue, exists := resolveField(field, fieldType, inputData)
+
+	trace := &ConditionTrace{
+		Field:     field,
+		FieldType: fieldType,
+		Operator:  operator,
+		Value:     value,
+		Input:     inputValue,
+		Exists:    exists,
+	}
+
+	// Проверки на пустоту имеют смысл и для отсутствующих полей
+	switch operator {
+	case "is_empty":
+		trace.Result = !exists || isEmptyParam(inputValue)
+		return trace
+	case "is_not_empty":
+		trace.Result = exists && !isEmptyParam(inputValue)
+		return trace
+	}
+
+	if !exists {
+		return trace
+	}
+
+	switch operator {
+	case "equals":
+		trace.Result = formatValue(inputValue) == formatValue(value)
+	case "not_equals":
+		trace.Result = formatValue(inputValue) != formatValue(value)
+	case "greater_than":
+		trace.Result = compareNumeric(inputValue, value, ">")
+	case "less_than":
+		trace.Result = compareNumeric(inputValue, value, "<")
+	case "gte":
+		trace.Result = compareNumeric(inputValue, value, ">=")
+	case "lte":
+		trace.Result = compareNumeric(inputValue, value, "<=")
+	case "contains":
+		trace.Result = contains(formatValue(inputValue), formatValue(value))
+	case "starts_with":
+		trace.Result = strings.HasPrefix(strings.ToLower(formatValue(inputValue)), strings.ToLower(formatValue(value)))
+	case "ends_with":
+		trace.Result = strings.HasSuffix(strings.ToLower(formatValue(inputValue)), strings.ToLower(formatValue(value)))
+	case "in":
+		trace.Result = inList(inputValue, value, fieldType)
+	case "not_in":
+		trace.Result = !inList(inputValue, value, fieldType)
+	case "regex":
+		if re, err := regexp.Compile(formatValue(value)); err == nil {
+			trace.Result = re.MatchString(formatValue(inputValue))
+		}
+	case "between":
+		trace.Result = between(inputValue, value)
+	case "before", "after":
+		inputTime, ok1 := toTime(inputValue)
+		valueTime, ok2 := toTime(value)
+		if ok1 && ok2 {
+			if operator == "before" {
+				trace.Result = inputTime.Before(valueTime)
+			} else {
+				trace.Result = inputTime.After(valueTime)
+			}
+		}
+	case "within_last_days":
+		inputTime, ok1 := toTime(inputValue)
+		days, err := toFloat64(value)
+		if ok1 && err == nil {
+			now := time.Now()
+			from := now.Add(-time.Duration(days * float64(24*time.Hour)))
+			trace.Result = !inputTime.Before(from) && !inputTime.After(now)
+		}
+	case "changed_from", "changed_to":
+		// Сравниваем с предыдущим значением поля из "previous" события
+		previous, _ := inputData["previous"].(map[string]interface{})
+		previousValue, hadPrevious := resolveField(field, fieldType, previous)
+		if !hadPrevious {
+			break
+		}
+		trace.Previous = previousValue
+
+		current := formatValue(inputValue)
+		before := formatValue(previousValue)
+		if current == before {
+			break
+		}
+		if operator == "changed_from" {
+			trace.Result = before == formatValue(value)
+		} else {
+			trace.Result = current == formatValue(value)
+		}
+	}
+
+	return trace
+}
+
+func resolveField(field, fieldType string, inputData map[string]interface{}) (interface{}, bool) {
+	// Обрабатываем разные типы полей
+	switch fieldType {
+	case "amocrm_field":
+		if v, ok := inputData[field]; ok {
+			return v, ok
+		}
+		// Кастомные поля сделки лежат в custom_fields по ID, коду и имени
+		customFields, _ := inputData["custom_fields"].(map[string]interface{})
+		v, ok := customFields[field]
+		return v, ok
+	case "pipeline":
+		v, ok := inputData["pipeline_id"]
+		return v, ok
+	case "status":
+		v, ok := inputData["status_id"]
+		return v, ok
+	case "bucket":
+		v, ok := inputData["bucket_id"]
+		return v, ok
+	case "scheduler":
+		v, ok := inputData["scheduler_id"]
+		return v, ok
+	case "scheduler_step":
+		v, ok := inputData["scheduler_step"]
+		return v, ok
+	case "dial_attempts":
+		v, ok := inputData["dial_attempts"]
+		return v, ok
+	default:
+		// Вложенные значения, например сохраненный ответ http_request: "bi.status"
+		return lookupPath(field, inputData)
+	}
+}
+
+// walkRules calls fn for every single rule of conditionData, descending into groups
+func walkRules(conditionData map[string]interface{}, fn func(rule map[string]interface{})) {
+	rules, ok := conditionData["rules"].([]interface{})
+	if !ok {
+		fn(conditionData)
+		return
+	}
+
+	for _, raw := range rules {
+		if rule, ok := raw.(map[string]interface{}); ok {
+			walkRules(rule, fn)
+		}
+	}
+}
+
+// conditionList returns the values of the between operator and of ID lists.
+// Lists may be JSON arrays or comma-separated strings.
+func conditionList(value interface{}) []interface{} {
+	switch v := value.(type) {
+	case []interface{}:
+		return v
+	case string:
+		var list []interface{}
+		for _, item := range strings.Split(v, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+		return list
+	case nil:
+		return nil
+	default:
+		return []interface{}{v}
+	}
+}
+
+// valueList returns the values of in/not_in operators and switch cases. A string
+// is split on commas only for ID fields (pipeline, status, bucket, scheduler),
+// other fields take it as one value and need a JSON array for several values.
+func valueList(value interface{}, fieldType string) []interface{} {
+	if s, ok := value.(string); ok {
+		if _, isRef := refFieldTypes[fieldType]; !isRef {
+			if strings.TrimSpace(s) == "" {
+				return nil
+			}
+			return []interface{}{s}
+		}
+	}
+	return conditionList(value)
+}
+
+func inList(inputValue, value interface{}, fieldType string) bool {
+	input := formatValue(inputValue)
+	for _, item := range valueList(value, fieldType) {
+		if formatValue(item) == input {
+			return true
+		}
+	}
+	return false
+}
+
+// between checks min <= input <= max, comparing numbers first and dates otherwise
+func between(inputValue, value interface{}) bool {
+	bounds := conditionList(value)
+	if len(bounds) != 2 {
+		return false
+	}
+
+	if _, err := toFloat64(inputValue); err == nil {
+		return compareNumeric(inputValue, bounds[0], ">=") && compareNumeric(inputValue, bounds[1], "<=")
+	}
+
+	input, ok := toTime(inputValue)
+	from, okFrom := toTime(bounds[0])
+	to, okTo := toTime(bounds[1])
+	if !ok || !okFrom || !okTo {
+		return false
+	}
+	return !input.Before(from) && !input.After(to)
+}
+
+var dateLayouts = []string{
+	time.RFC3339,
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+	"02.01.2006 15:04",
+	"02.01.2006",
+}
+
+// toTime converts AmoCRM date values: unix timestamps or date strings
+func toTime(value interface{}) (time.Time, bool) {
+	if s, ok := value.(string); ok {
+		s = strings.TrimSpace(s)
+		for _, layout := range dateLayouts {
+			if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+				return t, true
+			}
+		}
+		if ts, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return time.Unix(ts, 0), true
+		}
+		return time.Time{}, false
+	}
+
+	ts, err := toFloat64(value)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(int64(ts), 0), true
+}
@@ -0,0 +1,120 @@
+package flowengine
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// ErrLeadNotFound is returned when the lead no longer exists in AmoCRM
+var ErrLeadNotFound = errors.New("lead not found")
+
+// LeadFetcher загружает актуальные данные сделки
+type LeadFetcher interface {
+	GetLead(ctx context.Context, leadID int64) (map[string]interface{}, error)
+}
+
+// CRMLookup загружает связанные со сделкой сущности для узла enrich
+type CRMLookup interface {
+	GetLeadContacts(ctx context.Context, leadID int64) ([]interface{}, error)
+	GetLeadCompany(ctx context.Context, leadID int64) (map[string]interface{}, error)
+	GetUser(ctx context.Context, userID int64) (map[string]interface{}, error)
+}
+
+// CRMClient запрашивает данные у crm-service через NATS request/reply
+type CRMClient struct {
+	nc      *nats.Conn
+	timeout time.Duration
+}
+
+func NewCRMClient(nc *nats.Conn, timeout time.Duration) *CRMClient {
+	return &CRMClient{
+		nc:      nc,
+		timeout: timeout,
+	}
+}
+
+// CRMReply is the reply format of crm-service requests
+type CRMReply struct {
+	Data     map[string]interface{} `json:"data,omitempty"`
+	Error    string                 `json:"error,omitempty"`
+	NotFound bool                   `json:"not_found,omitempty"`
+}
+
+// GetLead возвращает сделку в формате события вебхука
+func (c *CRMClient) GetLead(ctx context.Context, leadID int64) (map[string]interface{}, error) {
+	reply, err := c.request(ctx, "crm.get_lead", map[string]interface{}{"lead_id": leadID})
+	if err != nil {
+		return nil, err
+	}
+	if reply.NotFound {
+		return nil, ErrLeadNotFound
+	}
+	return reply.Data, nil
+}
+
+// GetLeadContacts возвращает контакты сделки, основной контакт первым
+func (c *CRMClient) GetLeadContacts(ctx context.Context, leadID int64) ([]interface{}, error) {
+	reply, err := c.request(ctx, "crm.get_lead_contacts", map[string]interface{}{"lead_id": leadID})
+	if err != nil {
+		return nil, err
+	}
+	if reply.NotFound {
+		return nil, ErrLeadNotFound
+	}
+	contacts, _ := reply.Data["contacts"].([]interface{})
+	return contacts, nil
+}
+
+// GetLeadCompany возвращает компанию сделки, nil - если ее нет
+func (c *CRMClient) GetLeadCompany(ctx context.Context, leadID int64) (map[string]interface{}, error) {
+	reply, err := c.request(ctx, "crm.get_lead_company", map[string]interface{}{"lead_id": leadID})
+	if err != nil {
+		return nil, err
+	}
+	if reply.NotFound {
+		return nil, ErrLeadNotFound
+	}
+	return reply.Data, nil
+}
+
+// GetUser возвращает пользователя AmoCRM, nil - если его нет
+func (c *CRMClient) GetUser(ctx context.Context, userID int64) (map[string]interface{}, error) {
+	reply, err := c.request(ctx, "crm.get_user", map[string]interface{}{"user_id": userID})
+	if err != nil {
+		return nil, err
+	}
+	if reply.NotFound {
+		return nil, nil
+	}
+	return reply.Data, nil
+}
+
+func (c *CRMClient) request(ctx context.Context, subject string, payload interface{}) (*CRMReply, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	msg, err := c.nc.RequestWithContext(ctx, subject, data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to request %s: %w", subject, err)
+	}
+
+	var reply CRMReply
+	if err := json.Unmarshal(msg.Data, &reply); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal %s reply: %w", subject, err)
+	}
+	if reply.Error != "" && !reply.NotFound {
+		return nil, fmt.Errorf("%s failed: %s", subject, reply.Error)
+	}
+
+	return &reply, nil
+}
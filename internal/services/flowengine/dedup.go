@@ -0,0 +1,173 @@
+package flowengine
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Ключ идемпотентности запуска строится из потока, сделки, типа события и
+// состояния сделки. Настройки задаются в data стартового узла:
+//
+//	"dedup": {"fields": ["status_id", "pipeline_id"], "ttl": "30m", "across_event_types": true}
+//
+// fields - поля события, составляющие состояние (по умолчанию defaultDedupFields),
+// across_event_types - не учитывать тип события, чтобы lead.update и lead.status
+// об одном изменении считались дублями, "enabled": false выключает дедупликацию.
+// По умолчанию тип события входит в ключ, и такая пара событий выполняет поток дважды.
+
+// defaultDedupFields - состояние сделки по умолчанию. updated_at в него не входит:
+// amoCRM меняет его при каждом редактировании, и повтор не совпал бы с оригиналом.
+var defaultDedupFields = []string{
+	"pipeline_id", "status_id", "responsible_user_id", "price", "custom_fields", "created_at",
+}
+
+const (
+	dedupKeyPrefix = "flow_dedup:"
+	maxDedupTTL    = 7 * 24 * time.Hour
+)
+
+type dedupSettings struct {
+	enabled          bool
+	fields           []string
+	ttl              time.Duration
+	acrossEventTypes bool
+}
+
+func parseDedup(config *FlowConfig) (*dedupSettings, error) {
+	settings := &dedupSettings{enabled: true, fields: defaultDedupFields}
+
+	start := config.startNode()
+	if start == nil {
+		return settings, nil
+	}
+	raw, ok := start.Data["dedup"].(map[string]interface{})
+	if !ok {
+		if start.Data["dedup"] != nil {
+			return nil, fmt.Errorf("dedup must be an object")
+		}
+		return settings, nil
+	}
+
+	if enabled, ok := raw["enabled"].(bool); ok {
+		settings.enabled = enabled
+	}
+	settings.acrossEventTypes, _ = raw["across_event_types"].(bool)
+
+	if fields, ok := raw["fields"].([]interface{}); ok && len(fields) > 0 {
+		settings.fields = make([]string, 0, len(fields))
+		for _, field := range fields {
+			name, ok := field.(string)
+			if !ok || name == "" {
+				return nil, fmt.Errorf("dedup fields must be field names")
+			}
+			settings.fields = append(settings.fields, name)
+		}
+	}
+
+	if value, ok := raw["ttl"].(string); ok && value != "" {
+		ttl, err := time.ParseDuration(value)
+		if err != nil || ttl <= 0 || ttl > maxDedupTTL {
+			return nil, fmt.Errorf("dedup ttl must be a duration up to %s", maxDedupTTL)
+		}
+		settings.ttl = ttl
+	}
+
+	return settings, nil
+}
+
+// key возвращает ключ идемпотентности события для потока
+func (s *dedupSettings) key(flowID string, event map[string]interface{}) string {
+	state := make(map[string]interface{}, len(s.fields)+1)
+	for _, field := range s.fields {
+		if value, ok := lookupPath(field, event); ok {
+			state[field] = value
+		}
+	}
+	if !s.acrossEventTypes {
+		state["event_type"] = event["event_type"]
+	}
+
+	// encoding/json сортирует ключи карт, так что хеш не зависит от порядка полей
+	data, _ := json.Marshal(state)
+	sum := sha256.Sum256(data)
+
+	leadID, _ := toFloat64(event["lead_id"])
+	return fmt.Sprintf("%s:%d:%s", flowID, int64(leadID), hex.EncodeToString(sum[:12]))
+}
+
+// Deduplicator stores idempotency keys of runs in Redis so that an event
+// delivered twice runs a flow once
+type Deduplicator struct {
+	rdb *redis.Client
+	ttl time.Duration
+}
+
+// NewDeduplicator creates a deduplicator keeping keys for ttl unless the flow sets its own
+func NewDeduplicator(rdb *redis.Client, ttl time.Duration) *Deduplicator {
+	return &Deduplicator{rdb: rdb, ttl: ttl}
+}
+
+// claim записывает ключ за запуском. Если ключ уже занят, возвращает ID первого запуска
+func (d *Deduplicator) claim(ctx context.Context, key, executionID string, ttl time.Duration) (bool, string, error) {
+	if ttl <= 0 {
+		ttl = d.ttl
+	}
+
+	claimed, err := d.rdb.SetNX(ctx, dedupKeyPrefix+key, executionID, ttl).Result()
+	if err != nil {
+		return false, "", fmt.Errorf("failed to store idempotency key: %w", err)
+	}
+	if claimed {
+		return true, "", nil
+	}
+
+	original, err := d.rdb.Get(ctx, dedupKeyPrefix+key).Result()
+	if err != nil && err != redis.Nil {
+		return false, "", fmt.Errorf("failed to get idempotency key: %w", err)
+	}
+	return false, original, nil
+}
+
+// release освобождает ключ упавшего запуска, чтобы повторное событие выполнилось заново
+func (d *Deduplicator) release(ctx context.Context, key, executionID string) error {
+	// Удаляем только свой ключ: его мог уже занять другой запуск после истечения TTL
+	script := redis.NewScript(`
+        if redis.call("GET", KEYS[1]) == ARGV[1] then
+            return redis.call("DEL", KEYS[1])
+        end
+        return 0
+    `)
+	if err := script.Run(ctx, d.rdb, []string{dedupKeyPrefix + key}, executionID).Err(); err != nil && err != redis.Nil {
+		return fmt.Errorf("failed to release idempotency key: %w", err)
+	}
+	return nil
+}
+
+// SetDeduplicator makes the engine skip runs whose idempotency key was already
+// seen. Without it keys are still computed and sent with commands.
+func (fe *FlowEngine) SetDeduplicator(dedup *Deduplicator) {
+	fe.dedup = dedup
+}
+
+// commandKey - ключ идемпотентности команды: ключ запуска и узел, ее отправивший
+func commandKey(ctx context.Context) string {
+	execution := executionFromContext(ctx)
+	if execution == nil || execution.IdempotencyKey == "" {
+		return ""
+	}
+
+	step := stepFromContext(ctx)
+	if step == nil {
+		return execution.IdempotencyKey
+	}
+	if step.Branch != "" {
+		return execution.IdempotencyKey + ":" + step.Branch + "/" + step.NodeID
+	}
+	return execution.IdempotencyKey + ":" + step.NodeID
+}
@@ -0,0 +1,264 @@
+package flowengine
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	// Часовые пояса нужны и в контейнерах без tzdata
+	_ "time/tzdata"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"crm-dialer-integration/internal/models"
+)
+
+const (
+	PendingRunPending   = "pending"
+	PendingRunRunning   = "running"
+	PendingRunCompleted = "completed"
+	PendingRunFailed    = "failed"
+	PendingRunCancelled = "cancelled"
+)
+
+// executeDelay приостанавливает запуск до момента, заданного в delayData:
+//
+//	"delayData": {"mode": "duration", "duration": "2h"}
+//	"delayData": {"mode": "until", "time": "09:00", "timezone": "Europe/Moscow", "timezone_field": "Часовой пояс"}
+//
+// Запуск сохраняется в flow_pending_runs и продолжается планировщиком.
+func (fe *FlowEngine) executeDelay(ctx context.Context, step *ExecutionStep, node *FlowNode, data map[string]interface{}) (bool, error) {
+	// Продолжение запуска хранит только граф основного потока
+	if subflowFromContext(ctx) != nil {
+		return false, fmt.Errorf("delay nodes can't be used inside a subflow")
+	}
+
+	resumeAt, err := delayUntil(node.Data, data, time.Now())
+	if err != nil {
+		return false, err
+	}
+	step.Details = map[string]interface{}{"resume_at": resumeAt}
+
+	// Симуляция не ждет, а сразу переходит к следующему узлу
+	if fe.dryRun {
+		step.Details["skipped"] = true
+		return false, nil
+	}
+
+	run, err := fe.suspendRun(ctx, node, data, resumeAt)
+	if err != nil {
+		return false, err
+	}
+	step.Details["pending_run_id"] = run.ID
+
+	fe.logger.Info("Flow run delayed",
+		zap.String("flow_id", run.FlowID),
+		zap.String("pending_run_id", run.ID),
+		zap.Time("resume_at", resumeAt))
+
+	return true, nil
+}
+
+// suspendRun сохраняет запуск в flow_pending_runs и приостанавливает его.
+// Планировщик продолжит запуск в resumeAt с ребер узла node.
+func (fe *FlowEngine) suspendRun(ctx context.Context, node *FlowNode, data map[string]interface{}, resumeAt time.Time) (*models.FlowPendingRun, error) {
+	execution := executionFromContext(ctx)
+	if execution == nil || len(execution.flowData) == 0 {
+		return nil, fmt.Errorf("%s node can only be used in a stored flow", node.Type)
+	}
+
+	eventData, err := json.Marshal(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal event data: %w", err)
+	}
+
+	run := &models.FlowPendingRun{
+		ID:             uuid.New().String(),
+		FlowID:         execution.FlowID,
+		FlowData:       execution.flowData,
+		FlowVersion:    execution.FlowVersion,
+		IdempotencyKey: execution.IdempotencyKey,
+		NodeID:         node.ID,
+		ExecutionID:    execution.ID,
+		LeadID:         execution.LeadID,
+		EventType:      execution.EventType,
+		EventData:      eventData,
+		Status:         PendingRunPending,
+		ResumeAt:       resumeAt,
+	}
+
+	if err := fe.repo.CreateFlowPendingRun(ctx, run); err != nil {
+		return nil, err
+	}
+
+	execution.suspend()
+	return run, nil
+}
+
+// delayUntil вычисляет момент продолжения запуска
+func delayUntil(nodeData, inputData map[string]interface{}, now time.Time) (time.Time, error) {
+	delayData, ok := nodeData["delayData"].(map[string]interface{})
+	if !ok {
+		return time.Time{}, fmt.Errorf("delay node has no delayData")
+	}
+
+	mode, _ := delayData["mode"].(string)
+	switch mode {
+	case "", "duration":
+		duration, err := parseDelayDuration(delayData["duration"])
+		if err != nil {
+			return time.Time{}, err
+		}
+		return now.Add(duration), nil
+
+	case "until":
+		clock, _ := delayData["time"].(string)
+		hour, minute, err := parseClock(clock)
+		if err != nil {
+			return time.Time{}, err
+		}
+
+		location, err := delayLocation(delayData, inputData)
+		if err != nil {
+			return time.Time{}, err
+		}
+
+		// Ближайшее наступление времени в часовом поясе сделки
+		local := now.In(location)
+		next := time.Date(local.Year(), local.Month(), local.Day(), hour, minute, 0, 0, location)
+		if !next.After(local) {
+			next = next.AddDate(0, 0, 1)
+		}
+		return next, nil
+
+	default:
+		return time.Time{}, fmt.Errorf("unknown delay mode: %s", mode)
+	}
+}
+
+func parseDelayDuration(value interface{}) (time.Duration, error) {
+	raw, _ := value.(string)
+	duration, err := time.ParseDuration(raw)
+	if err != nil {
+		return 0, fmt.Errorf("invalid delay duration %q: %w", raw, err)
+	}
+	if duration <= 0 {
+		return 0, fmt.Errorf("delay duration must be positive")
+	}
+	return duration, nil
+}
+
+func parseClock(clock string) (int, int, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(clock))
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid delay time %q, expected HH:MM", clock)
+	}
+	return t.Hour(), t.Minute(), nil
+}
+
+// delayLocation берет часовой пояс из поля сделки, затем из настроек узла
+func delayLocation(delayData, inputData map[string]interface{}) (*time.Location, error) {
+	if field, _ := delayData["timezone_field"].(string); field != "" {
+		if value, ok := resolveField(field, "amocrm_field", inputData); ok {
+			if name, _ := value.(string); name != "" {
+				if location, err := time.LoadLocation(name); err == nil {
+					return location, nil
+				}
+			}
+		}
+	}
+
+	if name, _ := delayData["timezone"].(string); name != "" {
+		location, err := time.LoadLocation(name)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timezone %q: %w", name, err)
+		}
+		return location, nil
+	}
+
+	return time.Local, nil
+}
+
+// ErrFlowChanged is returned for a paused run whose flow was deactivated,
+// deleted or published in another version while the run was waiting
+var ErrFlowChanged = errors.New("flow changed while the run was paused")
+
+// checkPendingRunFlow проверяет, что поток запуска все еще активен и опубликован
+// в той версии, в которой запуск был приостановлен
+func (fe *FlowEngine) checkPendingRunFlow(ctx context.Context, run *models.FlowPendingRun) error {
+	compiled, err := fe.publishedFlow(ctx, run.FlowID)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case compiled == nil:
+		return fmt.Errorf("%w: flow %s was deleted or unpublished", ErrFlowChanged, run.FlowID)
+	case !compiled.flow.IsActive:
+		return fmt.Errorf("%w: flow %s was deactivated", ErrFlowChanged, run.FlowID)
+	case run.FlowVersion != 0 && compiled.flow.PublishedVersion != run.FlowVersion:
+		return fmt.Errorf("%w: version %d of flow %s was replaced by version %d",
+			ErrFlowChanged, run.FlowVersion, run.FlowID, compiled.flow.PublishedVersion)
+	}
+	return nil
+}
+
+// ResumeRun продолжает приостановленный запуск со следующего за delay или throttle узла.
+// Продолжение записывается как новое выполнение со ссылкой на исходное.
+func (fe *FlowEngine) ResumeRun(ctx context.Context, run *models.FlowPendingRun, data map[string]interface{}) (*Execution, error) {
+	config, err := parseFlowConfig(run.FlowData)
+	if err != nil {
+		return nil, err
+	}
+
+	node := fe.findNodeByID(run.NodeID, config)
+	if node == nil {
+		return nil, fmt.Errorf("node not found: %s", run.NodeID)
+	}
+
+	execution := newExecution(run.FlowID, data)
+	execution.EventType = run.EventType
+	execution.ResumedFrom = run.ExecutionID
+	execution.FlowVersion = run.FlowVersion
+	execution.IdempotencyKey = run.IdempotencyKey
+	execution.flowData = run.FlowData
+	ctx = withExecution(ctx, execution)
+
+	step := execution.startStep(node)
+	step.Details = map[string]interface{}{
+		"pending_run_id": run.ID,
+		"resumed":        true,
+	}
+	step.finish(nil)
+
+	matched, err := fe.followEdges(ctx, step, node, config, data)
+
+	execution.finish(matched, err)
+	fe.saveExecution(ctx, execution)
+
+	return execution, err
+}
+
+func (fe *FlowEngine) cancelPendingRuns(ctx context.Context, event map[string]interface{}) {
+	leadID, err := toFloat64(event["lead_id"])
+	if err != nil || leadID == 0 {
+		return
+	}
+
+	cancelled, err := fe.repo.CancelFlowPendingRunsForLead(ctx, int64(leadID))
+	if err != nil {
+		fe.logger.Error("Failed to cancel pending flow runs",
+			zap.Int64("lead_id", int64(leadID)),
+			zap.Error(err))
+		return
+	}
+
+	if cancelled > 0 {
+		fe.logger.Info("Pending flow runs cancelled",
+			zap.Int64("lead_id", int64(leadID)),
+			zap.Int64("count", cancelled))
+	}
+}
@@ -0,0 +1,147 @@
+package flowengine
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// FlowDiff lists what changed between two graphs of a flow. Node positions
+// are layout only and are not compared.
+type FlowDiff struct {
+	NodesAdded   []FlowNode   `json:"nodes_added"`
+	NodesRemoved []FlowNode   `json:"nodes_removed"`
+	NodesChanged []NodeChange `json:"nodes_changed"`
+	EdgesAdded   []FlowEdge   `json:"edges_added"`
+	EdgesRemoved []FlowEdge   `json:"edges_removed"`
+	EdgesChanged []EdgeChange `json:"edges_changed"`
+}
+
+// NodeChange describes a node present in both graphs. Fields lists the changed
+// attributes: "type" and "data.<key>".
+type NodeChange struct {
+	ID     string   `json:"id"`
+	Fields []string `json:"fields"`
+	Before FlowNode `json:"before"`
+	After  FlowNode `json:"after"`
+}
+
+// EdgeChange describes an edge present in both graphs
+type EdgeChange struct {
+	ID     string   `json:"id"`
+	Fields []string `json:"fields"`
+	Before FlowEdge `json:"before"`
+	After  FlowEdge `json:"after"`
+}
+
+// DiffFlows compares two flow graphs. Nodes are matched by id, edges by id or,
+// for edges without one, by source and target.
+func DiffFlows(from, to json.RawMessage) (*FlowDiff, error) {
+	var before, after FlowConfig
+	if err := json.Unmarshal(from, &before); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal flow config: %w", err)
+	}
+	if err := json.Unmarshal(to, &after); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal flow config: %w", err)
+	}
+
+	diff := &FlowDiff{
+		NodesAdded:   []FlowNode{},
+		NodesRemoved: []FlowNode{},
+		NodesChanged: []NodeChange{},
+		EdgesAdded:   []FlowEdge{},
+		EdgesRemoved: []FlowEdge{},
+		EdgesChanged: []EdgeChange{},
+	}
+
+	beforeNodes := make(map[string]FlowNode, len(before.Nodes))
+	for _, node := range before.Nodes {
+		beforeNodes[node.ID] = node
+	}
+	afterNodes := make(map[string]bool, len(after.Nodes))
+	for _, node := range after.Nodes {
+		afterNodes[node.ID] = true
+
+		old, ok := beforeNodes[node.ID]
+		if !ok {
+			diff.NodesAdded = append(diff.NodesAdded, node)
+			continue
+		}
+
+		var fields []string
+		if old.Type != node.Type {
+			fields = append(fields, "type")
+		}
+		fields = append(fields, changedKeys("data.", old.Data, node.Data)...)
+		if len(fields) > 0 {
+			diff.NodesChanged = append(diff.NodesChanged, NodeChange{ID: node.ID, Fields: fields, Before: old, After: node})
+		}
+	}
+	for _, node := range before.Nodes {
+		if !afterNodes[node.ID] {
+			diff.NodesRemoved = append(diff.NodesRemoved, node)
+		}
+	}
+
+	beforeEdges := make(map[string]FlowEdge, len(before.Edges))
+	for _, edge := range before.Edges {
+		beforeEdges[edgeKey(edge)] = edge
+	}
+	afterEdges := make(map[string]bool, len(after.Edges))
+	for _, edge := range after.Edges {
+		key := edgeKey(edge)
+		afterEdges[key] = true
+
+		old, ok := beforeEdges[key]
+		if !ok {
+			diff.EdgesAdded = append(diff.EdgesAdded, edge)
+			continue
+		}
+
+		var fields []string
+		if old.Source != edge.Source {
+			fields = append(fields, "source")
+		}
+		if old.Target != edge.Target {
+			fields = append(fields, "target")
+		}
+		if old.Type != edge.Type {
+			fields = append(fields, "type")
+		}
+		fields = append(fields, changedKeys("data.", old.Data, edge.Data)...)
+		if len(fields) > 0 {
+			diff.EdgesChanged = append(diff.EdgesChanged, EdgeChange{ID: key, Fields: fields, Before: old, After: edge})
+		}
+	}
+	for _, edge := range before.Edges {
+		if !afterEdges[edgeKey(edge)] {
+			diff.EdgesRemoved = append(diff.EdgesRemoved, edge)
+		}
+	}
+
+	return diff, nil
+}
+
+func edgeKey(edge FlowEdge) string {
+	if edge.ID != "" {
+		return edge.ID
+	}
+	return edge.Source + "->" + edge.Target
+}
+
+func changedKeys(prefix string, before, after map[string]interface{}) []string {
+	var keys []string
+	for key, value := range after {
+		if old, ok := before[key]; !ok || !reflect.DeepEqual(old, value) {
+			keys = append(keys, prefix+key)
+		}
+	}
+	for key := range before {
+		if _, ok := after[key]; !ok {
+			keys = append(keys, prefix+key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -12,9 +12,33 @@ import (
 )
 
 type FlowEngine struct {
-	logger *zap.Logger
-	repo   *repository.Repository
-	nc     *nats.Conn
+	logger    *zap.Logger
+	repo      *repository.Repository
+	publisher Publisher
+
+	// dryRun включается симуляцией: delay узлы не приостанавливают запуск,
+	// в базу ничего не пишется
+	dryRun bool
+
+	// branchSlots ограничивает число параллельно выполняемых веток, nil - ветки последовательно
+	branchSlots chan struct{}
+
+	// cache - скомпилированные опубликованные потоки, nil - потоки читаются из базы
+	cache *FlowCache
+
+	// dedup хранит ключи идемпотентности запусков, nil - дубли не отсеиваются
+	dedup *Deduplicator
+
+	// crm загружает данные для узлов enrich
+	crm CRMLookup
+
+	// throttle - счетчики узлов throttle в Redis
+	throttle *Throttle
+}
+
+// Publisher публикует команды действий. *nats.Conn удовлетворяет этому интерфейсу
+type Publisher interface {
+	Publish(subject string, data []byte) error
 }
 
 type FlowNode struct {
@@ -28,15 +52,51 @@ type FlowNode struct {
 }
 
 type FlowEdge struct {
-	ID     string `json:"id"`
-	Source string `json:"source"`
-	Target string `json:"target"`
-	Type   string `json:"type"`
+	ID     string                 `json:"id"`
+	Source string                 `json:"source"`
+	Target string                 `json:"target"`
+	Type   string                 `json:"type"`
+	Data   map[string]interface{} `json:"data,omitempty"`
 }
 
 type FlowConfig struct {
 	Nodes []FlowNode `json:"nodes"`
 	Edges []FlowEdge `json:"edges"`
+
+	// Индексы строит parseFlowConfig, без них узлы и ребра ищутся перебором
+	nodeIndex     map[string]int
+	edgesBySource map[string][]int
+}
+
+// parseFlowConfig разбирает граф потока и строит индексы узлов и ребер
+func parseFlowConfig(flowData json.RawMessage) (*FlowConfig, error) {
+	var config FlowConfig
+	if err := json.Unmarshal(flowData, &config); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal flow config: %w", err)
+	}
+
+	config.nodeIndex = make(map[string]int, len(config.Nodes))
+	for i, node := range config.Nodes {
+		if _, exists := config.nodeIndex[node.ID]; !exists {
+			config.nodeIndex[node.ID] = i
+		}
+	}
+	config.edgesBySource = make(map[string][]int, len(config.Nodes))
+	for i, edge := range config.Edges {
+		config.edgesBySource[edge.Source] = append(config.edgesBySource[edge.Source], i)
+	}
+
+	return &config, nil
+}
+
+// startNode возвращает первый узел start графа
+func (c *FlowConfig) startNode() *FlowNode {
+	for i := range c.Nodes {
+		if c.Nodes[i].Type == "start" {
+			return &c.Nodes[i]
+		}
+	}
+	return nil
 }
 
 func NewFlowEngine(logger *zap.Logger, repo *repository.Repository) *FlowEngine {
@@ -47,57 +107,55 @@ func NewFlowEngine(logger *zap.Logger, repo *repository.Repository) *FlowEngine
 }
 
 func NewFlowEngineWithNATS(logger *zap.Logger, repo *repository.Repository, nc *nats.Conn) *FlowEngine {
-	return &FlowEngine{
-		logger: logger,
-		repo:   repo,
-		nc:     nc,
+	fe := NewFlowEngine(logger, repo)
+	if nc != nil {
+		fe.publisher = nc
 	}
+	return fe
 }
 
 func (fe *FlowEngine) ExecuteFlow(ctx context.Context, flowData json.RawMessage, inputData map[string]interface{}) (bool, error) {
-	var config FlowConfig
-	if err := json.Unmarshal(flowData, &config); err != nil {
-		return false, fmt.Errorf("failed to unmarshal flow config: %w", err)
+	config, err := parseFlowConfig(flowData)
+	if err != nil {
+		return false, err
 	}
 
-	// Find start node
-	var startNode *FlowNode
-	for _, node := range config.Nodes {
-		if node.Type == "start" {
-			startNode = &node
-			break
-		}
-	}
+	return fe.executeConfig(ctx, config, inputData)
+}
 
+// executeConfig выполняет уже разобранный граф с узла start
+func (fe *FlowEngine) executeConfig(ctx context.Context, config *FlowConfig, inputData map[string]interface{}) (bool, error) {
+	startNode := config.startNode()
 	if startNode == nil {
 		return false, fmt.Errorf("no start node found")
 	}
 
 	// Execute flow from start node
-	return fe.executeNode(ctx, startNode, &config, inputData)
+	return fe.executeNode(ctx, startNode, config, inputData)
 }
 
 func (fe *FlowEngine) executeNode(ctx context.Context, node *FlowNode, config *FlowConfig, data map[string]interface{}) (bool, error) {
+	step := executionFromContext(ctx).startStep(node)
+	step.Branch = branchFromContext(ctx)
+
 	switch node.Type {
 	case "start":
-		// Find next node
-		nextNode := fe.findNextNode(node.ID, config)
-		if nextNode == nil {
-			return true, nil
-		}
-		return fe.executeNode(ctx, nextNode, config, data)
+		step.finish(nil)
+
+		// Follow every outgoing edge
+		return fe.followEdges(ctx, step, node, config, data)
 
 	case "condition":
-		result := fe.evaluateCondition(node.Data, data)
+		result, trace := fe.evaluateCondition(node.Data, data)
+		step.Condition = trace
+		step.finish(nil)
 
 		// Find appropriate next node based on condition result
 		var nextNodeID string
-		for _, edge := range config.Edges {
-			if edge.Source == node.ID {
-				if (result && edge.Type == "true") || (!result && edge.Type == "false") {
-					nextNodeID = edge.Target
-					break
-				}
+		for _, edge := range outgoingEdges(node.ID, config) {
+			if (result && edge.Type == "true") || (!result && edge.Type == "false") {
+				nextNodeID = edge.Target
+				break
 			}
 		}
 
@@ -112,91 +170,149 @@ func (fe *FlowEngine) executeNode(ctx context.Context, node *FlowNode, config *F
 
 		return fe.executeNode(ctx, nextNode, config, data)
 
-	case "action":
-		// Execute action (e.g., send to dialer)
-		if err := fe.executeAction(ctx, node.Data, data); err != nil {
+	case "switch":
+		edge, trace := fe.evaluateSwitch(node, config, data)
+		step.Condition = trace
+		step.finish(nil)
+
+		// Ни один case не подошел и нет default ветки
+		if edge == nil {
+			return false, nil
+		}
+
+		nextNode := fe.findNodeByID(edge.Target, config)
+		if nextNode == nil {
+			return false, fmt.Errorf("node not found: %s", edge.Target)
+		}
+
+		return fe.executeNode(ctx, nextNode, config, data)
+
+	case "split":
+		edge, err := fe.executeSplit(step, node, config, data)
+		step.finish(err)
+		if err != nil {
 			return false, err
 		}
 
-		// Continue to next node
-		nextNode := fe.findNextNode(node.ID, config)
+		nextNode := fe.findNodeByID(edge.Target, config)
 		if nextNode == nil {
-			return true, nil
+			return false, fmt.Errorf("node not found: %s", edge.Target)
 		}
+
 		return fe.executeNode(ctx, nextNode, config, data)
 
-	case "end":
-		return true, nil
+	case "delay":
+		suspended, err := fe.executeDelay(ctx, step, node, data)
+		step.finish(err)
+		if err != nil {
+			return false, err
+		}
+		if suspended {
+			return true, nil
+		}
 
-	default:
-		return false, fmt.Errorf("unknown node type: %s", node.Type)
-	}
-}
+		return fe.followEdges(ctx, step, node, config, data)
 
-func (fe *FlowEngine) evaluateCondition(nodeData, inputData map[string]interface{}) bool {
-	conditionData, ok := nodeData["conditionData"].(map[string]interface{})
-	if !ok {
-		return false
-	}
-
-	field, _ := conditionData["field"].(string)
-	fieldType, _ := conditionData["fieldType"].(string)
-	operator, _ := conditionData["operator"].(string)
-	value := conditionData["value"]
-
-	var inputValue interface{}
-	var exists bool
-
-	// Обрабатываем разные типы полей
-	switch fieldType {
-	case "amocrm_field":
-		inputValue, exists = inputData[field]
-	case "pipeline":
-		inputValue, exists = inputData["pipeline_id"]
-	case "status":
-		inputValue, exists = inputData["status_id"]
-	case "bucket":
-		inputValue, exists = inputData["bucket_id"]
-	case "scheduler":
-		inputValue, exists = inputData["scheduler_id"]
-	case "scheduler_step":
-		inputValue, exists = inputData["scheduler_step"]
-	case "dial_attempts":
-		inputValue, exists = inputData["dial_attempts"]
-	default:
-		inputValue, exists = inputData[field]
-	}
+	case "action":
+		step.ActionType, _ = node.Data["type"].(string)
 
-	if !exists {
-		return false
-	}
+		policy, err := parseFailurePolicy(node.Data, len(errorEdges(outgoingEdges(node.ID, config))) > 0)
+		if err != nil {
+			step.finish(err)
+			return false, err
+		}
+
+		// Execute action (e.g., send to dialer), retrying per the failure policy
+		attempts, err := fe.runAction(withStep(ctx, step), step, node, policy, data)
+		if attempts > 1 {
+			step.setDetail("attempts", attempts)
+		}
+		step.finish(err)
+		if err != nil {
+			return fe.handleActionError(ctx, step, node, config, policy, attempts, err, data)
+		}
+
+		// Continue to next nodes
+		return fe.followEdges(ctx, step, node, config, data)
+
+	case "throttle":
+		result, err := fe.executeThrottle(ctx, step, node, data)
+		step.finish(err)
+		if err != nil {
+			return false, err
+		}
+
+		switch result {
+		case throttleQueued:
+			return true, nil
+		case throttleLimited:
+			// Без ребер overflow запуск сверх лимита просто не продолжается
+			edges := overflowEdges(outgoingEdges(node.ID, config))
+			if len(edges) == 0 {
+				return false, nil
+			}
+			return fe.fanOut(ctx, step, node, config, edges, data)
+		}
+
+		return fe.followEdges(ctx, step, node, config, data)
+
+	case "set":
+		err := fe.executeSet(step, node, data)
+		step.finish(err)
+		if err != nil {
+			return false, err
+		}
+
+		return fe.followEdges(ctx, step, node, config, data)
+
+	case "enrich":
+		err := fe.executeEnrich(ctx, step, node, data)
+		step.finish(err)
+		if err != nil {
+			return false, err
+		}
+
+		return fe.followEdges(ctx, step, node, config, data)
+
+	case "subflow":
+		err := fe.executeSubflow(ctx, step, node, data)
+		step.finish(err)
+		if err != nil {
+			return false, err
+		}
+
+		return fe.followEdges(ctx, step, node, config, data)
+
+	case "end":
+		// Следующие потоки не выполняются для события, если запуск дошел до такого узла
+		if stop, _ := node.Data["stop_processing"].(bool); stop {
+			executionFromContext(ctx).stopFurtherFlows()
+			step.setDetail("stop_processing", true)
+		}
+
+		// The end node of a sub-flow returns its outputs to the caller
+		err := fe.returnOutputs(ctx, step, node, data)
+		step.finish(err)
+		if err != nil {
+			return false, err
+		}
+		return true, nil
 
-	switch operator {
-	case "equals":
-		return fmt.Sprintf("%v", inputValue) == fmt.Sprintf("%v", value)
-	case "not_equals":
-		return fmt.Sprintf("%v", inputValue) != fmt.Sprintf("%v", value)
-	case "greater_than":
-		return compareNumeric(inputValue, value, ">")
-	case "less_than":
-		return compareNumeric(inputValue, value, "<")
-	case "contains":
-		return contains(fmt.Sprintf("%v", inputValue), fmt.Sprintf("%v", value))
 	default:
-		return false
+		err := fmt.Errorf("unknown node type: %s", node.Type)
+		step.finish(err)
+		return false, err
 	}
 }
 
-func (fe *FlowEngine) findNextNode(nodeID string, config *FlowConfig) *FlowNode {
-	for _, edge := range config.Edges {
-		if edge.Source == nodeID {
-			return fe.findNodeByID(edge.Target, config)
+func (fe *FlowEngine) findNodeByID(nodeID string, config *FlowConfig) *FlowNode {
+	if config.nodeIndex != nil {
+		if i, ok := config.nodeIndex[nodeID]; ok {
+			return &config.Nodes[i]
 		}
+		return nil
 	}
-	return nil
-}
 
-func (fe *FlowEngine) findNodeByID(nodeID string, config *FlowConfig) *FlowNode {
 	for _, node := range config.Nodes {
 		if node.ID == nodeID {
 			return &node
@@ -206,30 +322,107 @@ func (fe *FlowEngine) findNodeByID(nodeID string, config *FlowConfig) *FlowNode
 }
 
 func (fe *FlowEngine) ProcessEvent(ctx context.Context, event map[string]interface{}) error {
-	// Получаем активные потоки из базы данных
-	flows, err := fe.repo.GetIntegrationFlows(ctx)
-	if err != nil {
-		return fmt.Errorf("failed to get flows: %w", err)
+	// Удаленная сделка больше не должна продолжать отложенные запуски,
+	// даже если потоки загрузить не удалось
+	if eventType, _ := event["event_type"].(string); eventType == "lead.delete" {
+		fe.cancelPendingRuns(ctx, event)
 	}
 
-	// Обрабатываем событие через каждый активный поток
-	for _, flow := range flows {
-		if !flow.IsActive {
-			continue
-		}
+	// Индекс триггеров опубликованных версий активных потоков, черновики не выполняются
+	index, err := fe.activeTriggers(ctx)
+	if err != nil {
+		return err
+	}
 
+	// Обрабатываем событие через каждый поток, чей триггер подходит под событие,
+	// в порядке приоритета
+flows:
+	for _, compiled := range index.match(event) {
+		flow := compiled.flow
 		fe.logger.Info("Processing event through flow",
 			zap.String("flow_id", flow.ID),
-			zap.String("flow_name", flow.Name))
+			zap.String("flow_name", flow.Name),
+			zap.Int("flow_version", flow.PublishedVersion))
+
+		// Выполняем поток, записывая трассировку выполнения
+		execution := newExecution(flow.ID, event)
+		execution.flowData = flow.FlowData
+		execution.FlowVersion = flow.PublishedVersion
+
+		claimed := false
+		if compiled.dedup.enabled {
+			execution.IdempotencyKey = compiled.dedup.key(flow.ID, event)
+			if fe.dedup != nil {
+				ok, original, err := fe.dedup.claim(ctx, execution.IdempotencyKey, execution.ID, compiled.dedup.ttl)
+				switch {
+				case err != nil:
+					// Redis недоступен - лучше выполнить поток повторно, чем потерять событие
+					fe.logger.Warn("Failed to check idempotency key, running flow",
+						zap.String("flow_id", flow.ID),
+						zap.Error(err))
+				case !ok:
+					fe.logger.Info("Skipping duplicate event",
+						zap.String("flow_id", flow.ID),
+						zap.String("idempotency_key", execution.IdempotencyKey),
+						zap.String("duplicate_of", original))
+					execution.finishDuplicate(original)
+					fe.saveExecution(ctx, execution)
+
+					// Первый запуск мог остановить следующие потоки - повтор не должен их запускать
+					if compiled.canStop {
+						break flows
+					}
+					continue
+				default:
+					claimed = true
+				}
+			}
+		}
 
-		// Выполняем поток
-		if _, err := fe.ExecuteFlow(ctx, flow.FlowData, event); err != nil {
+		// Узлы меняют данные запуска - каждый поток получает свою копию события,
+		// а трассировка и ключ идемпотентности видят событие без изменений
+		matched, err := fe.executeConfig(withExecution(ctx, execution), compiled.config, copyData(event))
+		execution.finish(matched, err)
+		if err != nil {
 			fe.logger.Error("Failed to execute flow",
 				zap.String("flow_id", flow.ID),
 				zap.Error(err))
+
+			// Упавший запуск не должен блокировать повторную доставку события
+			if claimed {
+				if err := fe.dedup.release(ctx, execution.IdempotencyKey, execution.ID); err != nil {
+					fe.logger.Warn("Failed to release idempotency key", zap.Error(err))
+				}
+			}
 			// Продолжаем с другими потоками
 		}
+
+		fe.saveExecution(ctx, execution)
+
+		if err == nil && matched && (flow.StopProcessing || execution.stopProcessing) {
+			fe.logger.Info("Flow stopped processing of further flows",
+				zap.String("flow_id", flow.ID),
+				zap.String("execution_id", execution.ID))
+			break
+		}
 	}
 
 	return nil
 }
+
+func (fe *FlowEngine) saveExecution(ctx context.Context, execution *Execution) {
+	model, err := execution.toModel()
+	if err != nil {
+		fe.logger.Error("Failed to serialize flow execution",
+			zap.String("execution_id", execution.ID),
+			zap.Error(err))
+		return
+	}
+
+	if err := fe.repo.CreateFlowExecution(ctx, model); err != nil {
+		fe.logger.Error("Failed to save flow execution",
+			zap.String("execution_id", execution.ID),
+			zap.String("flow_id", execution.FlowID),
+			zap.Error(err))
+	}
+}
@@ -0,0 +1,143 @@
+package flowengine
+
+import (
+	"context"
+	"fmt"
+)
+
+// Узел enrich загружает из AmoCRM данные, которых нет в событии:
+//
+//	"data": {"load": ["contact", "contacts", "company", "responsible_user"]}
+//
+// contact - основной контакт сделки в формате события lead.add ({{contact.phone}},
+// {{contact.email}}, contact.custom_fields), contacts - все контакты сделки,
+// company - компания, responsible_user - ответственный пользователь. Результат
+// записывается в данные запуска под этими именами, отсутствующая сущность - null.
+// Ответы CRM кешируются в пределах запуска: contact и contacts делят один запрос,
+// повторный enrich в том же запуске не расходует квоту API.
+
+var enrichTargets = map[string]bool{
+	"contact":          true,
+	"contacts":         true,
+	"company":          true,
+	"responsible_user": true,
+}
+
+func parseEnrichTargets(data map[string]interface{}) ([]string, error) {
+	items, _ := data["load"].([]interface{})
+	if len(items) == 0 {
+		return nil, fmt.Errorf("enrich node has nothing to load")
+	}
+
+	targets := make([]string, 0, len(items))
+	for _, item := range items {
+		target, _ := item.(string)
+		if !enrichTargets[target] {
+			return nil, fmt.Errorf("unknown enrich target %v", item)
+		}
+		targets = append(targets, target)
+	}
+	return targets, nil
+}
+
+// SetCRMLookup sets the client enrich nodes load contacts, companies and users with
+func (fe *FlowEngine) SetCRMLookup(crm CRMLookup) {
+	fe.crm = crm
+}
+
+// executeEnrich загружает сущности узла и записывает их в data
+func (fe *FlowEngine) executeEnrich(ctx context.Context, step *ExecutionStep, node *FlowNode, data map[string]interface{}) error {
+	targets, err := parseEnrichTargets(node.Data)
+	if err != nil {
+		return err
+	}
+
+	if fe.crm == nil {
+		// Симуляция без CRM работает с данными примера события
+		if fe.dryRun {
+			step.setDetail("skipped", true)
+			return nil
+		}
+		return fmt.Errorf("enrich node requires a CRM client")
+	}
+
+	leadID, _ := toFloat64(data["lead_id"])
+	if leadID == 0 {
+		return fmt.Errorf("event has no lead_id")
+	}
+	lead := int64(leadID)
+
+	execution := executionFromContext(ctx)
+	var cached []string
+
+	for _, target := range targets {
+		var (
+			value interface{}
+			hit   bool
+			err   error
+		)
+
+		switch target {
+		case "contact", "contacts":
+			value, hit, err = execution.lookup(fmt.Sprintf("contacts:%d", lead), func() (interface{}, error) {
+				return fe.crm.GetLeadContacts(ctx, lead)
+			})
+			if err == nil && target == "contact" {
+				value = mainContact(value.([]interface{}))
+				data["has_contact"] = value != nil
+			}
+		case "company":
+			value, hit, err = execution.lookup(fmt.Sprintf("company:%d", lead), func() (interface{}, error) {
+				// Отсутствующая сущность кешируется как null, а не как пустая карта с типом
+				company, err := fe.crm.GetLeadCompany(ctx, lead)
+				if company == nil {
+					return nil, err
+				}
+				return company, err
+			})
+		case "responsible_user":
+			userID, _ := toFloat64(data["responsible_user_id"])
+			if userID == 0 {
+				break
+			}
+			value, hit, err = execution.lookup(fmt.Sprintf("user:%d", int64(userID)), func() (interface{}, error) {
+				user, err := fe.crm.GetUser(ctx, int64(userID))
+				if user == nil {
+					return nil, err
+				}
+				return user, err
+			})
+		}
+
+		if err != nil {
+			return fmt.Errorf("failed to load %s: %w", target, err)
+		}
+		if hit {
+			cached = append(cached, target)
+		}
+
+		// Копия, чтобы ветки запуска не делили кешированные карты
+		data[target] = copyValue(value)
+	}
+
+	step.setDetail("loaded", targets)
+	if len(cached) > 0 {
+		step.setDetail("cached", cached)
+	}
+	return nil
+}
+
+// mainContact возвращает основной контакт сделки или первый, если основной не отмечен
+func mainContact(contacts []interface{}) interface{} {
+	for _, contact := range contacts {
+		if c, ok := contact.(map[string]interface{}); ok {
+			if isMain, _ := c["is_main"].(bool); isMain {
+				return c
+			}
+		}
+	}
+	if len(contacts) > 0 {
+		return contacts[0]
+	}
+	return nil
+}
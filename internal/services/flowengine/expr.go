@@ -0,0 +1,951 @@
+package flowengine
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Выражения узла set:
+//
+//	100 - dial_attempts * 10
+//	substr(contact.phone, 1, 4)
+//	add_days(now(), 3)
+//	custom_fields["Город"] == "Москва" && price > 10000
+//
+// Переменные - пути по данным запуска, как в шаблонах, отсутствующая переменная
+// равна null. Операторы: + - * / % == != < <= > >= && || ! и скобки.
+// Арифметика приводит строки к числам, + с нечисловой строкой склеивает
+// строки, склеить строки из цифр можно через concat.
+// Функции перечислены в exprFunctions, if и default вычисляют только нужный
+// аргумент. Выражение видит только данные запуска, циклов в языке нет.
+
+const (
+	maxExpressionLength = 2000
+	maxExpressionDepth  = 32
+	// maxRoundPlaces ограничивает точность round: 10^places не должно переполняться
+	maxRoundPlaces = 15
+)
+
+type exprNode interface {
+	eval(data map[string]interface{}) (interface{}, error)
+}
+
+type exprLiteral struct {
+	value interface{}
+}
+
+type exprVariable struct {
+	path string
+}
+
+type exprIndex struct {
+	target exprNode
+	index  exprNode
+}
+
+type exprUnary struct {
+	op      string
+	operand exprNode
+}
+
+type exprBinary struct {
+	op          string
+	left, right exprNode
+}
+
+type exprCall struct {
+	name string
+	args []exprNode
+}
+
+// exprFunction - функция выражений и допустимое число аргументов, max -1 - без ограничения
+type exprFunction struct {
+	min, max int
+	call     func(args []interface{}) (interface{}, error)
+}
+
+// exprFunctions - функции выражений. if и default вычисляет exprCall
+var exprFunctions = map[string]exprFunction{
+	"if":      {3, 3, nil},
+	"default": {2, 2, nil},
+
+	"len":         {1, 1, exprLen},
+	"upper":       {1, 1, stringFunc(strings.ToUpper)},
+	"lower":       {1, 1, stringFunc(strings.ToLower)},
+	"trim":        {1, 1, stringFunc(strings.TrimSpace)},
+	"digits":      {1, 1, stringFunc(onlyDigits)},
+	"substr":      {2, 3, exprSubstr},
+	"replace":     {3, 3, exprReplace},
+	"concat":      {1, -1, exprConcat},
+	"contains":    {2, 2, exprContains},
+	"starts_with": {2, 2, exprStartsWith},
+	"ends_with":   {2, 2, exprEndsWith},
+	"string":      {1, 1, func(args []interface{}) (interface{}, error) { return templateString(args[0]), nil }},
+	"number":      {1, 1, func(args []interface{}) (interface{}, error) { return exprNumber(args[0]) }},
+
+	"round": {1, 2, exprRound},
+	"floor": {1, 1, numberFunc(math.Floor)},
+	"ceil":  {1, 1, numberFunc(math.Ceil)},
+	"abs":   {1, 1, numberFunc(math.Abs)},
+	"min":   {1, -1, func(args []interface{}) (interface{}, error) { return exprExtreme(args, -1) }},
+	"max":   {1, -1, func(args []interface{}) (interface{}, error) { return exprExtreme(args, 1) }},
+
+	"now":          {0, 0, func([]interface{}) (interface{}, error) { return time.Now(), nil }},
+	"today":        {0, 0, exprToday},
+	"date":         {1, 1, func(args []interface{}) (interface{}, error) { return exprTime(args[0]) }},
+	"add_days":     {2, 2, addDuration(24 * time.Hour)},
+	"add_hours":    {2, 2, addDuration(time.Hour)},
+	"add_minutes":  {2, 2, addDuration(time.Minute)},
+	"days_between": {2, 2, exprDaysBetween},
+	"hour":         {1, 1, exprHour},
+	"weekday":      {1, 1, exprWeekday},
+	"timestamp":    {1, 1, exprTimestamp},
+	"format_date":  {1, 2, exprFormatDate},
+}
+
+// parseExpression разбирает выражение в дерево
+func parseExpression(s string) (exprNode, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, fmt.Errorf("empty expression")
+	}
+	if len(s) > maxExpressionLength {
+		return nil, fmt.Errorf("expression is longer than %d characters", maxExpressionLength)
+	}
+
+	tokens, err := lexExpression(s)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &exprParser{tokens: tokens}
+	node, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != tokenEOF {
+		return nil, fmt.Errorf("unexpected %q at position %d", tok.text, tok.pos)
+	}
+	return node, nil
+}
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenNumber
+	tokenString
+	tokenIdent
+	tokenOp
+)
+
+type exprToken struct {
+	kind  tokenKind
+	text  string
+	value interface{}
+	pos   int
+}
+
+// exprOperators - операторы от длинных к коротким, чтобы <= не разбиралось как <
+var exprOperators = []string{"==", "!=", "<=", ">=", "&&", "||", "+", "-", "*", "/", "%", "<", ">", "!", "(", ")", "[", "]", ","}
+
+func lexExpression(s string) ([]exprToken, error) {
+	var tokens []exprToken
+
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+
+		switch {
+		case unicode.IsSpace(r):
+			i += size
+
+		case r >= '0' && r <= '9':
+			start := i
+			for i < len(s) && (s[i] >= '0' && s[i] <= '9' || s[i] == '.') {
+				i++
+			}
+			value, err := strconv.ParseFloat(s[start:i], 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid number %q at position %d", s[start:i], start)
+			}
+			tokens = append(tokens, exprToken{kind: tokenNumber, text: s[start:i], value: value, pos: start})
+
+		case r == '"' || r == '\'':
+			start := i
+			var value strings.Builder
+			i += size
+			closed := false
+			for i < len(s) {
+				c, n := utf8.DecodeRuneInString(s[i:])
+				i += n
+				if c == r {
+					closed = true
+					break
+				}
+				if c == '\\' && i < len(s) {
+					c, n = utf8.DecodeRuneInString(s[i:])
+					i += n
+				}
+				value.WriteRune(c)
+			}
+			if !closed {
+				return nil, fmt.Errorf("unclosed string at position %d", start)
+			}
+			tokens = append(tokens, exprToken{kind: tokenString, text: s[start:i], value: value.String(), pos: start})
+
+		case r == '_' || unicode.IsLetter(r):
+			// Путь переменной: contact.phone, contact_ids.0
+			start := i
+			for i < len(s) {
+				c, n := utf8.DecodeRuneInString(s[i:])
+				if c == '.' && i+n < len(s) {
+					next, _ := utf8.DecodeRuneInString(s[i+n:])
+					if isIdentRune(next) {
+						i += n
+						continue
+					}
+				}
+				if !isIdentRune(c) {
+					break
+				}
+				i += n
+			}
+			tokens = append(tokens, exprToken{kind: tokenIdent, text: s[start:i], pos: start})
+
+		default:
+			op := ""
+			for _, candidate := range exprOperators {
+				if strings.HasPrefix(s[i:], candidate) {
+					op = candidate
+					break
+				}
+			}
+			if op == "" {
+				return nil, fmt.Errorf("unexpected character %q at position %d", r, i)
+			}
+			tokens = append(tokens, exprToken{kind: tokenOp, text: op, pos: i})
+			i += len(op)
+		}
+	}
+
+	return append(tokens, exprToken{kind: tokenEOF, text: "end of expression", pos: len(s)}), nil
+}
+
+func isIdentRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+type exprParser struct {
+	tokens []exprToken
+	pos    int
+	depth  int
+}
+
+func (p *exprParser) peek() exprToken {
+	return p.tokens[p.pos]
+}
+
+func (p *exprParser) next() exprToken {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokenEOF {
+		p.pos++
+	}
+	return tok
+}
+
+// accept съедает оператор, если он следующий
+func (p *exprParser) accept(ops ...string) (string, bool) {
+	tok := p.peek()
+	if tok.kind != tokenOp {
+		return "", false
+	}
+	for _, op := range ops {
+		if tok.text == op {
+			p.pos++
+			return op, true
+		}
+	}
+	return "", false
+}
+
+func (p *exprParser) expect(op string) error {
+	if _, ok := p.accept(op); !ok {
+		tok := p.peek()
+		return fmt.Errorf("expected %q, got %q at position %d", op, tok.text, tok.pos)
+	}
+	return nil
+}
+
+// binary разбирает левоассоциативную цепочку операторов одного приоритета
+func (p *exprParser) binary(operand func() (exprNode, error), ops ...string) (exprNode, error) {
+	left, err := operand()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op, ok := p.accept(ops...)
+		if !ok {
+			return left, nil
+		}
+		right, err := operand()
+		if err != nil {
+			return nil, err
+		}
+		left = &exprBinary{op: op, left: left, right: right}
+	}
+}
+
+func (p *exprParser) parseOr() (exprNode, error) {
+	p.depth++
+	defer func() { p.depth-- }()
+	if p.depth > maxExpressionDepth {
+		return nil, fmt.Errorf("expression is nested deeper than %d levels", maxExpressionDepth)
+	}
+
+	return p.binary(p.parseAnd, "||")
+}
+
+func (p *exprParser) parseAnd() (exprNode, error) {
+	return p.binary(p.parseEquality, "&&")
+}
+
+func (p *exprParser) parseEquality() (exprNode, error) {
+	return p.binary(p.parseComparison, "==", "!=")
+}
+
+func (p *exprParser) parseComparison() (exprNode, error) {
+	return p.binary(p.parseAdditive, "<=", ">=", "<", ">")
+}
+
+func (p *exprParser) parseAdditive() (exprNode, error) {
+	return p.binary(p.parseMultiplicative, "+", "-")
+}
+
+func (p *exprParser) parseMultiplicative() (exprNode, error) {
+	return p.binary(p.parseUnary, "*", "/", "%")
+}
+
+func (p *exprParser) parseUnary() (exprNode, error) {
+	if op, ok := p.accept("-", "!"); ok {
+		p.depth++
+		defer func() { p.depth-- }()
+		if p.depth > maxExpressionDepth {
+			return nil, fmt.Errorf("expression is nested deeper than %d levels", maxExpressionDepth)
+		}
+
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &exprUnary{op: op, operand: operand}, nil
+	}
+
+	node, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+
+	// custom_fields["Город"], contact_ids[0]
+	for {
+		if _, ok := p.accept("["); !ok {
+			return node, nil
+		}
+		index, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect("]"); err != nil {
+			return nil, err
+		}
+		node = &exprIndex{target: node, index: index}
+	}
+}
+
+func (p *exprParser) parsePrimary() (exprNode, error) {
+	tok := p.next()
+
+	switch tok.kind {
+	case tokenNumber, tokenString:
+		return &exprLiteral{value: tok.value}, nil
+
+	case tokenIdent:
+		switch tok.text {
+		case "true":
+			return &exprLiteral{value: true}, nil
+		case "false":
+			return &exprLiteral{value: false}, nil
+		case "null":
+			return &exprLiteral{value: nil}, nil
+		}
+
+		if _, ok := p.accept("("); !ok {
+			return &exprVariable{path: tok.text}, nil
+		}
+		return p.parseCall(tok)
+
+	case tokenOp:
+		if tok.text == "(" {
+			node, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(")"); err != nil {
+				return nil, err
+			}
+			return node, nil
+		}
+	}
+
+	return nil, fmt.Errorf("unexpected %q at position %d", tok.text, tok.pos)
+}
+
+func (p *exprParser) parseCall(name exprToken) (exprNode, error) {
+	function, ok := exprFunctions[name.text]
+	if !ok {
+		return nil, fmt.Errorf("unknown function %q at position %d", name.text, name.pos)
+	}
+
+	call := &exprCall{name: name.text}
+	if _, ok := p.accept(")"); !ok {
+		for {
+			arg, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			call.args = append(call.args, arg)
+
+			if _, ok := p.accept(","); ok {
+				continue
+			}
+			if err := p.expect(")"); err != nil {
+				return nil, err
+			}
+			break
+		}
+	}
+
+	if len(call.args) < function.min || (function.max >= 0 && len(call.args) > function.max) {
+		return nil, fmt.Errorf("wrong number of arguments for function %q", name.text)
+	}
+	return call, nil
+}
+
+func (e *exprLiteral) eval(map[string]interface{}) (interface{}, error) {
+	return e.value, nil
+}
+
+func (e *exprVariable) eval(data map[string]interface{}) (interface{}, error) {
+	value, _ := lookupPath(e.path, data)
+	return value, nil
+}
+
+func (e *exprIndex) eval(data map[string]interface{}) (interface{}, error) {
+	target, err := e.target.eval(data)
+	if err != nil {
+		return nil, err
+	}
+	index, err := e.index.eval(data)
+	if err != nil {
+		return nil, err
+	}
+
+	switch t := target.(type) {
+	case map[string]interface{}:
+		return t[templateString(index)], nil
+	case []interface{}:
+		i, err := toFloat64(index)
+		if err != nil || i < 0 || int(i) >= len(t) {
+			return nil, nil
+		}
+		return t[int(i)], nil
+	default:
+		return nil, nil
+	}
+}
+
+func (e *exprUnary) eval(data map[string]interface{}) (interface{}, error) {
+	value, err := e.operand.eval(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if e.op == "!" {
+		return !truthy(value), nil
+	}
+	n, err := exprNumber(value)
+	if err != nil {
+		return nil, fmt.Errorf("operator -: %w", err)
+	}
+	return finiteNumber(-n)
+}
+
+func (e *exprBinary) eval(data map[string]interface{}) (interface{}, error) {
+	left, err := e.left.eval(data)
+	if err != nil {
+		return nil, err
+	}
+
+	// Логические операторы не вычисляют правую часть без необходимости
+	switch e.op {
+	case "&&":
+		if !truthy(left) {
+			return false, nil
+		}
+		right, err := e.right.eval(data)
+		return truthy(right), err
+	case "||":
+		if truthy(left) {
+			return true, nil
+		}
+		right, err := e.right.eval(data)
+		return truthy(right), err
+	}
+
+	right, err := e.right.eval(data)
+	if err != nil {
+		return nil, err
+	}
+
+	switch e.op {
+	case "==":
+		return exprEqual(left, right), nil
+	case "!=":
+		return !exprEqual(left, right), nil
+	case "<", "<=", ">", ">=":
+		cmp, err := exprCompare(left, right)
+		if err != nil {
+			return nil, fmt.Errorf("operator %s: %w", e.op, err)
+		}
+		switch e.op {
+		case "<":
+			return cmp < 0, nil
+		case "<=":
+			return cmp <= 0, nil
+		case ">":
+			return cmp > 0, nil
+		default:
+			return cmp >= 0, nil
+		}
+	case "+":
+		// Значения кастомных полей приходят строками, поэтому "100" + 1 - это 101
+		_, leftErr := exprNumber(left)
+		_, rightErr := exprNumber(right)
+		_, leftString := left.(string)
+		_, rightString := right.(string)
+		if (leftString && leftErr != nil) || (rightString && rightErr != nil) {
+			return templateString(left) + templateString(right), nil
+		}
+	}
+
+	a, err := exprNumber(left)
+	if err != nil {
+		return nil, fmt.Errorf("operator %s: %w", e.op, err)
+	}
+	b, err := exprNumber(right)
+	if err != nil {
+		return nil, fmt.Errorf("operator %s: %w", e.op, err)
+	}
+
+	var result float64
+	switch e.op {
+	case "+":
+		result = a + b
+	case "-":
+		result = a - b
+	case "*":
+		result = a * b
+	case "/":
+		if b == 0 {
+			return nil, fmt.Errorf("division by zero")
+		}
+		result = a / b
+	case "%":
+		if b == 0 {
+			return nil, fmt.Errorf("division by zero")
+		}
+		result = math.Mod(a, b)
+	default:
+		return nil, fmt.Errorf("unknown operator %s", e.op)
+	}
+
+	value, err := finiteNumber(result)
+	if err != nil {
+		return nil, fmt.Errorf("operator %s: %w", e.op, err)
+	}
+	return value, nil
+}
+
+func (e *exprCall) eval(data map[string]interface{}) (interface{}, error) {
+	switch e.name {
+	case "if":
+		cond, err := e.args[0].eval(data)
+		if err != nil {
+			return nil, err
+		}
+		if truthy(cond) {
+			return e.args[1].eval(data)
+		}
+		return e.args[2].eval(data)
+	case "default":
+		value, err := e.args[0].eval(data)
+		if err != nil {
+			return nil, err
+		}
+		if !isEmptyParam(value) {
+			return value, nil
+		}
+		return e.args[1].eval(data)
+	}
+
+	args := make([]interface{}, len(e.args))
+	for i, arg := range e.args {
+		value, err := arg.eval(data)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = value
+	}
+
+	value, err := exprFunctions[e.name].call(args)
+	if err != nil {
+		return nil, fmt.Errorf("%s(): %w", e.name, err)
+	}
+	return value, nil
+}
+
+func truthy(value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		return false
+	case bool:
+		return v
+	case string:
+		return v != ""
+	case time.Time:
+		return !v.IsZero()
+	}
+	if n, err := toFloat64(value); err == nil {
+		return n != 0
+	}
+	return !isEmptyParam(value)
+}
+
+// exprNumber приводит значение к числу, строки разбираются
+func exprNumber(value interface{}) (float64, error) {
+	switch v := value.(type) {
+	case nil:
+		return 0, fmt.Errorf("value is null")
+	case bool:
+		return 0, fmt.Errorf("expected a number, got a boolean")
+	case string:
+		n, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		if err != nil || math.IsNaN(n) || math.IsInf(n, 0) {
+			return 0, fmt.Errorf("%q is not a number", v)
+		}
+		return n, nil
+	case int32:
+		return float64(v), nil
+	}
+
+	n, err := toFloat64(value)
+	if err != nil {
+		return 0, fmt.Errorf("expected a number, got %T", value)
+	}
+	if math.IsNaN(n) || math.IsInf(n, 0) {
+		return 0, fmt.Errorf("value is not a finite number")
+	}
+	return n, nil
+}
+
+// finiteNumber не пускает NaN и бесконечность в данные запуска: их нельзя
+// сохранить в JSON трассировки и команд
+func finiteNumber(n float64) (interface{}, error) {
+	if math.IsNaN(n) || math.IsInf(n, 0) {
+		return nil, fmt.Errorf("result is not a finite number")
+	}
+	return n, nil
+}
+
+// exprTime приводит значение к времени: время, unix timestamp или строка с датой
+func exprTime(value interface{}) (time.Time, error) {
+	switch v := value.(type) {
+	case nil:
+		return time.Time{}, fmt.Errorf("value is null")
+	case time.Time:
+		return v, nil
+	}
+	if t, ok := toTime(value); ok {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("%q is not a date", templateString(value))
+}
+
+func exprEqual(a, b interface{}) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	if ta, ok := a.(time.Time); ok {
+		tb, err := exprTime(b)
+		return err == nil && ta.Equal(tb)
+	}
+	if tb, ok := b.(time.Time); ok {
+		ta, err := exprTime(a)
+		return err == nil && ta.Equal(tb)
+	}
+	if ba, ok := a.(bool); ok {
+		bb, ok := b.(bool)
+		return ok && ba == bb
+	}
+
+	// Числа из JSON и из строк сравниваются как числа: "100" == 100
+	if na, err := exprNumber(a); err == nil {
+		if nb, err := exprNumber(b); err == nil {
+			return na == nb
+		}
+	}
+	return templateString(a) == templateString(b)
+}
+
+func exprCompare(a, b interface{}) (int, error) {
+	if a == nil || b == nil {
+		return 0, fmt.Errorf("value is null")
+	}
+
+	_, aTime := a.(time.Time)
+	_, bTime := b.(time.Time)
+	if aTime || bTime {
+		ta, err := exprTime(a)
+		if err != nil {
+			return 0, err
+		}
+		tb, err := exprTime(b)
+		if err != nil {
+			return 0, err
+		}
+		return ta.Compare(tb), nil
+	}
+
+	if na, err := exprNumber(a); err == nil {
+		if nb, err := exprNumber(b); err == nil {
+			switch {
+			case na < nb:
+				return -1, nil
+			case na > nb:
+				return 1, nil
+			}
+			return 0, nil
+		}
+	}
+	return strings.Compare(templateString(a), templateString(b)), nil
+}
+
+func stringFunc(fn func(string) string) func([]interface{}) (interface{}, error) {
+	return func(args []interface{}) (interface{}, error) {
+		return fn(templateString(args[0])), nil
+	}
+}
+
+func numberFunc(fn func(float64) float64) func([]interface{}) (interface{}, error) {
+	return func(args []interface{}) (interface{}, error) {
+		n, err := exprNumber(args[0])
+		if err != nil {
+			return nil, err
+		}
+		return finiteNumber(fn(n))
+	}
+}
+
+func onlyDigits(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, s)
+}
+
+func exprLen(args []interface{}) (interface{}, error) {
+	switch v := args[0].(type) {
+	case nil:
+		return float64(0), nil
+	case []interface{}:
+		return float64(len(v)), nil
+	case map[string]interface{}:
+		return float64(len(v)), nil
+	default:
+		return float64(utf8.RuneCountInString(templateString(v))), nil
+	}
+}
+
+// exprSubstr вырезает подстроку по символам: substr(s, start, length), start с нуля
+func exprSubstr(args []interface{}) (interface{}, error) {
+	runes := []rune(templateString(args[0]))
+
+	start, err := exprNumber(args[1])
+	if err != nil {
+		return nil, err
+	}
+	from := int(math.Max(0, math.Min(start, float64(len(runes)))))
+
+	to := len(runes)
+	if len(args) > 2 {
+		length, err := exprNumber(args[2])
+		if err != nil {
+			return nil, err
+		}
+		if length < 0 {
+			return nil, fmt.Errorf("length must not be negative")
+		}
+		if float64(from)+length < float64(to) {
+			to = from + int(length)
+		}
+	}
+
+	return string(runes[from:to]), nil
+}
+
+func exprReplace(args []interface{}) (interface{}, error) {
+	return strings.ReplaceAll(templateString(args[0]), templateString(args[1]), templateString(args[2])), nil
+}
+
+func exprConcat(args []interface{}) (interface{}, error) {
+	var result strings.Builder
+	for _, arg := range args {
+		result.WriteString(templateString(arg))
+	}
+	return result.String(), nil
+}
+
+func exprContains(args []interface{}) (interface{}, error) {
+	return contains(templateString(args[0]), templateString(args[1])), nil
+}
+
+func exprStartsWith(args []interface{}) (interface{}, error) {
+	return strings.HasPrefix(strings.ToLower(templateString(args[0])), strings.ToLower(templateString(args[1]))), nil
+}
+
+func exprEndsWith(args []interface{}) (interface{}, error) {
+	return strings.HasSuffix(strings.ToLower(templateString(args[0])), strings.ToLower(templateString(args[1]))), nil
+}
+
+// exprRound округляет до places знаков после запятой, отрицательные places
+// округляют до десятков, сотен и т.д.
+func exprRound(args []interface{}) (interface{}, error) {
+	n, err := exprNumber(args[0])
+	if err != nil {
+		return nil, err
+	}
+	places := 0.0
+	if len(args) > 1 {
+		if places, err = exprNumber(args[1]); err != nil {
+			return nil, err
+		}
+	}
+	if math.Abs(places) > maxRoundPlaces {
+		return nil, fmt.Errorf("places must be between -%d and %d", maxRoundPlaces, maxRoundPlaces)
+	}
+
+	scale := math.Pow(10, math.Trunc(places))
+	rounded := math.Round(n*scale) / scale
+	// n*scale переполняется для больших n - такие числа уже целые на этой точности
+	if math.IsInf(n*scale, 0) {
+		rounded = n
+	}
+	return finiteNumber(rounded)
+}
+
+// exprExtreme возвращает минимум (sign -1) или максимум (sign 1) аргументов
+func exprExtreme(args []interface{}, sign float64) (interface{}, error) {
+	var result float64
+	for i, arg := range args {
+		n, err := exprNumber(arg)
+		if err != nil {
+			return nil, err
+		}
+		if i == 0 || (n-result)*sign > 0 {
+			result = n
+		}
+	}
+	return result, nil
+}
+
+func exprToday([]interface{}) (interface{}, error) {
+	now := time.Now()
+	return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location()), nil
+}
+
+func addDuration(unit time.Duration) func([]interface{}) (interface{}, error) {
+	return func(args []interface{}) (interface{}, error) {
+		t, err := exprTime(args[0])
+		if err != nil {
+			return nil, err
+		}
+		n, err := exprNumber(args[1])
+		if err != nil {
+			return nil, err
+		}
+		// Дни прибавляются по календарю, чтобы переход на летнее время не сдвигал часы
+		if unit == 24*time.Hour && n == math.Trunc(n) {
+			return t.AddDate(0, 0, int(n)), nil
+		}
+		return t.Add(time.Duration(n * float64(unit))), nil
+	}
+}
+
+// exprDaysBetween - число полных дней от первой даты до второй
+func exprDaysBetween(args []interface{}) (interface{}, error) {
+	from, err := exprTime(args[0])
+	if err != nil {
+		return nil, err
+	}
+	to, err := exprTime(args[1])
+	if err != nil {
+		return nil, err
+	}
+	return math.Trunc(to.Sub(from).Hours() / 24), nil
+}
+
+func exprHour(args []interface{}) (interface{}, error) {
+	t, err := exprTime(args[0])
+	if err != nil {
+		return nil, err
+	}
+	return float64(t.Hour()), nil
+}
+
+// exprWeekday - день недели от 1 (понедельник) до 7 (воскресенье)
+func exprWeekday(args []interface{}) (interface{}, error) {
+	t, err := exprTime(args[0])
+	if err != nil {
+		return nil, err
+	}
+	weekday := int(t.Weekday())
+	if weekday == 0 {
+		weekday = 7
+	}
+	return float64(weekday), nil
+}
+
+func exprTimestamp(args []interface{}) (interface{}, error) {
+	t, err := exprTime(args[0])
+	if err != nil {
+		return nil, err
+	}
+	return float64(t.Unix()), nil
+}
+
+func exprFormatDate(args []interface{}) (interface{}, error) {
+	t, err := exprTime(args[0])
+	if err != nil {
+		return nil, err
+	}
+	layout := defaultTemplateDateLayout
+	if len(args) > 1 {
+		layout = templateString(args[1])
+	}
+	return t.Format(layout), nil
+}
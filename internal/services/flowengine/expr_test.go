@@ -0,0 +1,276 @@
+package flowengine
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// exprTestData - данные запуска, на которых вычисляются выражения тестов
+func exprTestData() map[string]interface{} {
+	return map[string]interface{}{
+		"price":         float64(15000),
+		"dial_attempts": float64(3),
+		"name":          "Иван",
+		"budget":        "100",
+		"zero":          float64(0),
+		"huge":          float64(1e308),
+		"empty":         "",
+		"flag":          true,
+		"contact": map[string]interface{}{
+			"phone": "+7 (912) 345-67-89",
+		},
+		"custom_fields": map[string]interface{}{
+			"Город": "Москва",
+		},
+		"contact_ids": []interface{}{float64(11), float64(22)},
+		// Понедельник
+		"created": time.Date(2024, 1, 15, 10, 30, 0, 0, time.Local),
+		"closed":  time.Date(2024, 1, 18, 9, 0, 0, 0, time.Local),
+	}
+}
+
+func evalExpression(t *testing.T, expression string) (interface{}, error) {
+	t.Helper()
+
+	node, err := parseExpression(expression)
+	if err != nil {
+		return nil, err
+	}
+	return node.eval(exprTestData())
+}
+
+type exprTestCase struct {
+	expression string
+	want       interface{}
+}
+
+func runExprCases(t *testing.T, cases []exprTestCase) {
+	t.Helper()
+
+	for _, tc := range cases {
+		t.Run(tc.expression, func(t *testing.T) {
+			got, err := evalExpression(t, tc.expression)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if want, ok := tc.want.(time.Time); ok {
+				if got, ok := got.(time.Time); !ok || !got.Equal(want) {
+					t.Fatalf("got %v, want %v", got, want)
+				}
+				return
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("got %#v, want %#v", got, tc.want)
+			}
+		})
+	}
+}
+
+func runExprErrors(t *testing.T, cases []exprTestCase) {
+	t.Helper()
+
+	for _, tc := range cases {
+		t.Run(tc.expression, func(t *testing.T) {
+			got, err := evalExpression(t, tc.expression)
+			if err == nil {
+				t.Fatalf("expected an error, got %#v", got)
+			}
+			if want, _ := tc.want.(string); !strings.Contains(err.Error(), want) {
+				t.Fatalf("error %q does not contain %q", err, want)
+			}
+		})
+	}
+}
+
+func TestExpressionPrecedence(t *testing.T) {
+	runExprCases(t, []exprTestCase{
+		{"1 + 2 * 3", float64(7)},
+		{"(1 + 2) * 3", float64(9)},
+		{"10 - 4 - 3", float64(3)},
+		{"12 / 3 / 2", float64(2)},
+		{"7 % 4 * 2", float64(6)},
+		{"-2 * 3", float64(-6)},
+		{"--2", float64(2)},
+		{"100 - dial_attempts * 10", float64(70)},
+		{"1 + 1 == 2", true},
+		{"1 < 2 == true", true},
+		{"true || false && false", true},
+		{"(true || false) && false", false},
+		{"!true || true", true},
+		{"!(1 > 2)", true},
+		{"price > 10000 && custom_fields[\"Город\"] == \"Москва\"", true},
+		{"contact_ids[1] - contact_ids[0]", float64(11)},
+		{"contact.phone == '+7 (912) 345-67-89'", true},
+	})
+}
+
+func TestExpressionNull(t *testing.T) {
+	runExprCases(t, []exprTestCase{
+		{"missing", nil},
+		{"null", nil},
+		{"missing == null", true},
+		{"missing != 0", true},
+		{"null == null", true},
+		{"!missing", true},
+		{"missing && flag", false},
+		{"missing || flag", true},
+		{"contact_ids[5]", nil},
+		{"custom_fields[\"Нет\"]", nil},
+		{"default(missing, 5) + 1", float64(6)},
+		{"default(empty, 'x')", "x"},
+		{"len(missing)", float64(0)},
+	})
+
+	runExprErrors(t, []exprTestCase{
+		{"missing + 1", "value is null"},
+		{"-missing", "value is null"},
+		{"missing < 1", "value is null"},
+		{"round(missing)", "value is null"},
+	})
+}
+
+func TestExpressionArithmeticErrors(t *testing.T) {
+	runExprErrors(t, []exprTestCase{
+		{"1 / 0", "division by zero"},
+		{"price / zero", "division by zero"},
+		{"5 % 0", "division by zero"},
+		{"huge * 10", "not a finite number"},
+		{"-huge - huge", "not a finite number"},
+		{"number('NaN')", "is not a number"},
+		{"number('Inf') + 1", "is not a number"},
+		{"flag * 2", "boolean"},
+		{"round(2.555, 400)", "places must be between"},
+		{"round(2.555, -16)", "places must be between"},
+	})
+}
+
+func TestExpressionStrings(t *testing.T) {
+	runExprCases(t, []exprTestCase{
+		{"'a' + \"b\"", "ab"},
+		{"name + ' ' + 'Петров'", "Иван Петров"},
+		{"budget + 1", float64(101)},
+		{"'abc' + 1", "abc1"},
+		{"1 + 'abc'", "1abc"},
+		{"concat(budget, 1)", "1001"},
+		{"'it\\'s'", "it's"},
+		{"budget == 100", true},
+		{"'b' > 'a'", true},
+	})
+}
+
+func TestExpressionFunctions(t *testing.T) {
+	created := time.Date(2024, 1, 15, 10, 30, 0, 0, time.Local)
+
+	runExprCases(t, []exprTestCase{
+		{"if(price > 10000, 'big', 'small')", "big"},
+		{"if(missing, 1 / 0, 2)", float64(2)},
+		{"default(name, 1 / 0)", "Иван"},
+
+		{"len(name)", float64(4)},
+		{"len(contact_ids)", float64(2)},
+		{"len(custom_fields)", float64(1)},
+		{"upper(name)", "ИВАН"},
+		{"lower('ABC')", "abc"},
+		{"trim('  x ')", "x"},
+		{"digits(contact.phone)", "79123456789"},
+		{"substr(digits(contact.phone), 1, 3)", "912"},
+		{"substr(name, 2)", "ан"},
+		{"substr(name, 10, 2)", ""},
+		{"substr(name, 0, 100)", "Иван"},
+		{"replace('a-b-c', '-', '')", "abc"},
+		{"concat('a', 1, true)", "a1true"},
+		{"contains(name, 'ВА')", true},
+		{"starts_with(contact.phone, '+7')", true},
+		{"ends_with(name, 'АН')", true},
+		{"string(price)", "15000"},
+		{"number(budget)", float64(100)},
+
+		{"round(1.25, 1)", float64(1.3)},
+		{"round(2.5)", float64(3)},
+		{"round(1234, -2)", float64(1200)},
+		{"round(huge, 2)", float64(1e308)},
+		{"floor(2.7)", float64(2)},
+		{"ceil(2.1)", float64(3)},
+		{"abs(-5)", float64(5)},
+		{"min(3, 1, 2)", float64(1)},
+		{"max(3, budget, 2)", float64(100)},
+
+		{"date(created)", created},
+		{"date(1705311000)", time.Unix(1705311000, 0)},
+		{"add_days(created, 3)", created.AddDate(0, 0, 3)},
+		{"add_hours(created, 2)", created.Add(2 * time.Hour)},
+		{"add_minutes(created, -30)", created.Add(-30 * time.Minute)},
+		{"days_between(created, closed)", float64(2)},
+		{"hour(created)", float64(10)},
+		{"weekday(created)", float64(1)},
+		{"weekday(add_days(created, 6))", float64(7)},
+		{"timestamp(created)", float64(created.Unix())},
+		{"format_date(created)", "15.01.2024 10:30"},
+		{"format_date(created, '2006-01-02')", "2024-01-15"},
+		{"created < closed", true},
+	})
+
+	runExprErrors(t, []exprTestCase{
+		{"number('abc')", "is not a number"},
+		{"substr(name, 0, -1)", "must not be negative"},
+		{"date('soon')", "is not a date"},
+		{"hour(name)", "is not a date"},
+	})
+}
+
+func TestExpressionNowAndToday(t *testing.T) {
+	now, err := evalExpression(t, "now()")
+	if err != nil {
+		t.Fatalf("now(): %v", err)
+	}
+	if nowTime, ok := now.(time.Time); !ok || time.Since(nowTime) > time.Minute {
+		t.Fatalf("now() returned %#v", now)
+	}
+
+	today, err := evalExpression(t, "today()")
+	if err != nil {
+		t.Fatalf("today(): %v", err)
+	}
+	todayTime, ok := today.(time.Time)
+	if !ok || todayTime.Hour() != 0 || todayTime.Minute() != 0 || time.Since(todayTime) > 24*time.Hour {
+		t.Fatalf("today() returned %#v", today)
+	}
+}
+
+func TestParseExpressionErrors(t *testing.T) {
+	cases := []struct {
+		expression string
+		want       string
+	}{
+		{"", "empty expression"},
+		{"1 +", "unexpected"},
+		{"(1 + 2", "expected \")\""},
+		{"'unclosed", "unclosed string"},
+		{"1 $ 2", "unexpected character"},
+		{"1.2.3", "invalid number"},
+		{"1 2", "unexpected"},
+		{"unknown(1)", "unknown function"},
+		{"len()", "wrong number of arguments"},
+		{"if(1, 2)", "wrong number of arguments"},
+		{strings.Repeat("(", 40) + "1" + strings.Repeat(")", 40), "nested deeper"},
+		{strings.Repeat("1+", maxExpressionLength), "longer than"},
+	}
+
+	for _, tc := range cases {
+		name := tc.expression
+		if len(name) > 20 {
+			name = name[:20]
+		}
+		t.Run(name, func(t *testing.T) {
+			_, err := parseExpression(tc.expression)
+			if err == nil {
+				t.Fatalf("expected an error")
+			}
+			if !strings.Contains(err.Error(), tc.want) {
+				t.Fatalf("error %q does not contain %q", err, tc.want)
+			}
+		})
+	}
+}
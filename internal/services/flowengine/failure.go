@@ -0,0 +1,206 @@
+package flowengine
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Политика ошибок узла action задается в data:
+//
+//	"on_error": "continue"
+//	"on_error": {"policy": "retry", "retries": 3, "backoff": "2s", "then": "error_edge"}
+//
+// stop - запуск завершается ошибкой, continue - выполнение идет дальше по
+// обычным ребрам, error_edge - только по ребрам с типом "error", retry -
+// повтор с экспоненциальной задержкой, после последней попытки применяется then.
+// По умолчанию узел с ребрами error следует по ним, остальные останавливаются.
+// На продолжающихся ветках ошибка доступна в переменной error:
+// {{error.message}}, {{error.node_id}}, {{error.action_type}}, {{error.attempts}}.
+
+const (
+	failureStop      = "stop"
+	failureContinue  = "continue"
+	failureRetry     = "retry"
+	failureErrorEdge = "error_edge"
+
+	// errorEdgeType - тип ребер, по которым идет выполнение после ошибки
+	errorEdgeType = "error"
+
+	defaultRetryBackoff = time.Second
+	maxActionRetries    = 10
+	maxRetryBackoff     = time.Minute
+	// maxActionTime ограничивает время действия со всеми повторами. Запуск
+	// выполняется в обработчике события, а продолжение после delay должно
+	// закончиться намного раньше staleRunTimeout, иначе планировщик заберет его повторно
+	maxActionTime = 2 * time.Minute
+)
+
+type failurePolicy struct {
+	policy  string
+	retries int
+	backoff time.Duration
+	then    string
+}
+
+// parseFailurePolicy читает on_error узла. hasErrorEdges задает политику по умолчанию
+func parseFailurePolicy(data map[string]interface{}, hasErrorEdges bool) (*failurePolicy, error) {
+	fallback := failureStop
+	if hasErrorEdges {
+		fallback = failureErrorEdge
+	}
+	policy := &failurePolicy{policy: fallback, backoff: defaultRetryBackoff, then: fallback}
+
+	switch raw := data["on_error"].(type) {
+	case nil:
+		return policy, nil
+	case string:
+		if raw != "" {
+			policy.policy = raw
+		}
+	case map[string]interface{}:
+		if name, _ := raw["policy"].(string); name != "" {
+			policy.policy = name
+		}
+		if then, _ := raw["then"].(string); then != "" {
+			policy.then = then
+		}
+		if value, ok := raw["retries"]; ok {
+			retries, err := toFloat64(value)
+			if err != nil || retries < 0 || retries > maxActionRetries || retries != float64(int(retries)) {
+				return nil, fmt.Errorf("on_error retries must be an integer between 0 and %d", maxActionRetries)
+			}
+			policy.retries = int(retries)
+		}
+		if value, ok := raw["backoff"].(string); ok && value != "" {
+			backoff, err := time.ParseDuration(value)
+			if err != nil || backoff <= 0 || backoff > maxRetryBackoff {
+				return nil, fmt.Errorf("on_error backoff must be a duration up to %s", maxRetryBackoff)
+			}
+			policy.backoff = backoff
+		}
+	default:
+		return nil, fmt.Errorf("on_error must be a policy name or an object")
+	}
+
+	switch policy.policy {
+	case failureStop, failureContinue, failureErrorEdge:
+	case failureRetry:
+		if policy.retries == 0 {
+			policy.retries = 1
+		}
+		switch policy.then {
+		case failureStop, failureContinue, failureErrorEdge:
+		default:
+			return nil, fmt.Errorf("unknown on_error then %q", policy.then)
+		}
+	default:
+		return nil, fmt.Errorf("unknown on_error policy %q", policy.policy)
+	}
+
+	return policy, nil
+}
+
+// final - политика, применяемая когда попытки исчерпаны
+func (p *failurePolicy) final() string {
+	if p.policy == failureRetry {
+		return p.then
+	}
+	return p.policy
+}
+
+// runAction выполняет действие, повторяя его по политике retry. Все попытки
+// вместе с паузами укладываются в maxActionTime
+func (fe *FlowEngine) runAction(ctx context.Context, step *ExecutionStep, node *FlowNode, policy *failurePolicy, data map[string]interface{}) (int, error) {
+	attempts := 1
+	if policy.policy == failureRetry {
+		attempts += policy.retries
+	}
+
+	deadline := time.Now().Add(maxActionTime)
+	ctx, cancel := context.WithDeadline(ctx, deadline)
+	defer cancel()
+
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		if err = fe.executeAction(ctx, node.Data, data); err == nil {
+			return attempt, nil
+		}
+		if attempt == attempts {
+			return attempt, err
+		}
+
+		backoff := policy.backoff << (attempt - 1)
+		if backoff > maxRetryBackoff || backoff <= 0 {
+			backoff = maxRetryBackoff
+		}
+		step.setDetail("last_error", err.Error())
+
+		// Симуляция не ждет между попытками
+		if fe.dryRun {
+			continue
+		}
+		// Следующая попытка не успеет до конца отведенного времени
+		if time.Now().Add(backoff).After(deadline) {
+			step.setDetail("retry_time_exceeded", true)
+			return attempt, err
+		}
+		select {
+		case <-ctx.Done():
+			return attempt, ctx.Err()
+		case <-time.After(backoff):
+		}
+	}
+
+	return attempts, err
+}
+
+// handleActionError применяет политику к ошибке действия
+func (fe *FlowEngine) handleActionError(ctx context.Context, step *ExecutionStep, node *FlowNode, config *FlowConfig, policy *failurePolicy, attempts int, actionErr error, data map[string]interface{}) (bool, error) {
+	final := policy.final()
+	step.setDetail("on_error", final)
+
+	if final == failureStop {
+		return false, actionErr
+	}
+
+	actionType, _ := node.Data["type"].(string)
+	data["error"] = map[string]interface{}{
+		"message":     actionErr.Error(),
+		"node_id":     node.ID,
+		"action_type": actionType,
+		"attempts":    attempts,
+	}
+
+	if final == failureContinue {
+		return fe.followEdges(ctx, step, node, config, data)
+	}
+
+	edges := errorEdges(outgoingEdges(node.ID, config))
+	if len(edges) == 0 {
+		return false, fmt.Errorf("%w (node has no error edge)", actionErr)
+	}
+	return fe.fanOut(ctx, step, node, config, edges, data)
+}
+
+// errorEdges отбирает ребра с типом error
+func errorEdges(edges []FlowEdge) []FlowEdge {
+	var result []FlowEdge
+	for _, edge := range edges {
+		if edge.Type == errorEdgeType {
+			result = append(result, edge)
+		}
+	}
+	return result
+}
+
+// regularEdges отбирает ребра без типа error и overflow
+func regularEdges(edges []FlowEdge) []FlowEdge {
+	var result []FlowEdge
+	for _, edge := range edges {
+		if edge.Type != errorEdgeType && edge.Type != overflowEdgeType {
+			result = append(result, edge)
+		}
+	}
+	return result
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"github.com/google/uuid"
 	"go.uber.org/zap"
 	"strconv"
 	"strings"
@@ -12,6 +13,18 @@ import (
 func (fe *FlowEngine) executeAction(ctx context.Context, actionData, inputData map[string]interface{}) error {
 	actionType, _ := actionData["type"].(string)
 
+	// Подставляем переменные события в строковые параметры
+	actionData, missing, err := renderParams(actionData, inputData)
+	if err != nil {
+		return fmt.Errorf("failed to render action params: %w", err)
+	}
+	if len(missing) > 0 {
+		stepFromContext(ctx).setDetail("missing_variables", missing)
+		fe.logger.Warn("Template variables not found in event data",
+			zap.String("action_type", actionType),
+			zap.Strings("variables", missing))
+	}
+
 	switch actionType {
 	case "send_to_dialer":
 		return fe.sendToDialer(ctx, actionData, inputData)
@@ -19,6 +32,10 @@ func (fe *FlowEngine) executeAction(ctx context.Context, actionData, inputData m
 		return fe.updateLead(ctx, actionData, inputData)
 	case "add_note":
 		return fe.addNote(ctx, actionData, inputData)
+	case "create_task":
+		return fe.createTask(ctx, actionData, inputData)
+	case "http_request":
+		return fe.httpRequest(ctx, actionData, inputData)
 	case "add_to_bucket":
 		return fe.addToBucket(ctx, actionData, inputData)
 	case "change_priority":
@@ -64,7 +81,7 @@ func (fe *FlowEngine) sendToDialer(ctx context.Context, actionData, inputData ma
 	}
 
 	// Отправляем через NATS если подключен
-	if fe.nc != nil {
+	if fe.publisher != nil {
 		message := map[string]interface{}{
 			"scheduler_id": schedulerID,
 			"campaign_id":  campaignID,
@@ -72,13 +89,8 @@ func (fe *FlowEngine) sendToDialer(ctx context.Context, actionData, inputData ma
 			"contact":      contact,
 		}
 
-		data, err := json.Marshal(message)
-		if err != nil {
-			return fmt.Errorf("failed to marshal message: %w", err)
-		}
-
-		if err := fe.nc.Publish("dialer.send_contact", data); err != nil {
-			return fmt.Errorf("failed to publish to NATS: %w", err)
+		if err := fe.publish(ctx, "dialer.send_contact", message); err != nil {
+			return err
 		}
 
 		fe.logger.Info("Contact sent to dialer queue")
@@ -115,19 +127,14 @@ func (fe *FlowEngine) updateLead(ctx context.Context, actionData, inputData map[
 	}
 
 	// Отправляем через NATS если подключен
-	if fe.nc != nil {
+	if fe.publisher != nil {
 		message := map[string]interface{}{
 			"action": "update_lead",
 			"data":   updateData,
 		}
 
-		data, err := json.Marshal(message)
-		if err != nil {
-			return fmt.Errorf("failed to marshal message: %w", err)
-		}
-
-		if err := fe.nc.Publish("crm.update_lead", data); err != nil {
-			return fmt.Errorf("failed to publish to NATS: %w", err)
+		if err := fe.publish(ctx, "crm.update_lead", message); err != nil {
+			return err
 		}
 
 		fe.logger.Info("Lead update request sent")
@@ -184,7 +191,7 @@ func (fe *FlowEngine) addToBucket(ctx context.Context, actionData, inputData map
 	}
 
 	// Отправляем через NATS если подключен
-	if fe.nc != nil {
+	if fe.publisher != nil {
 		message := map[string]interface{}{
 			"action":         "add_to_bucket",
 			"bucket_id":      bucketID,
@@ -194,13 +201,8 @@ func (fe *FlowEngine) addToBucket(ctx context.Context, actionData, inputData map
 			"contact":        contact,
 		}
 
-		data, err := json.Marshal(message)
-		if err != nil {
-			return fmt.Errorf("failed to marshal message: %w", err)
-		}
-
-		if err := fe.nc.Publish("dialer.add_to_bucket", data); err != nil {
-			return fmt.Errorf("failed to publish to NATS: %w", err)
+		if err := fe.publish(ctx, "dialer.add_to_bucket", message); err != nil {
+			return err
 		}
 
 		fe.logger.Info("Contact sent to bucket")
@@ -218,20 +220,15 @@ func (fe *FlowEngine) changePriority(ctx context.Context, actionData, inputData
 		zap.Float64("new_priority", priority))
 
 	// Отправляем через NATS если подключен
-	if fe.nc != nil {
+	if fe.publisher != nil {
 		message := map[string]interface{}{
 			"action":   "change_priority",
 			"lead_id":  leadID,
 			"priority": int(priority),
 		}
 
-		data, err := json.Marshal(message)
-		if err != nil {
-			return fmt.Errorf("failed to marshal message: %w", err)
-		}
-
-		if err := fe.nc.Publish("dialer.change_priority", data); err != nil {
-			return fmt.Errorf("failed to publish to NATS: %w", err)
+		if err := fe.publish(ctx, "dialer.change_priority", message); err != nil {
+			return err
 		}
 
 		fe.logger.Info("Lead change priority sent")
@@ -249,20 +246,15 @@ func (fe *FlowEngine) changeSchedulerStep(ctx context.Context, actionData, input
 		zap.Float64("new_scheduler_step", schedulerStep))
 
 	// Отправляем через NATS если подключен
-	if fe.nc != nil {
+	if fe.publisher != nil {
 		message := map[string]interface{}{
 			"action":         "change_scheduler_step",
 			"lead_id":        leadID,
 			"scheduler_step": int(schedulerStep),
 		}
 
-		data, err := json.Marshal(message)
-		if err != nil {
-			return fmt.Errorf("failed to marshal message: %w", err)
-		}
-
-		if err := fe.nc.Publish("dialer.change_scheduler_step", data); err != nil {
-			return fmt.Errorf("failed to publish to NATS: %w", err)
+		if err := fe.publish(ctx, "dialer.change_scheduler_step", message); err != nil {
+			return err
 		}
 
 		fe.logger.Info("Lead change scheduler step sent")
@@ -278,19 +270,14 @@ func (fe *FlowEngine) removeFromDialer(ctx context.Context, inputData map[string
 		zap.Float64("lead_id", leadID))
 
 	// Отправляем через NATS если подключен
-	if fe.nc != nil {
+	if fe.publisher != nil {
 		message := map[string]interface{}{
 			"action":  "remove_from_dialer",
 			"lead_id": leadID,
 		}
 
-		data, err := json.Marshal(message)
-		if err != nil {
-			return fmt.Errorf("failed to marshal message: %w", err)
-		}
-
-		if err := fe.nc.Publish("dialer.remove_from_dialer", data); err != nil {
-			return fmt.Errorf("failed to publish to NATS: %w", err)
+		if err := fe.publish(ctx, "dialer.remove_from_dialer", message); err != nil {
+			return err
 		}
 
 		fe.logger.Info("Lead remove from dialer sent")
@@ -301,13 +288,139 @@ func (fe *FlowEngine) removeFromDialer(ctx context.Context, inputData map[string
 
 func (fe *FlowEngine) addNote(ctx context.Context, actionData, inputData map[string]interface{}) error {
 	leadID, _ := inputData["lead_id"].(float64)
-	noteText, _ := actionData["text"].(string)
+	noteType, _ := actionData["note_type"].(string)
+	if noteType == "" {
+		noteType = "common"
+	}
 
-	fe.logger.Info("Adding note to lead",
-		zap.Float64("lead_id", leadID),
-		zap.String("note", noteText))
+	// По умолчанию примечание добавляется в сделку, entity: "contact" - в контакт
+	entityType := "leads"
+	entityID := int(leadID)
+	if entity, _ := actionData["entity"].(string); entity == "contact" {
+		entityType = "contacts"
+		entityID = eventContactID(inputData)
+		if entityID == 0 {
+			return fmt.Errorf("event has no contact to add the note to")
+		}
+	}
+
+	params := noteParams(noteType, actionData, inputData)
+
+	fe.logger.Info("Adding note",
+		zap.String("entity_type", entityType),
+		zap.Int("entity_id", entityID),
+		zap.String("note_type", noteType))
+
+	// Отправляем через NATS если подключен, примечание добавит crm-service
+	if fe.publisher != nil {
+		executionID, stepID := runReference(ctx)
+		message := map[string]interface{}{
+			"action":       "add_note",
+			"entity_type":  entityType,
+			"entity_id":    entityID,
+			"note_type":    noteType,
+			"params":       params,
+			"execution_id": executionID,
+			"step_id":      stepID,
+		}
+
+		if err := fe.publish(ctx, "crm.add_note", message); err != nil {
+			return err
+		}
+
+		fe.logger.Info("Add note request sent")
+	}
+
+	return nil
+}
+
+// noteParams собирает params примечания AmoCRM для его типа
+func noteParams(noteType string, actionData, inputData map[string]interface{}) map[string]interface{} {
+	text, _ := actionData["text"].(string)
+
+	switch noteType {
+	case "service_message":
+		service, _ := actionData["service"].(string)
+		if service == "" {
+			service = "CRM Dialer"
+		}
+		return map[string]interface{}{
+			"service": service,
+			"text":    text,
+		}
 
-	// TODO: Implement actual CRM API call
+	case "call_in", "call_out":
+		uniq, _ := actionData["uniq"].(string)
+		if uniq == "" {
+			uniq = uuid.New().String()
+		}
+		source, _ := actionData["source"].(string)
+		if source == "" {
+			source = "CRM Dialer"
+		}
+		phone, _ := actionData["phone"].(string)
+		if phone == "" {
+			if contact, ok := inputData["contact"].(map[string]interface{}); ok {
+				phone, _ = contact["phone"].(string)
+			}
+		}
+		duration, _ := toFloat64(actionData["duration"])
+
+		params := map[string]interface{}{
+			"uniq":     uniq,
+			"duration": int(duration),
+			"source":   source,
+			"phone":    phone,
+		}
+		if link, _ := actionData["link"].(string); link != "" {
+			params["link"] = link
+		}
+		return params
+
+	default:
+		return map[string]interface{}{
+			"text": text,
+		}
+	}
+}
+
+// eventContactID возвращает ID основного контакта сделки из события
+func eventContactID(inputData map[string]interface{}) int {
+	if contact, ok := inputData["contact"].(map[string]interface{}); ok {
+		if id, err := toFloat64(contact["id"]); err == nil && id > 0 {
+			return int(id)
+		}
+	}
+	if id, err := toFloat64(inputData["contact_id"]); err == nil && id > 0 {
+		return int(id)
+	}
+	if ids, ok := inputData["contact_ids"].([]interface{}); ok && len(ids) > 0 {
+		if id, err := toFloat64(ids[0]); err == nil {
+			return int(id)
+		}
+	}
+	return 0
+}
+
+// publish отправляет сообщение в NATS и записывает его в текущий шаг выполнения
+func (fe *FlowEngine) publish(ctx context.Context, subject string, message interface{}) error {
+	// Команды несут ключ идемпотентности, чтобы получатели могли отсеять повторы
+	if command, ok := message.(map[string]interface{}); ok {
+		if key := commandKey(ctx); key != "" {
+			command["idempotency_key"] = key
+		}
+	}
+
+	data, err := json.Marshal(message)
+	if err != nil {
+		return fmt.Errorf("failed to marshal message: %w", err)
+	}
+
+	if err := fe.publisher.Publish(subject, data); err != nil {
+		return fmt.Errorf("failed to publish to NATS: %w", err)
+	}
+
+	stepFromContext(ctx).recordMessage(subject, data)
 	return nil
 }
 
@@ -350,6 +463,25 @@ func toFloat64(val interface{}) (float64, error) {
 	}
 }
 
+// formatValue приводит значение к строке для сравнения. Числа печатаются без
+// экспоненты, так что ID 47123456 из JSON совпадает со строкой "47123456"
+func formatValue(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case float32:
+		return strconv.FormatFloat(float64(v), 'f', -1, 32)
+	case int:
+		return strconv.Itoa(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
+
 func contains(haystack, needle string) bool {
 	return strings.Contains(strings.ToLower(haystack), strings.ToLower(needle))
 }
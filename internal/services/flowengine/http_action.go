@@ -0,0 +1,327 @@
+package flowengine
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	defaultHTTPTimeout     = 10 * time.Second
+	maxHTTPTimeout         = time.Minute
+	defaultHTTPRetryDelay  = time.Second
+	maxHTTPRetries         = 5
+	maxHTTPResponseSize    = 1 << 20
+	defaultHTTPResultKey   = "http_response"
+	defaultSignatureHeader = "X-Signature"
+)
+
+var httpActionClient = &http.Client{}
+
+var httpMethods = map[string]bool{
+	http.MethodGet:    true,
+	http.MethodPost:   true,
+	http.MethodPut:    true,
+	http.MethodPatch:  true,
+	http.MethodDelete: true,
+}
+
+var hmacAlgorithms = map[string]func() hash.Hash{
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+	"sha512": sha512.New,
+}
+
+// httpRequest вызывает внешний URL:
+//
+//	"type": "http_request", "method": "POST", "url": "https://bi.example.com/events",
+//	"headers": {"Authorization": "Bearer ..."}, "body": {"lead_id": "{{lead_id}}"},
+//	"timeout": "10s", "retries": 2, "retry_delay": "1s",
+//	"hmac": {"secret_env": "BI_WEBHOOK_SECRET", "header": "X-Signature", "algorithm": "sha256"},
+//	"save_as": "bi", "response_fields": {"ticket_id": "data.id"}
+//
+// Статус ответа и выбранные поля JSON сохраняются в данные запуска под ключом
+// save_as, следующие узлы проверяют их как поля "bi.status", "bi.ticket_id".
+// Ошибкой считается только неудачная отправка: любой полученный статус сохраняется.
+func (fe *FlowEngine) httpRequest(ctx context.Context, actionData, inputData map[string]interface{}) error {
+	request, err := parseHTTPAction(actionData)
+	if err != nil {
+		return err
+	}
+
+	step := stepFromContext(ctx)
+	step.setDetail("method", request.method)
+	step.setDetail("url", request.url)
+
+	// Симуляция не вызывает внешний сервис, а записывает запрос как сообщение
+	if fe.dryRun {
+		inputData[request.saveAs] = map[string]interface{}{"skipped": true}
+		if fe.publisher == nil {
+			return nil
+		}
+		var body interface{} = string(request.body)
+		if json.Valid(request.body) {
+			body = json.RawMessage(request.body)
+		}
+		return fe.publish(ctx, "http_request", map[string]interface{}{
+			"method": request.method,
+			"url":    request.url,
+			"body":   body,
+		})
+	}
+
+	var resp *httpActionResponse
+	attempts := 0
+	for {
+		attempts++
+		resp, err = request.send(ctx)
+		if !resp.retryable(err) || attempts > request.retries {
+			break
+		}
+
+		fe.logger.Warn("HTTP request failed, retrying",
+			zap.String("url", request.url),
+			zap.Int("attempt", attempts),
+			zap.Error(err))
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(request.retryDelay * time.Duration(attempts)):
+		}
+	}
+
+	step.setDetail("attempts", attempts)
+	if err != nil {
+		return fmt.Errorf("http request to %s failed: %w", request.url, err)
+	}
+	step.setDetail("status", resp.status)
+
+	result := map[string]interface{}{
+		"status": resp.status,
+		"ok":     resp.status >= 200 && resp.status < 300,
+	}
+	if len(request.responseFields) > 0 {
+		var body map[string]interface{}
+		if err := json.Unmarshal(resp.body, &body); err != nil {
+			fe.logger.Warn("HTTP response is not a JSON object",
+				zap.String("url", request.url),
+				zap.Int("status", resp.status))
+		}
+		for name, path := range request.responseFields {
+			if value, ok := lookupPath(path, body); ok {
+				result[name] = value
+			}
+		}
+	}
+	inputData[request.saveAs] = result
+
+	fe.logger.Info("HTTP request sent",
+		zap.String("method", request.method),
+		zap.String("url", request.url),
+		zap.Int("status", resp.status))
+
+	return nil
+}
+
+type httpAction struct {
+	method         string
+	url            string
+	headers        map[string]string
+	body           []byte
+	timeout        time.Duration
+	retries        int
+	retryDelay     time.Duration
+	signer         func() hash.Hash
+	signHeader     string
+	saveAs         string
+	responseFields map[string]string
+}
+
+type httpActionResponse struct {
+	status int
+	body   []byte
+}
+
+// retryable повторяет ошибки отправки, 429 и 5xx
+func (r *httpActionResponse) retryable(err error) bool {
+	if err != nil {
+		return true
+	}
+	return r.status == http.StatusTooManyRequests || r.status >= 500
+}
+
+func parseHTTPAction(actionData map[string]interface{}) (*httpAction, error) {
+	request := &httpAction{
+		method:         http.MethodPost,
+		headers:        make(map[string]string),
+		timeout:        defaultHTTPTimeout,
+		retryDelay:     defaultHTTPRetryDelay,
+		signHeader:     defaultSignatureHeader,
+		saveAs:         defaultHTTPResultKey,
+		responseFields: make(map[string]string),
+	}
+
+	request.url, _ = actionData["url"].(string)
+	if !strings.HasPrefix(request.url, "http://") && !strings.HasPrefix(request.url, "https://") {
+		return nil, fmt.Errorf("http_request url must start with http:// or https://")
+	}
+
+	if method, _ := actionData["method"].(string); method != "" {
+		request.method = strings.ToUpper(method)
+	}
+	if !httpMethods[request.method] {
+		return nil, fmt.Errorf("unsupported http method: %s", request.method)
+	}
+
+	if headers, ok := actionData["headers"].(map[string]interface{}); ok {
+		for name, value := range headers {
+			request.headers[name] = templateString(value)
+		}
+	}
+
+	switch body := actionData["body"].(type) {
+	case nil:
+	case string:
+		request.body = []byte(body)
+	default:
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal http body: %w", err)
+		}
+		request.body = data
+	}
+
+	if value, _ := actionData["timeout"].(string); value != "" {
+		timeout, err := time.ParseDuration(value)
+		if err != nil || timeout <= 0 || timeout > maxHTTPTimeout {
+			return nil, fmt.Errorf("invalid http timeout %q, expected a duration up to %s", value, maxHTTPTimeout)
+		}
+		request.timeout = timeout
+	}
+
+	if value, ok := actionData["retries"]; ok && !isEmptyParam(value) {
+		retries, err := toFloat64(value)
+		if err != nil || retries < 0 || retries > maxHTTPRetries {
+			return nil, fmt.Errorf("http retries must be between 0 and %d", maxHTTPRetries)
+		}
+		request.retries = int(retries)
+	}
+
+	if value, _ := actionData["retry_delay"].(string); value != "" {
+		delay, err := time.ParseDuration(value)
+		if err != nil || delay < 0 {
+			return nil, fmt.Errorf("invalid http retry_delay %q", value)
+		}
+		request.retryDelay = delay
+	}
+
+	if signing, ok := actionData["hmac"].(map[string]interface{}); ok {
+		if err := request.parseSigning(signing); err != nil {
+			return nil, err
+		}
+	}
+
+	if saveAs, _ := actionData["save_as"].(string); saveAs != "" {
+		request.saveAs = saveAs
+	}
+	if fields, ok := actionData["response_fields"].(map[string]interface{}); ok {
+		for name, value := range fields {
+			path, _ := value.(string)
+			if path == "" {
+				return nil, fmt.Errorf("response field %q must be a JSON path", name)
+			}
+			request.responseFields[name] = path
+		}
+	}
+
+	return request, nil
+}
+
+// parseSigning читает секрет из настроек узла или из переменной окружения secret_env,
+// чтобы не хранить его в потоке
+func (r *httpAction) parseSigning(signing map[string]interface{}) error {
+	secret, _ := signing["secret"].(string)
+	if name, _ := signing["secret_env"].(string); name != "" {
+		secret = os.Getenv(name)
+		if secret == "" {
+			return fmt.Errorf("environment variable %s with the hmac secret is empty", name)
+		}
+	}
+	if secret == "" {
+		return fmt.Errorf("hmac requires secret or secret_env")
+	}
+
+	algorithm, _ := signing["algorithm"].(string)
+	if algorithm == "" {
+		algorithm = "sha256"
+	}
+	newHash, ok := hmacAlgorithms[algorithm]
+	if !ok {
+		return fmt.Errorf("unsupported hmac algorithm: %s", algorithm)
+	}
+	r.signer = func() hash.Hash { return hmac.New(newHash, []byte(secret)) }
+
+	if header, _ := signing["header"].(string); header != "" {
+		r.signHeader = header
+	}
+
+	return nil
+}
+
+func (r *httpAction) send(ctx context.Context) (*httpActionResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	var reader io.Reader
+	if len(r.body) > 0 {
+		reader = bytes.NewReader(r.body)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, r.method, r.url, reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	if len(r.body) > 0 {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if key := commandKey(ctx); key != "" {
+		req.Header.Set("Idempotency-Key", key)
+	}
+	for name, value := range r.headers {
+		req.Header.Set(name, value)
+	}
+	if r.signer != nil {
+		mac := r.signer()
+		mac.Write(r.body)
+		req.Header.Set(r.signHeader, hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	resp, err := httpActionClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxHTTPResponseSize))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	return &httpActionResponse{status: resp.StatusCode, body: body}, nil
+}
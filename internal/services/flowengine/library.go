@@ -0,0 +1,300 @@
+package flowengine
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"crm-dialer-integration/internal/models"
+)
+
+// Встроенная библиотека шаблонов потоков. Шаблоны лежат в templates/*.json и
+// встраиваются в бинарник. Параметры подставляются на место строк
+// "$param:<имя>" в flow_data:
+//
+//	"trigger": {"pipelines": ["$param:pipeline"]}
+//
+// Изменение графа шаблона должно сопровождаться увеличением version. Номер
+// версии записывается в flow_data созданного потока ("template").
+
+//go:embed templates/*.json
+var templateFiles embed.FS
+
+const templateParamPrefix = "$param:"
+
+// Типы параметров шаблона
+var templateParamTypes = map[string]bool{
+	"pipeline":  true,
+	"status":    true,
+	"bucket":    true,
+	"scheduler": true,
+	"number":    true,
+	"string":    true,
+}
+
+// FlowTemplate is a parameterized flow from the built-in library
+type FlowTemplate struct {
+	ID          string              `json:"id"`
+	Version     int                 `json:"version"`
+	Name        string              `json:"name"`
+	Description string              `json:"description"`
+	Parameters  []TemplateParameter `json:"parameters"`
+	Flow        TemplateFlow        `json:"flow"`
+}
+
+// TemplateParameter is a value asked from the user when a template is instantiated
+type TemplateParameter struct {
+	Name  string `json:"name"`
+	Type  string `json:"type"`
+	Label string `json:"label"`
+	// Pipeline names the pipeline parameter a status parameter belongs to
+	Pipeline string      `json:"pipeline,omitempty"`
+	Required bool        `json:"required,omitempty"`
+	Default  interface{} `json:"default,omitempty"`
+}
+
+// TemplateFlow is the flow a template instantiates into
+type TemplateFlow struct {
+	Name           string          `json:"name"`
+	StopProcessing bool            `json:"stop_processing,omitempty"`
+	FlowData       json.RawMessage `json:"flow_data"`
+}
+
+var (
+	templatesOnce sync.Once
+	templates     []*FlowTemplate
+	templatesErr  error
+)
+
+// FlowTemplates returns the built-in templates ordered by id
+func FlowTemplates() ([]*FlowTemplate, error) {
+	templatesOnce.Do(func() {
+		templates, templatesErr = loadFlowTemplates()
+	})
+	return templates, templatesErr
+}
+
+// GetFlowTemplate returns the built-in template with the id, or nil
+func GetFlowTemplate(id string) (*FlowTemplate, error) {
+	list, err := FlowTemplates()
+	if err != nil {
+		return nil, err
+	}
+	for _, template := range list {
+		if template.ID == id {
+			return template, nil
+		}
+	}
+	return nil, nil
+}
+
+func loadFlowTemplates() ([]*FlowTemplate, error) {
+	files, err := templateFiles.ReadDir("templates")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read flow templates: %w", err)
+	}
+
+	list := make([]*FlowTemplate, 0, len(files))
+	for _, file := range files {
+		content, err := templateFiles.ReadFile("templates/" + file.Name())
+		if err != nil {
+			return nil, fmt.Errorf("failed to read flow template %s: %w", file.Name(), err)
+		}
+
+		var template FlowTemplate
+		if err := json.Unmarshal(content, &template); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal flow template %s: %w", file.Name(), err)
+		}
+		if err := template.check(); err != nil {
+			return nil, fmt.Errorf("invalid flow template %s: %w", file.Name(), err)
+		}
+		list = append(list, &template)
+	}
+
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list, nil
+}
+
+// check проверяет, что шаблон описан полностью и использует только объявленные параметры
+func (t *FlowTemplate) check() error {
+	if t.ID == "" || t.Version <= 0 {
+		return fmt.Errorf("template must have an id and a positive version")
+	}
+
+	declared := make(map[string]bool, len(t.Parameters))
+	for _, param := range t.Parameters {
+		if !templateParamTypes[param.Type] {
+			return fmt.Errorf("parameter %s has unknown type %q", param.Name, param.Type)
+		}
+		declared[param.Name] = true
+	}
+
+	var graph interface{}
+	if err := json.Unmarshal(t.Flow.FlowData, &graph); err != nil {
+		return fmt.Errorf("failed to unmarshal flow_data: %w", err)
+	}
+
+	var undeclared []string
+	substituteParams(graph, func(name string) (interface{}, bool) {
+		if !declared[name] {
+			undeclared = append(undeclared, name)
+		}
+		return nil, true
+	})
+	if len(undeclared) > 0 {
+		return fmt.Errorf("undeclared parameters: %s", strings.Join(undeclared, ", "))
+	}
+	return nil
+}
+
+// TemplateParamsError lists parameters that are missing or have invalid values
+type TemplateParamsError struct {
+	Params map[string]string `json:"params"`
+}
+
+func (e *TemplateParamsError) Error() string {
+	names := make([]string, 0, len(e.Params))
+	for name, reason := range e.Params {
+		names = append(names, name+": "+reason)
+	}
+	sort.Strings(names)
+	return "invalid template parameters: " + strings.Join(names, "; ")
+}
+
+// Instantiate builds an inactive flow from the template. Missing parameters
+// take their defaults. A *TemplateParamsError is returned for missing or
+// invalid values.
+func (t *FlowTemplate) Instantiate(name string, params map[string]interface{}) (*models.IntegrationFlow, error) {
+	values := make(map[string]interface{}, len(t.Parameters))
+	invalid := make(map[string]string)
+
+	for _, param := range t.Parameters {
+		raw, ok := params[param.Name]
+		if !ok || isEmptyParam(raw) {
+			raw = param.Default
+		}
+		if isEmptyParam(raw) {
+			if param.Required {
+				invalid[param.Name] = "required"
+			}
+			continue
+		}
+
+		value, err := templateParamValue(param.Type, raw)
+		if err != nil {
+			invalid[param.Name] = err.Error()
+			continue
+		}
+		values[param.Name] = value
+	}
+	if len(invalid) > 0 {
+		return nil, &TemplateParamsError{Params: invalid}
+	}
+
+	var graph interface{}
+	if err := json.Unmarshal(t.Flow.FlowData, &graph); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal flow config: %w", err)
+	}
+
+	// Необязательный параметр без значения удаляет ключ или элемент списка
+	graph = substituteParams(graph, func(name string) (interface{}, bool) {
+		value, ok := values[name]
+		return value, ok
+	})
+	if object, ok := graph.(map[string]interface{}); ok {
+		object["template"] = map[string]interface{}{"id": t.ID, "version": t.Version}
+	}
+
+	flowData, err := json.Marshal(graph)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal flow config: %w", err)
+	}
+
+	if name == "" {
+		name = t.Flow.Name
+	}
+
+	return &models.IntegrationFlow{
+		ID:             uuid.New().String(),
+		Name:           name,
+		FlowData:       flowData,
+		IsActive:       false,
+		StopProcessing: t.Flow.StopProcessing,
+		CreatedAt:      time.Now(),
+		UpdatedAt:      time.Now(),
+	}, nil
+}
+
+// templateParamValue приводит значение параметра к типу, который читает движок:
+// ID воронок и статусов и числа - float64, остальное - строки
+func templateParamValue(paramType string, raw interface{}) (interface{}, error) {
+	switch paramType {
+	case "pipeline", "status", "number":
+		value, err := toFloat64(raw)
+		if err != nil {
+			return nil, fmt.Errorf("must be a number")
+		}
+		if paramType != "number" && value <= 0 {
+			return nil, fmt.Errorf("must be a positive id")
+		}
+		return value, nil
+	default:
+		switch v := raw.(type) {
+		case string:
+			return v, nil
+		case float64:
+			return strconv.FormatFloat(v, 'f', -1, 64), nil
+		default:
+			return nil, fmt.Errorf("must be a string")
+		}
+	}
+}
+
+// substituteParams заменяет строки "$param:<имя>" значениями resolve. Если
+// значения нет, ключ карты или элемент списка удаляется.
+func substituteParams(value interface{}, resolve func(name string) (interface{}, bool)) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			if name, ok := paramName(item); ok {
+				if replacement, ok := resolve(name); ok {
+					v[key] = replacement
+				} else {
+					delete(v, key)
+				}
+				continue
+			}
+			v[key] = substituteParams(item, resolve)
+		}
+		return v
+	case []interface{}:
+		result := make([]interface{}, 0, len(v))
+		for _, item := range v {
+			if name, ok := paramName(item); ok {
+				if replacement, ok := resolve(name); ok {
+					result = append(result, replacement)
+				}
+				continue
+			}
+			result = append(result, substituteParams(item, resolve))
+		}
+		return result
+	default:
+		return v
+	}
+}
+
+func paramName(value interface{}) (string, bool) {
+	s, ok := value.(string)
+	if !ok || !strings.HasPrefix(s, templateParamPrefix) {
+		return "", false
+	}
+	return strings.TrimPrefix(s, templateParamPrefix), true
+}
@@ -0,0 +1,442 @@
+package flowengine
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"crm-dialer-integration/internal/models"
+	"crm-dialer-integration/internal/repository"
+)
+
+// Переносимые потоки: ID воронок, статусов, полей, корзин, планировщиков и
+// вложенных потоков отличаются между аккаунтами, поэтому при экспорте они
+// заменяются ссылками по имени
+//
+//	{"$ref": "status", "pipeline": "Продажи", "name": "Переговоры"}
+//
+// а при импорте снова разрешаются в ID по синхронизированным таблицам. Ключи
+// полей update_lead становятся "$field:Имя поля". Значения с шаблонами не трогаются.
+
+const (
+	// FlowBundleFormat and FlowBundleVersion identify export bundles
+	FlowBundleFormat  = "crm-dialer-flow"
+	FlowBundleVersion = 1
+
+	refPipeline  = "pipeline"
+	refStatus    = "status"
+	refField     = "field"
+	refBucket    = "bucket"
+	refScheduler = "scheduler"
+	refFlow      = "flow"
+
+	// RefNotFound and RefAmbiguous are the reasons of an UnresolvedRef
+	RefNotFound  = "not_found"
+	RefAmbiguous = "ambiguous"
+
+	fieldKeyPrefix = "$field:"
+	customFieldKey = "field_"
+)
+
+// FlowBundle is a flow exported with names in place of account-specific ids
+type FlowBundle struct {
+	Format         string          `json:"format"`
+	Version        int             `json:"version"`
+	ExportedAt     time.Time       `json:"exported_at"`
+	Name           string          `json:"name"`
+	StopProcessing bool            `json:"stop_processing"`
+	FlowData       json.RawMessage `json:"flow_data"`
+	// Unresolved lists ids missing from the synced tables, they are exported as they are
+	Unresolved []UnresolvedRef `json:"unresolved,omitempty"`
+}
+
+// EntityRef names an entity of the account. Statuses are named within their pipeline.
+type EntityRef struct {
+	Kind     string `json:"$ref"`
+	Name     string `json:"name,omitempty"`
+	Pipeline string `json:"pipeline,omitempty"`
+	ID       string `json:"id,omitempty"`
+}
+
+// UnresolvedRef is a reference that couldn't be mapped between ids and names
+type UnresolvedRef struct {
+	NodeID string    `json:"node_id,omitempty"`
+	EdgeID string    `json:"edge_id,omitempty"`
+	Path   string    `json:"path"`
+	Ref    EntityRef `json:"ref"`
+	Reason string    `json:"reason"`
+}
+
+// ReferenceCatalog maps ids of the synced entities of an account to names and back
+type ReferenceCatalog struct {
+	refs map[string]map[string]EntityRef // тип -> ID -> ссылка
+	ids  map[string]map[string][]string  // тип -> имя -> ID
+}
+
+func NewReferenceCatalog() *ReferenceCatalog {
+	return &ReferenceCatalog{
+		refs: make(map[string]map[string]EntityRef),
+		ids:  make(map[string]map[string][]string),
+	}
+}
+
+// LoadReferenceCatalog reads the synced pipelines with statuses, lead fields,
+// dialer buckets and schedulers and the stored flows
+func LoadReferenceCatalog(ctx context.Context, repo *repository.Repository) (*ReferenceCatalog, error) {
+	catalog := NewReferenceCatalog()
+
+	pipelines, err := repo.GetAmoCRMPipelines(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load pipelines: %w", err)
+	}
+	for _, pipeline := range pipelines {
+		catalog.add(EntityRef{Kind: refPipeline, ID: strconv.FormatInt(pipeline.ID, 10), Name: pipeline.Name})
+		for _, status := range pipeline.Statuses {
+			catalog.add(EntityRef{Kind: refStatus, ID: strconv.FormatInt(status.ID, 10), Name: status.Name, Pipeline: pipeline.Name})
+		}
+	}
+
+	fields, err := repo.GetAmoCRMFields(ctx, "leads")
+	if err != nil {
+		return nil, fmt.Errorf("failed to load fields: %w", err)
+	}
+	for _, field := range fields {
+		catalog.add(EntityRef{Kind: refField, ID: strconv.FormatInt(field.ID, 10), Name: field.Name})
+	}
+
+	buckets, err := repo.GetDialerBuckets(ctx, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to load buckets: %w", err)
+	}
+	for _, bucket := range buckets {
+		catalog.add(EntityRef{Kind: refBucket, ID: bucket.ID, Name: bucket.Name})
+	}
+
+	schedulers, err := repo.GetDialerSchedulers(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load schedulers: %w", err)
+	}
+	for _, scheduler := range schedulers {
+		catalog.add(EntityRef{Kind: refScheduler, ID: scheduler.ID, Name: scheduler.Name})
+	}
+
+	flows, err := repo.GetIntegrationFlows(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load flows: %w", err)
+	}
+	for _, flow := range flows {
+		catalog.add(EntityRef{Kind: refFlow, ID: flow.ID, Name: flow.Name})
+	}
+
+	return catalog, nil
+}
+
+func (c *ReferenceCatalog) add(ref EntityRef) {
+	if c.refs[ref.Kind] == nil {
+		c.refs[ref.Kind] = make(map[string]EntityRef)
+		c.ids[ref.Kind] = make(map[string][]string)
+	}
+	c.refs[ref.Kind][ref.ID] = EntityRef{Kind: ref.Kind, Name: ref.Name, Pipeline: ref.Pipeline}
+
+	c.ids[ref.Kind][refName(ref.Pipeline, ref.Name)] = append(c.ids[ref.Kind][refName(ref.Pipeline, ref.Name)], ref.ID)
+	// Статус можно найти и без воронки, если его имя уникально
+	if ref.Pipeline != "" {
+		c.ids[ref.Kind][refName("", ref.Name)] = append(c.ids[ref.Kind][refName("", ref.Name)], ref.ID)
+	}
+}
+
+func refName(pipeline, name string) string {
+	return pipeline + "\x00" + name
+}
+
+// resolve возвращает ID сущности по ссылке или причину, по которой его нет
+func (c *ReferenceCatalog) resolve(ref EntityRef) (string, string) {
+	ids := c.ids[ref.Kind][refName(ref.Pipeline, ref.Name)]
+	switch len(ids) {
+	case 0:
+		return "", RefNotFound
+	case 1:
+		return ids[0], ""
+	default:
+		return "", RefAmbiguous
+	}
+}
+
+// ExportFlow builds a bundle of the graph with references by name
+func ExportFlow(flow *models.IntegrationFlow, flowData json.RawMessage, catalog *ReferenceCatalog) (*FlowBundle, error) {
+	var graph map[string]interface{}
+	if err := json.Unmarshal(flowData, &graph); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal flow config: %w", err)
+	}
+
+	var unresolved []UnresolvedRef
+	walkRefs(graph, func(site refSite, value interface{}) interface{} {
+		id, ok := site.id(value)
+		if !ok {
+			return value
+		}
+
+		ref, found := catalog.refs[site.kind][id]
+		if !found {
+			unresolved = append(unresolved, site.unresolved(EntityRef{Kind: site.kind, ID: id}, RefNotFound))
+			return value
+		}
+		if site.key {
+			return fieldKeyPrefix + ref.Name
+		}
+
+		object := map[string]interface{}{"$ref": ref.Kind, "name": ref.Name}
+		if ref.Pipeline != "" {
+			object["pipeline"] = ref.Pipeline
+		}
+		return object
+	})
+
+	data, err := json.Marshal(graph)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal flow config: %w", err)
+	}
+
+	return &FlowBundle{
+		Format:         FlowBundleFormat,
+		Version:        FlowBundleVersion,
+		ExportedAt:     time.Now(),
+		Name:           flow.Name,
+		StopProcessing: flow.StopProcessing,
+		FlowData:       data,
+		Unresolved:     unresolved,
+	}, nil
+}
+
+// ImportFlowData replaces references by name with ids of the account. The
+// graph is only usable when no reference is left unresolved.
+func ImportFlowData(flowData json.RawMessage, catalog *ReferenceCatalog) (json.RawMessage, []UnresolvedRef, error) {
+	var graph map[string]interface{}
+	if err := json.Unmarshal(flowData, &graph); err != nil {
+		return nil, nil, fmt.Errorf("failed to unmarshal flow config: %w", err)
+	}
+
+	unresolved := []UnresolvedRef{}
+	walkRefs(graph, func(site refSite, value interface{}) interface{} {
+		ref, ok := site.ref(value)
+		if !ok {
+			return value
+		}
+
+		id, reason := catalog.resolve(ref)
+		if reason != "" {
+			unresolved = append(unresolved, site.unresolved(ref, reason))
+			return value
+		}
+		return site.value(ref.Kind, id)
+	})
+
+	data, err := json.Marshal(graph)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to marshal flow config: %w", err)
+	}
+	return data, unresolved, nil
+}
+
+// refSite - место в графе, где хранится ID сущности
+type refSite struct {
+	kind   string
+	nodeID string
+	edgeID string
+	path   string
+	// prefix - ID поля в условиях записан как ключ custom_fields: field_123
+	prefix string
+	// key - ID поля записан ключом карты fields действия update_lead
+	key bool
+}
+
+// id возвращает ID сущности, если значение - ID, а не ссылка или шаблон
+func (s refSite) id(value interface{}) (string, bool) {
+	var id string
+	switch v := value.(type) {
+	case float64:
+		id = strconv.FormatFloat(v, 'f', -1, 64)
+	case string:
+		id = strings.TrimSpace(v)
+		if strings.Contains(id, "{{") {
+			return "", false
+		}
+		if s.prefix != "" {
+			if !strings.HasPrefix(id, s.prefix) {
+				return "", false
+			}
+			id = strings.TrimPrefix(id, s.prefix)
+		}
+		if s.key {
+			id = strings.TrimPrefix(id, customFieldKey)
+			if _, err := strconv.ParseInt(id, 10, 64); err != nil {
+				return "", false
+			}
+		}
+	default:
+		return "", false
+	}
+
+	if id == "" || id == "0" {
+		return "", false
+	}
+	return id, true
+}
+
+// ref разбирает ссылку по имени из экспортированного графа
+func (s refSite) ref(value interface{}) (EntityRef, bool) {
+	if s.key {
+		name, _ := value.(string)
+		if !strings.HasPrefix(name, fieldKeyPrefix) {
+			return EntityRef{}, false
+		}
+		return EntityRef{Kind: refField, Name: strings.TrimPrefix(name, fieldKeyPrefix)}, true
+	}
+
+	object, ok := value.(map[string]interface{})
+	if !ok {
+		return EntityRef{}, false
+	}
+	kind, _ := object["$ref"].(string)
+	if kind == "" {
+		return EntityRef{}, false
+	}
+	ref := EntityRef{Kind: kind}
+	ref.Name, _ = object["name"].(string)
+	ref.Pipeline, _ = object["pipeline"].(string)
+	return ref, true
+}
+
+// value записывает ID в том виде, в каком его читает движок
+func (s refSite) value(kind, id string) interface{} {
+	switch {
+	case s.key:
+		return id
+	case s.prefix != "":
+		return s.prefix + id
+	case kind == refPipeline || kind == refStatus:
+		if n, err := strconv.ParseInt(id, 10, 64); err == nil {
+			return n
+		}
+	}
+	return id
+}
+
+func (s refSite) unresolved(ref EntityRef, reason string) UnresolvedRef {
+	return UnresolvedRef{NodeID: s.nodeID, EdgeID: s.edgeID, Path: s.path, Ref: ref, Reason: reason}
+}
+
+// refFieldTypes - fieldType условий и switch, значения которых - ID сущностей
+var refFieldTypes = map[string]string{
+	"pipeline":  refPipeline,
+	"status":    refStatus,
+	"bucket":    refBucket,
+	"scheduler": refScheduler,
+}
+
+// walkRefs вызывает fn для каждого ID сущности в графе и записывает на его
+// место результат fn
+func walkRefs(graph map[string]interface{}, fn func(site refSite, value interface{}) interface{}) {
+	nodes, _ := graph["nodes"].([]interface{})
+	edges, _ := graph["edges"].([]interface{})
+
+	for _, raw := range nodes {
+		node, _ := raw.(map[string]interface{})
+		data, _ := node["data"].(map[string]interface{})
+		if data == nil {
+			continue
+		}
+		nodeID, _ := node["id"].(string)
+		nodeType, _ := node["type"].(string)
+
+		switch nodeType {
+		case "start":
+			if trigger, ok := data["trigger"].(map[string]interface{}); ok {
+				visitRefs(trigger, "pipelines", refSite{kind: refPipeline, nodeID: nodeID, path: "data.trigger.pipelines"}, fn)
+				visitRefs(trigger, "statuses", refSite{kind: refStatus, nodeID: nodeID, path: "data.trigger.statuses"}, fn)
+			}
+
+		case "condition":
+			conditionData, ok := data["conditionData"].(map[string]interface{})
+			if !ok {
+				continue
+			}
+			walkRules(conditionData, func(rule map[string]interface{}) {
+				fieldType, _ := rule["fieldType"].(string)
+				if fieldType == "amocrm_field" {
+					visitRefs(rule, "field", refSite{kind: refField, nodeID: nodeID, path: "data.conditionData.field", prefix: customFieldKey}, fn)
+				} else if kind, ok := refFieldTypes[fieldType]; ok {
+					visitRefs(rule, "value", refSite{kind: kind, nodeID: nodeID, path: "data.conditionData.value"}, fn)
+				}
+			})
+
+		case "switch":
+			switchData, _ := data["switchData"].(map[string]interface{})
+			fieldType, _ := switchData["fieldType"].(string)
+			if fieldType == "amocrm_field" {
+				visitRefs(switchData, "field", refSite{kind: refField, nodeID: nodeID, path: "data.switchData.field", prefix: customFieldKey}, fn)
+				continue
+			}
+			kind, ok := refFieldTypes[fieldType]
+			if !ok {
+				continue
+			}
+			for _, rawEdge := range edges {
+				edge, _ := rawEdge.(map[string]interface{})
+				edgeData, _ := edge["data"].(map[string]interface{})
+				if source, _ := edge["source"].(string); source != nodeID || edgeData == nil {
+					continue
+				}
+				edgeID, _ := edge["id"].(string)
+				visitRefs(edgeData, "case", refSite{kind: kind, nodeID: nodeID, edgeID: edgeID, path: "data.case"}, fn)
+			}
+
+		case "action":
+			visitRefs(data, "pipeline_id", refSite{kind: refPipeline, nodeID: nodeID, path: "data.pipeline_id"}, fn)
+			visitRefs(data, "status_id", refSite{kind: refStatus, nodeID: nodeID, path: "data.status_id"}, fn)
+			visitRefs(data, "bucket_id", refSite{kind: refBucket, nodeID: nodeID, path: "data.bucket_id"}, fn)
+			visitRefs(data, "scheduler_id", refSite{kind: refScheduler, nodeID: nodeID, path: "data.scheduler_id"}, fn)
+
+			if fields, ok := data["fields"].(map[string]interface{}); ok {
+				site := refSite{kind: refField, nodeID: nodeID, path: "data.fields", key: true}
+				renamed := make(map[string]interface{}, len(fields))
+				for key, value := range fields {
+					newKey, _ := fn(site, key).(string)
+					renamed[newKey] = value
+				}
+				data["fields"] = renamed
+			}
+
+		case "subflow":
+			visitRefs(data, "flow_id", refSite{kind: refFlow, nodeID: nodeID, path: "data.flow_id"}, fn)
+		}
+	}
+}
+
+// visitRefs применяет fn к значению по ключу или к каждому элементу списка.
+// Списки через запятую ("142, 143") разбиваются.
+func visitRefs(container map[string]interface{}, key string, site refSite, fn func(site refSite, value interface{}) interface{}) {
+	value, ok := container[key]
+	if !ok || value == nil {
+		return
+	}
+
+	if s, ok := value.(string); ok && strings.Contains(s, ",") && !strings.Contains(s, "{{") {
+		value = conditionList(s)
+	}
+
+	list, ok := value.([]interface{})
+	if !ok {
+		container[key] = fn(site, value)
+		return
+	}
+
+	result := make([]interface{}, len(list))
+	for i, item := range list {
+		result[i] = fn(site, item)
+	}
+	container[key] = result
+}
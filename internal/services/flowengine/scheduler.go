@@ -0,0 +1,183 @@
+package flowengine
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"go.uber.org/zap"
+
+	"crm-dialer-integration/internal/models"
+	"crm-dialer-integration/internal/repository"
+)
+
+const (
+	schedulerBatchSize = 100
+	// Запуск, зависший в статусе running дольше этого времени, забирается повторно
+	staleRunTimeout   = 10 * time.Minute
+	maxResumeAttempts = 5
+	resumeRetryDelay  = time.Minute
+)
+
+// Scheduler продолжает запуски, приостановленные delay узлами или
+// поставленные в очередь throttle узлами, когда наступает их время.
+// Состояние хранится в Postgres, поэтому запуски переживают перезапуск сервиса.
+type Scheduler struct {
+	engine   *FlowEngine
+	repo     *repository.Repository
+	leads    LeadFetcher
+	logger   *zap.Logger
+	interval time.Duration
+}
+
+func NewScheduler(engine *FlowEngine, repo *repository.Repository, leads LeadFetcher, logger *zap.Logger, interval time.Duration) *Scheduler {
+	return &Scheduler{
+		engine:   engine,
+		repo:     repo,
+		leads:    leads,
+		logger:   logger,
+		interval: interval,
+	}
+}
+
+// Run проверяет отложенные запуски до отмены контекста
+func (s *Scheduler) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		s.tick(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Scheduler) tick(ctx context.Context) {
+	for {
+		runs, err := s.repo.ClaimDueFlowPendingRuns(ctx, schedulerBatchSize, staleRunTimeout)
+		if err != nil {
+			s.logger.Error("Failed to claim pending flow runs", zap.Error(err))
+			return
+		}
+
+		for _, run := range runs {
+			s.resume(ctx, run)
+		}
+
+		if len(runs) < schedulerBatchSize || ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+func (s *Scheduler) resume(ctx context.Context, run *models.FlowPendingRun) {
+	var data map[string]interface{}
+	if err := json.Unmarshal(run.EventData, &data); err != nil {
+		s.finish(ctx, run, PendingRunFailed, err)
+		return
+	}
+
+	// Поток могли выключить, удалить или опубликовать заново, пока запуск ждал
+	if err := s.engine.checkPendingRunFlow(ctx, run); err != nil {
+		if errors.Is(err, ErrFlowChanged) {
+			s.logger.Info("Pending flow run cancelled",
+				zap.String("pending_run_id", run.ID),
+				zap.String("flow_id", run.FlowID),
+				zap.Error(err))
+			s.finish(ctx, run, PendingRunCancelled, err)
+			return
+		}
+		s.retry(ctx, run, err)
+		return
+	}
+
+	// Перед продолжением получаем свежие данные сделки: за время ожидания
+	// ее статус или поля могли измениться
+	if run.LeadID != 0 && s.leads != nil {
+		lead, err := s.leads.GetLead(ctx, run.LeadID)
+		switch {
+		case errors.Is(err, ErrLeadNotFound):
+			s.finish(ctx, run, PendingRunCancelled, err)
+			return
+		case err != nil:
+			s.retry(ctx, run, err)
+			return
+		}
+
+		for key, value := range lead {
+			data[key] = value
+		}
+	}
+
+	// Запуск из очереди throttle занимает место в окне только после загрузки
+	// сделки, чтобы ошибка загрузки или удаленная сделка не расходовали лимит,
+	// а ключ счетчика считался по свежим данным
+	acquired, windowEnd, err := s.engine.acquireQueuedRun(ctx, run, data)
+	if err != nil {
+		s.retry(ctx, run, err)
+		return
+	}
+	if !acquired {
+		s.postpone(ctx, run, windowEnd)
+		return
+	}
+
+	_, err = s.engine.ResumeRun(ctx, run, data)
+	if err != nil {
+		s.logger.Error("Failed to resume flow run",
+			zap.String("pending_run_id", run.ID),
+			zap.String("flow_id", run.FlowID),
+			zap.Error(err))
+		s.finish(ctx, run, PendingRunFailed, err)
+		return
+	}
+
+	s.finish(ctx, run, PendingRunCompleted, nil)
+}
+
+func (s *Scheduler) retry(ctx context.Context, run *models.FlowPendingRun, cause error) {
+	if run.Attempts+1 >= maxResumeAttempts {
+		s.finish(ctx, run, PendingRunFailed, cause)
+		return
+	}
+
+	s.logger.Warn("Failed to resume pending flow run, retrying later",
+		zap.String("pending_run_id", run.ID),
+		zap.Int64("lead_id", run.LeadID),
+		zap.Error(cause))
+
+	resumeAt := time.Now().Add(resumeRetryDelay * time.Duration(run.Attempts+1))
+	if err := s.repo.RescheduleFlowPendingRun(ctx, run.ID, resumeAt, cause.Error()); err != nil {
+		s.logger.Error("Failed to reschedule pending flow run",
+			zap.String("pending_run_id", run.ID),
+			zap.Error(err))
+	}
+}
+
+// postpone возвращает запуск в очередь до следующего окна throttle, не считая это попыткой
+func (s *Scheduler) postpone(ctx context.Context, run *models.FlowPendingRun, resumeAt time.Time) {
+	if err := s.repo.PostponeFlowPendingRun(ctx, run.ID, resumeAt); err != nil {
+		s.logger.Error("Failed to postpone pending flow run",
+			zap.String("pending_run_id", run.ID),
+			zap.Error(err))
+	}
+}
+
+func (s *Scheduler) finish(ctx context.Context, run *models.FlowPendingRun, status string, cause error) {
+	errMsg := ""
+	if cause != nil {
+		errMsg = cause.Error()
+	}
+
+	if err := s.repo.FinishFlowPendingRun(ctx, run.ID, status, errMsg); err != nil {
+		s.logger.Error("Failed to update pending flow run",
+			zap.String("pending_run_id", run.ID),
+			zap.String("status", status),
+			zap.Error(err))
+	}
+}
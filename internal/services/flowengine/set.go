@@ -0,0 +1,86 @@
+package flowengine
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// Узел set вычисляет значения и записывает их в данные запуска:
+//
+//	"data": {"assignments": [
+//	    {"name": "priority", "expression": "100 - dial_attempts * 10"},
+//	    {"name": "region", "expression": "substr(contact.phone, 1, 4)"}
+//	]}
+//
+// Присваивания выполняются по порядку, следующие видят результаты предыдущих.
+// Условия читают значения как поля ("region"), параметры действий - как {{region}}.
+// Синтаксис выражений описан в expr.go.
+
+var variableNameRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+type assignment struct {
+	name string
+	expr exprNode
+}
+
+func parseAssignment(raw interface{}) (*assignment, error) {
+	item, ok := raw.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("assignment must be an object with name and expression")
+	}
+
+	name, _ := item["name"].(string)
+	if !variableNameRe.MatchString(name) {
+		return nil, fmt.Errorf("invalid variable name %q", name)
+	}
+	if name == "now" {
+		return nil, fmt.Errorf("variable name %q is reserved", name)
+	}
+
+	source, _ := item["expression"].(string)
+	expr, err := parseExpression(source)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+
+	return &assignment{name: name, expr: expr}, nil
+}
+
+func parseAssignments(data map[string]interface{}) ([]*assignment, error) {
+	items, _ := data["assignments"].([]interface{})
+	if len(items) == 0 {
+		return nil, fmt.Errorf("set node has no assignments")
+	}
+
+	assignments := make([]*assignment, 0, len(items))
+	for _, item := range items {
+		a, err := parseAssignment(item)
+		if err != nil {
+			return nil, err
+		}
+		assignments = append(assignments, a)
+	}
+	return assignments, nil
+}
+
+// executeSet вычисляет присваивания узла и записывает результаты в data
+func (fe *FlowEngine) executeSet(step *ExecutionStep, node *FlowNode, data map[string]interface{}) error {
+	assignments, err := parseAssignments(node.Data)
+	if err != nil {
+		return err
+	}
+
+	values := make(map[string]interface{}, len(assignments))
+	step.setDetail("values", values)
+
+	for _, a := range assignments {
+		value, err := a.expr.eval(data)
+		if err != nil {
+			return fmt.Errorf("failed to evaluate %s: %w", a.name, err)
+		}
+		data[a.name] = value
+		values[a.name] = value
+	}
+
+	return nil
+}
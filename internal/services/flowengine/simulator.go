@@ -0,0 +1,70 @@
+package flowengine
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+)
+
+// RecordingPublisher collects messages instead of sending them to NATS
+type RecordingPublisher struct {
+	mu       sync.Mutex
+	Messages []PublishedMessage
+}
+
+func (p *RecordingPublisher) Publish(subject string, data []byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.Messages = append(p.Messages, PublishedMessage{
+		Subject: subject,
+		Payload: json.RawMessage(append([]byte(nil), data...)),
+	})
+	return nil
+}
+
+// SimulationResult describes what a flow would have done for an event
+type SimulationResult struct {
+	Execution *Execution         `json:"execution"`
+	Messages  []PublishedMessage `json:"messages"`
+}
+
+// Simulate runs the flow against the event without side effects: every
+// message that would have been published is recorded and returned instead.
+// Delay nodes don't pause the simulation, the run continues right away.
+// Enrich nodes read from the CRM when the engine has a CRM client and are
+// skipped otherwise.
+func (fe *FlowEngine) Simulate(ctx context.Context, flowID string, flowData json.RawMessage, event map[string]interface{}) *SimulationResult {
+	recorder := &RecordingPublisher{Messages: []PublishedMessage{}}
+	simulator := &FlowEngine{
+		logger:      fe.logger,
+		repo:        fe.repo,
+		publisher:   recorder,
+		dryRun:      true,
+		branchSlots: fe.branchSlots,
+		cache:       fe.cache,
+		crm:         fe.crm,
+	}
+
+	execution := newExecution(flowID, event)
+
+	var config FlowConfig
+	if err := json.Unmarshal(flowData, &config); err == nil {
+		if trigger, err := parseTrigger(&config); err == nil && !trigger.Matches(event) {
+			execution.finish(false, nil)
+			execution.Outcome = OutcomeNotTriggered
+			return &SimulationResult{
+				Execution: execution,
+				Messages:  recorder.Messages,
+			}
+		}
+	}
+
+	matched, err := simulator.ExecuteFlow(withExecution(ctx, execution), flowData, copyData(event))
+	execution.finish(matched, err)
+
+	return &SimulationResult{
+		Execution: execution,
+		Messages:  recorder.Messages,
+	}
+}
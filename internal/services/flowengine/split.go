@@ -0,0 +1,104 @@
+package flowengine
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math"
+)
+
+// Узел split делит запуски между исходящими ребрами в заданных процентах:
+//
+//	"data": {"salt": "schedulers-may"}
+//	ребро: {"source": "split_1", "target": "action_a", "data": {"percent": 50, "label": "A"}}
+//
+// Ветка выбирается по хешу lead_id, поэтому сделка всегда попадает в одну и ту
+// же ветку, пока не изменились проценты или порядок ребер. salt (по умолчанию
+// ID узла) разводит разбиения разных экспериментов. Выбранная ветка
+// записывается в details шага и считается в статистике выполнений потока.
+
+// splitBuckets - число корзин хеша, проценты задаются с точностью до сотых
+const splitBuckets = 10000
+
+type splitArm struct {
+	edge    *FlowEdge
+	percent float64
+}
+
+// splitArms возвращает ветки узла с процентами, в сумме 100
+func splitArms(edges []FlowEdge) ([]splitArm, error) {
+	if len(edges) == 0 {
+		return nil, fmt.Errorf("split node has no outgoing edges")
+	}
+
+	arms := make([]splitArm, 0, len(edges))
+	var total float64
+	for i := range edges {
+		edge := &edges[i]
+		percent, err := toFloat64(edge.Data["percent"])
+		if err != nil || percent < 0 || percent > 100 {
+			return nil, fmt.Errorf("edge %s: percent must be a number from 0 to 100", edge.ID)
+		}
+		total += percent
+		arms = append(arms, splitArm{edge: edge, percent: percent})
+	}
+
+	if math.Abs(total-100) > 0.001 {
+		return nil, fmt.Errorf("split percents add up to %v, not 100", total)
+	}
+	return arms, nil
+}
+
+// splitArmLabel - имя ветки в статистике: label ребра или его ID
+func splitArmLabel(edge *FlowEdge) string {
+	if label, _ := edge.Data["label"].(string); label != "" {
+		return label
+	}
+	return edge.ID
+}
+
+// splitBucket переводит сделку в номер корзины от 0 до splitBuckets-1
+func splitBucket(salt string, leadID interface{}) int {
+	h := fnv.New32a()
+	h.Write([]byte(salt + ":" + templateString(leadID)))
+	return int(h.Sum32() % splitBuckets)
+}
+
+// executeSplit выбирает ветку для сделки запуска
+func (fe *FlowEngine) executeSplit(step *ExecutionStep, node *FlowNode, config *FlowConfig, data map[string]interface{}) (*FlowEdge, error) {
+	arms, err := splitArms(regularEdges(outgoingEdges(node.ID, config)))
+	if err != nil {
+		return nil, err
+	}
+
+	leadID := data["lead_id"]
+	if id, _ := toFloat64(leadID); id == 0 {
+		return nil, fmt.Errorf("event has no lead_id")
+	}
+
+	salt, _ := node.Data["salt"].(string)
+	if salt == "" {
+		salt = node.ID
+	}
+	bucket := splitBucket(salt, leadID)
+
+	// Ветки занимают подряд идущие диапазоны корзин. Последняя ветка с
+	// ненулевым процентом забирает остаток от округления.
+	var chosen *FlowEdge
+	var upper float64
+	for _, arm := range arms {
+		if arm.percent == 0 {
+			continue
+		}
+		chosen = arm.edge
+		upper += arm.percent * splitBuckets / 100
+		if float64(bucket) < upper {
+			break
+		}
+	}
+
+	step.setDetail("arm", splitArmLabel(chosen))
+	step.setDetail("edge_id", chosen.ID)
+	step.setDetail("bucket", bucket)
+
+	return chosen, nil
+}
@@ -0,0 +1,143 @@
+package flowengine
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// maxSubflowDepth limits how deep sub-flows may call other sub-flows
+const maxSubflowDepth = 5
+
+// subflowCall - вызов вложенного потока. Узлы end вложенного потока
+// складывают сюда свои outputs, вызывающий узел забирает их после выполнения.
+type subflowCall struct {
+	flowID string
+	parent *subflowCall
+	depth  int
+
+	mu      sync.Mutex
+	outputs map[string]interface{}
+}
+
+func (c *subflowCall) addOutputs(outputs map[string]interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key, value := range outputs {
+		c.outputs[key] = value
+	}
+}
+
+type subflowKey struct{}
+
+func withSubflow(ctx context.Context, call *subflowCall) context.Context {
+	return context.WithValue(ctx, subflowKey{}, call)
+}
+
+func subflowFromContext(ctx context.Context) *subflowCall {
+	call, _ := ctx.Value(subflowKey{}).(*subflowCall)
+	return call
+}
+
+// executeSubflow выполняет сохраненный поток с копией текущих данных:
+//
+//	"data": {"flow_id": "uuid", "save_as": "normalized"}
+//
+// Переменные из outputs его узлов end добавляются в данные запуска,
+// или под ключ save_as, если он задан. Триггер вложенного потока не проверяется.
+func (fe *FlowEngine) executeSubflow(ctx context.Context, step *ExecutionStep, node *FlowNode, data map[string]interface{}) error {
+	flowID, _ := node.Data["flow_id"].(string)
+	if flowID == "" {
+		return fmt.Errorf("subflow node has no flow_id")
+	}
+	step.setDetail("flow_id", flowID)
+
+	parent := subflowFromContext(ctx)
+	depth := 1
+	if parent != nil {
+		depth = parent.depth + 1
+	}
+	if depth > maxSubflowDepth {
+		return fmt.Errorf("subflow depth limit of %d exceeded", maxSubflowDepth)
+	}
+
+	// Цикл вызовов: поток уже выполняется выше по стеку
+	if execution := executionFromContext(ctx); execution != nil && execution.FlowID == flowID {
+		return fmt.Errorf("subflow call cycle: flow %s calls itself", flowID)
+	}
+	for call := parent; call != nil; call = call.parent {
+		if call.flowID == flowID {
+			return fmt.Errorf("subflow call cycle: flow %s is already running", flowID)
+		}
+	}
+
+	// Как и основной поток, вложенный выполняется в опубликованной версии
+	compiled, err := fe.publishedFlow(ctx, flowID)
+	if err != nil {
+		return err
+	}
+	if compiled == nil {
+		return fmt.Errorf("subflow not found or not published: %s", flowID)
+	}
+	step.setDetail("flow_name", compiled.flow.Name)
+	step.setDetail("flow_version", compiled.flow.PublishedVersion)
+
+	startNode := compiled.config.startNode()
+	if startNode == nil {
+		return fmt.Errorf("subflow %s has no start node", flowID)
+	}
+
+	call := &subflowCall{
+		flowID:  flowID,
+		parent:  parent,
+		depth:   depth,
+		outputs: make(map[string]interface{}),
+	}
+
+	// Шаги вложенного потока помечаются веткой с ID вызывающего узла
+	branch := node.ID
+	if parent := branchFromContext(ctx); parent != "" {
+		branch = parent + "/" + node.ID
+	}
+	subCtx := withSubflow(withBranch(ctx, branch), call)
+
+	matched, err := fe.executeNode(subCtx, startNode, compiled.config, copyData(data))
+	step.setDetail("matched", matched)
+	if err != nil {
+		return fmt.Errorf("subflow %s failed: %w", flowID, err)
+	}
+
+	step.setDetail("outputs", call.outputs)
+	if saveAs, _ := node.Data["save_as"].(string); saveAs != "" {
+		data[saveAs] = call.outputs
+		return nil
+	}
+	for key, value := range call.outputs {
+		data[key] = value
+	}
+
+	return nil
+}
+
+// returnOutputs передает вызывающему потоку outputs узла end:
+//
+//	"data": {"outputs": {"phone": "{{normalized_phone}}", "bucket_id": "{{region_bucket}}"}}
+func (fe *FlowEngine) returnOutputs(ctx context.Context, step *ExecutionStep, node *FlowNode, data map[string]interface{}) error {
+	call := subflowFromContext(ctx)
+	outputs, ok := node.Data["outputs"].(map[string]interface{})
+	if call == nil || !ok {
+		return nil
+	}
+
+	rendered, missing, err := renderParams(outputs, data)
+	if err != nil {
+		return fmt.Errorf("failed to render outputs: %w", err)
+	}
+	if len(missing) > 0 {
+		step.setDetail("missing_variables", missing)
+	}
+	step.setDetail("outputs", rendered)
+
+	call.addOutputs(rendered)
+	return nil
+}
@@ -0,0 +1,73 @@
+package flowengine
+
+// evaluateSwitch выбирает ребро switch узла. Узел читает одно поле
+//
+//	"switchData": {"field": "", "fieldType": "pipeline"}
+//
+// и переходит по первому ребру, у которого data.case совпадает со значением
+// поля. Если совпадений нет, используется ребро с типом "default".
+func (fe *FlowEngine) evaluateSwitch(node *FlowNode, config *FlowConfig, inputData map[string]interface{}) (*FlowEdge, *ConditionTrace) {
+	switchData, _ := node.Data["switchData"].(map[string]interface{})
+	field, _ := switchData["field"].(string)
+	fieldType, _ := switchData["fieldType"].(string)
+
+	inputValue, exists := resolveField(field, fieldType, inputData)
+
+	trace := &ConditionTrace{
+		Field:     field,
+		FieldType: fieldType,
+		Input:     inputValue,
+		Exists:    exists,
+	}
+
+	var defaultEdge *FlowEdge
+	edges := outgoingEdges(node.ID, config)
+	for i := range edges {
+		edge := &edges[i]
+		if edge.Type == "default" {
+			if defaultEdge == nil {
+				defaultEdge = edge
+			}
+			continue
+		}
+
+		caseValue, ok := switchCase(edge)
+		if !ok || !exists {
+			continue
+		}
+		if inList(inputValue, caseValue, fieldType) {
+			trace.Case = caseValue
+			trace.EdgeID = edge.ID
+			trace.Result = true
+			return edge, trace
+		}
+	}
+
+	if defaultEdge != nil {
+		trace.EdgeID = defaultEdge.ID
+	}
+	return defaultEdge, trace
+}
+
+// switchCase returns the case value of a switch edge: a single value or a list
+func switchCase(edge *FlowEdge) (interface{}, bool) {
+	value, ok := edge.Data["case"]
+	if !ok || isEmptyParam(value) {
+		return nil, false
+	}
+	return value, true
+}
+
+// switchCaseValues lists the case values of an edge as strings
+func switchCaseValues(edge *FlowEdge, fieldType string) []string {
+	value, ok := switchCase(edge)
+	if !ok {
+		return nil
+	}
+
+	var values []string
+	for _, item := range valueList(value, fieldType) {
+		values = append(values, formatValue(item))
+	}
+	return values
+}
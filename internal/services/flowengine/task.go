@@ -0,0 +1,293 @@
+package flowengine
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	defaultTaskTypeID     = 1 // Звонок
+	defaultWorkDayStart   = "09:00"
+	defaultWorkDayEnd     = "18:00"
+	maxBusinessDaysLookup = 14
+)
+
+// createTask создает задачу по сделке:
+//
+//	"type": "create_task", "task_type_id": 1, "text": "Перезвонить {{name}}",
+//	"due": {"mode": "offset", "offset": "24h"},
+//	"due": {"mode": "business_hours", "days": 1, "time": "10:00", "start": "09:00", "end": "18:00",
+//	        "work_days": [1, 2, 3, 4, 5], "timezone": "Europe/Moscow"},
+//	"responsible": "lead" | "user", "responsible_user_id": 123
+//
+// Задача создается crm-service через очередь, как и остальные записи в AmoCRM.
+func (fe *FlowEngine) createTask(ctx context.Context, actionData, inputData map[string]interface{}) error {
+	leadID, _ := inputData["lead_id"].(float64)
+	if leadID == 0 {
+		return fmt.Errorf("event has no lead to create the task for")
+	}
+
+	text, _ := actionData["text"].(string)
+	if text == "" {
+		return fmt.Errorf("task text is empty")
+	}
+
+	taskTypeID := defaultTaskTypeID
+	if value, err := toFloat64(actionData["task_type_id"]); err == nil && value > 0 {
+		taskTypeID = int(value)
+	}
+
+	dueAt, err := taskDueAt(actionData, inputData, time.Now())
+	if err != nil {
+		return err
+	}
+
+	responsibleUserID, err := taskResponsible(actionData, inputData)
+	if err != nil {
+		return err
+	}
+
+	step := stepFromContext(ctx)
+	step.setDetail("complete_till", dueAt)
+	step.setDetail("responsible_user_id", responsibleUserID)
+
+	fe.logger.Info("Creating task",
+		zap.Int64("lead_id", int64(leadID)),
+		zap.Int("task_type_id", taskTypeID),
+		zap.Time("complete_till", dueAt),
+		zap.Int("responsible_user_id", responsibleUserID))
+
+	// Отправляем через NATS если подключен, задачу создаст crm-service
+	if fe.publisher != nil {
+		executionID, stepID := runReference(ctx)
+		message := map[string]interface{}{
+			"action":              "create_task",
+			"entity_type":         "leads",
+			"entity_id":           int(leadID),
+			"task_type_id":        taskTypeID,
+			"text":                text,
+			"complete_till":       dueAt.Unix(),
+			"responsible_user_id": responsibleUserID,
+			"execution_id":        executionID,
+			"step_id":             stepID,
+		}
+
+		if err := fe.publish(ctx, "crm.create_task", message); err != nil {
+			return err
+		}
+
+		fe.logger.Info("Create task request sent")
+	}
+
+	return nil
+}
+
+// taskResponsible возвращает ответственного за задачу: ответственного сделки
+// или пользователя из настроек действия. 0 - ответственным станет владелец токена.
+func taskResponsible(actionData, inputData map[string]interface{}) (int, error) {
+	responsible, _ := actionData["responsible"].(string)
+
+	switch responsible {
+	case "", "lead":
+		userID, _ := toFloat64(inputData["responsible_user_id"])
+		return int(userID), nil
+	case "user":
+		userID, err := toFloat64(actionData["responsible_user_id"])
+		if err != nil || userID <= 0 {
+			return 0, fmt.Errorf("create_task with responsible user requires responsible_user_id")
+		}
+		return int(userID), nil
+	default:
+		return 0, fmt.Errorf("unknown task responsible %q, expected lead or user", responsible)
+	}
+}
+
+// taskDueAt вычисляет срок выполнения задачи
+func taskDueAt(actionData, inputData map[string]interface{}, now time.Time) (time.Time, error) {
+	due, ok := actionData["due"].(map[string]interface{})
+	if !ok {
+		return time.Time{}, fmt.Errorf("create_task has no due settings")
+	}
+
+	mode, _ := due["mode"].(string)
+	switch mode {
+	case "", "offset":
+		offset, err := parseDelayDuration(due["offset"])
+		if err != nil {
+			return time.Time{}, err
+		}
+		return now.Add(offset), nil
+
+	case "business_hours":
+		hours, err := parseBusinessHours(due, inputData)
+		if err != nil {
+			return time.Time{}, err
+		}
+
+		// offset считается только в рабочем времени: "2h" в 17:00 - это 10:00 следующего рабочего дня
+		if !isEmptyParam(due["offset"]) {
+			offset, err := parseDelayDuration(due["offset"])
+			if err != nil {
+				return time.Time{}, err
+			}
+			return hours.addWorkingTime(now, offset)
+		}
+
+		days := 1
+		if value, err := toFloat64(due["days"]); err == nil {
+			days = int(value)
+		}
+		if days < 0 {
+			return time.Time{}, fmt.Errorf("due days must not be negative")
+		}
+		return hours.workingDayAt(now, days, due)
+
+	default:
+		return time.Time{}, fmt.Errorf("unknown due mode: %s", mode)
+	}
+}
+
+// businessHours - рабочее время: с start до end по рабочим дням недели (1 - понедельник, 7 - воскресенье)
+type businessHours struct {
+	location *time.Location
+	start    int // минуты от начала дня
+	end      int
+	workDays map[time.Weekday]bool
+}
+
+func parseBusinessHours(due, inputData map[string]interface{}) (*businessHours, error) {
+	location, err := delayLocation(due, inputData)
+	if err != nil {
+		return nil, err
+	}
+
+	hours := &businessHours{location: location, workDays: make(map[time.Weekday]bool)}
+
+	if hours.start, err = clockMinutes(due["start"], defaultWorkDayStart); err != nil {
+		return nil, err
+	}
+	if hours.end, err = clockMinutes(due["end"], defaultWorkDayEnd); err != nil {
+		return nil, err
+	}
+	if hours.end <= hours.start {
+		return nil, fmt.Errorf("working day end must be after its start")
+	}
+
+	workDays := []interface{}{1.0, 2.0, 3.0, 4.0, 5.0}
+	if list, ok := due["work_days"].([]interface{}); ok {
+		workDays = list
+	}
+	for _, item := range workDays {
+		day, err := toFloat64(item)
+		if err != nil || day < 1 || day > 7 {
+			return nil, fmt.Errorf("invalid work day %v, expected 1 (Monday) to 7 (Sunday)", item)
+		}
+		hours.workDays[time.Weekday(int(day)%7)] = true
+	}
+	if len(hours.workDays) == 0 {
+		return nil, fmt.Errorf("work_days must not be empty")
+	}
+
+	return hours, nil
+}
+
+func clockMinutes(value interface{}, fallback string) (int, error) {
+	clock, _ := value.(string)
+	if clock == "" {
+		clock = fallback
+	}
+	hour, minute, err := parseClock(clock)
+	if err != nil {
+		return 0, err
+	}
+	return hour*60 + minute, nil
+}
+
+func (h *businessHours) at(day time.Time, minutes int) time.Time {
+	return time.Date(day.Year(), day.Month(), day.Day(), minutes/60, minutes%60, 0, 0, h.location)
+}
+
+// nextWorkingDay возвращает ближайший рабочий день не раньше day
+func (h *businessHours) nextWorkingDay(day time.Time) (time.Time, error) {
+	for i := 0; i < maxBusinessDaysLookup; i++ {
+		if h.workDays[day.Weekday()] {
+			return day, nil
+		}
+		day = day.AddDate(0, 0, 1)
+	}
+	return time.Time{}, fmt.Errorf("no working day found")
+}
+
+// workingDayAt возвращает время due["time"] (по умолчанию начало рабочего дня)
+// через days рабочих дней; days = 0 - сегодня или ближайший рабочий день
+func (h *businessHours) workingDayAt(now time.Time, days int, due map[string]interface{}) (time.Time, error) {
+	var err error
+	minutes := h.start
+	if !isEmptyParam(due["time"]) {
+		if minutes, err = clockMinutes(due["time"], ""); err != nil {
+			return time.Time{}, err
+		}
+	}
+
+	day := now.In(h.location)
+	if days == 0 {
+		if day, err = h.nextWorkingDay(day); err != nil {
+			return time.Time{}, err
+		}
+	}
+	for ; days > 0; days-- {
+		if day, err = h.nextWorkingDay(day.AddDate(0, 0, 1)); err != nil {
+			return time.Time{}, err
+		}
+	}
+
+	dueAt := h.at(day, minutes)
+	if !dueAt.After(now) {
+		// Сегодняшнее время уже прошло - переносим на следующий рабочий день
+		if day, err = h.nextWorkingDay(day.AddDate(0, 0, 1)); err != nil {
+			return time.Time{}, err
+		}
+		dueAt = h.at(day, minutes)
+	}
+
+	return dueAt, nil
+}
+
+// addWorkingTime прибавляет к now duration рабочего времени
+func (h *businessHours) addWorkingTime(now time.Time, duration time.Duration) (time.Time, error) {
+	current := now.In(h.location)
+
+	for {
+		day, err := h.nextWorkingDay(current)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if !sameDay(day, current) {
+			current = h.at(day, h.start)
+		}
+
+		dayStart := h.at(current, h.start)
+		dayEnd := h.at(current, h.end)
+		if current.Before(dayStart) {
+			current = dayStart
+		}
+
+		if current.Before(dayEnd) {
+			remaining := dayEnd.Sub(current)
+			if duration <= remaining {
+				return current.Add(duration), nil
+			}
+			duration -= remaining
+		}
+
+		next := current.AddDate(0, 0, 1)
+		current = h.at(next, h.start)
+	}
+}
+
+func sameDay(a, b time.Time) bool {
+	return a.Year() == b.Year() && a.YearDay() == b.YearDay()
+}
@@ -0,0 +1,328 @@
+package flowengine
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Шаблоны в строковых параметрах действий:
+//
+//	"Отправлен в обзвон {{scheduler_name}}, попытка {{dial_attempts}}"
+//	"{{contact.phone}}", "{{custom_fields.City | default \"-\"}}", "{{now | date \"02.01.2006\"}}"
+//
+// Путь разбирается по точкам внутри данных события, после него через "|"
+// идут фильтры.
+
+const defaultTemplateDateLayout = "02.01.2006 15:04"
+
+type templateFilter struct {
+	name string
+	args []string
+}
+
+type templateExpr struct {
+	path    string
+	filters []templateFilter
+}
+
+type templatePart struct {
+	text string
+	expr *templateExpr
+}
+
+// templateFilters lists known filters with their allowed argument counts
+var templateFilters = map[string][2]int{
+	"date":    {0, 1},
+	"default": {1, 1},
+	"upper":   {0, 0},
+	"lower":   {0, 0},
+	"trim":    {0, 0},
+}
+
+func parseTemplate(s string) ([]templatePart, error) {
+	var parts []templatePart
+
+	for {
+		start := strings.Index(s, "{{")
+		if start < 0 {
+			if s != "" {
+				parts = append(parts, templatePart{text: s})
+			}
+			return parts, nil
+		}
+
+		end := strings.Index(s[start:], "}}")
+		if end < 0 {
+			return nil, fmt.Errorf("unclosed {{ in template")
+		}
+		end += start
+
+		if start > 0 {
+			parts = append(parts, templatePart{text: s[:start]})
+		}
+
+		expr, err := parseTemplateExpr(s[start+2 : end])
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, templatePart{expr: expr})
+
+		s = s[end+2:]
+	}
+}
+
+func parseTemplateExpr(raw string) (*templateExpr, error) {
+	segments := splitOutsideQuotes(raw, '|')
+
+	expr := &templateExpr{path: strings.TrimSpace(segments[0])}
+	if expr.path == "" {
+		return nil, fmt.Errorf("empty variable in template")
+	}
+
+	for _, segment := range segments[1:] {
+		tokens := splitOutsideQuotes(strings.TrimSpace(segment), ' ')
+		filter := templateFilter{name: tokens[0]}
+
+		for _, token := range tokens[1:] {
+			if token == "" {
+				continue
+			}
+			if unquoted, err := strconv.Unquote(token); err == nil {
+				token = unquoted
+			}
+			filter.args = append(filter.args, token)
+		}
+
+		limits, ok := templateFilters[filter.name]
+		if !ok {
+			return nil, fmt.Errorf("unknown template filter %q", filter.name)
+		}
+		if len(filter.args) < limits[0] || len(filter.args) > limits[1] {
+			return nil, fmt.Errorf("wrong number of arguments for template filter %q", filter.name)
+		}
+
+		expr.filters = append(expr.filters, filter)
+	}
+
+	return expr, nil
+}
+
+func splitOutsideQuotes(s string, sep rune) []string {
+	var parts []string
+	var current strings.Builder
+	inQuotes := false
+
+	for _, r := range s {
+		switch {
+		case r == '"':
+			inQuotes = !inQuotes
+			current.WriteRune(r)
+		case r == sep && !inQuotes:
+			parts = append(parts, current.String())
+			current.Reset()
+		default:
+			current.WriteRune(r)
+		}
+	}
+
+	return append(parts, current.String())
+}
+
+// eval returns the value of the expression and whether its variable exists.
+// A default filter counts as a value for a missing variable.
+func (e *templateExpr) eval(data map[string]interface{}) (interface{}, bool) {
+	value, found := lookupPath(e.path, data)
+
+	for _, filter := range e.filters {
+		switch filter.name {
+		case "default":
+			if !found || isEmptyParam(value) {
+				value = filter.args[0]
+				found = true
+			}
+		case "date":
+			layout := defaultTemplateDateLayout
+			if len(filter.args) > 0 {
+				layout = filter.args[0]
+			}
+			if t, ok := value.(time.Time); ok {
+				value = t.Format(layout)
+			} else if t, ok := toTime(value); ok && found {
+				value = t.Format(layout)
+			}
+		case "upper":
+			value = strings.ToUpper(templateString(value))
+		case "lower":
+			value = strings.ToLower(templateString(value))
+		case "trim":
+			value = strings.TrimSpace(templateString(value))
+		}
+	}
+
+	return value, found
+}
+
+// lookupPath walks nested maps and lists by a dotted path: contact.phone, contact_ids.0
+func lookupPath(path string, data map[string]interface{}) (interface{}, bool) {
+	if value, ok := data[path]; ok {
+		return value, true
+	}
+	if path == "now" {
+		return time.Now(), true
+	}
+
+	var current interface{} = data
+	for _, key := range strings.Split(path, ".") {
+		switch node := current.(type) {
+		case map[string]interface{}:
+			value, ok := node[key]
+			if !ok {
+				return nil, false
+			}
+			current = value
+		case []interface{}:
+			index, err := strconv.Atoi(key)
+			if err != nil || index < 0 || index >= len(node) {
+				return nil, false
+			}
+			current = node[index]
+		default:
+			return nil, false
+		}
+	}
+
+	return current, true
+}
+
+func templateString(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case time.Time:
+		return v.Format(defaultTemplateDateLayout)
+	case map[string]interface{}, []interface{}:
+		data, _ := json.Marshal(v)
+		return string(data)
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
+
+// renderTemplate expands a template string. A string that consists of a single
+// variable without filters keeps the type of its value, so "{{price}}" stays a number.
+func renderTemplate(s string, data map[string]interface{}, missing map[string]bool) (interface{}, error) {
+	if !strings.Contains(s, "{{") {
+		return s, nil
+	}
+
+	parts, err := parseTemplate(s)
+	if err != nil {
+		return s, err
+	}
+
+	if len(parts) == 1 && parts[0].expr != nil && len(parts[0].expr.filters) == 0 {
+		value, found := parts[0].expr.eval(data)
+		if !found {
+			missing[parts[0].expr.path] = true
+			return "", nil
+		}
+		return value, nil
+	}
+
+	var result strings.Builder
+	for _, part := range parts {
+		if part.expr == nil {
+			result.WriteString(part.text)
+			continue
+		}
+
+		value, found := part.expr.eval(data)
+		if !found {
+			missing[part.expr.path] = true
+			continue
+		}
+		result.WriteString(templateString(value))
+	}
+
+	return result.String(), nil
+}
+
+// renderParams expands templates in every string of the action parameters,
+// including nested maps and lists, and returns the variables that were missing.
+func renderParams(params, data map[string]interface{}) (map[string]interface{}, []string, error) {
+	missing := make(map[string]bool)
+
+	rendered, err := renderValue(params, data, missing)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var missingKeys []string
+	for key := range missing {
+		missingKeys = append(missingKeys, key)
+	}
+	sort.Strings(missingKeys)
+
+	return rendered.(map[string]interface{}), missingKeys, nil
+}
+
+func renderValue(value interface{}, data map[string]interface{}, missing map[string]bool) (interface{}, error) {
+	switch v := value.(type) {
+	case string:
+		return renderTemplate(v, data, missing)
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			rendered, err := renderValue(item, data, missing)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", key, err)
+			}
+			result[key] = rendered
+		}
+		return result, nil
+	case []interface{}:
+		result := make([]interface{}, len(v))
+		for i, item := range v {
+			rendered, err := renderValue(item, data, missing)
+			if err != nil {
+				return nil, err
+			}
+			result[i] = rendered
+		}
+		return result, nil
+	default:
+		return value, nil
+	}
+}
+
+// validateTemplates returns syntax errors of templates in the parameters
+func validateTemplates(value interface{}) []error {
+	var errs []error
+
+	switch v := value.(type) {
+	case string:
+		if strings.Contains(v, "{{") {
+			if _, err := parseTemplate(v); err != nil {
+				errs = append(errs, fmt.Errorf("%q: %w", v, err))
+			}
+		}
+	case map[string]interface{}:
+		for _, item := range v {
+			errs = append(errs, validateTemplates(item)...)
+		}
+	case []interface{}:
+		for _, item := range v {
+			errs = append(errs, validateTemplates(item)...)
+		}
+	}
+
+	return errs
+}
@@ -0,0 +1,257 @@
+package flowengine
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"go.uber.org/zap"
+
+	"crm-dialer-integration/internal/models"
+)
+
+// Узел throttle ограничивает число запусков, проходящих через него за окно:
+//
+//	"data": {"limit": 300, "window": "1h", "key": "bucket:{{bucket_id}}", "on_limit": "queue"}
+//
+// Счетчики хранятся в Redis и общие для всех реплик Flow Engine. Окна
+// фиксированные и выровнены по UTC: "1h" - с начала часа. Без key счетчик у
+// каждого узла свой, одинаковый key делит лимит между узлами и потоками.
+// on_limit задает, что делать с запуском сверх лимита:
+//   - queue (по умолчанию) - запуск сохраняется в flow_pending_runs и
+//     продолжается планировщиком, когда в следующем окне есть место;
+//   - overflow - выполнение идет по ребрам с типом overflow.
+
+const (
+	throttleKeyPrefix = "flow_throttle:"
+	// overflowEdgeType - тип ребер, по которым идут запуски сверх лимита
+	overflowEdgeType = "overflow"
+
+	throttleQueue    = "queue"
+	throttleOverflow = "overflow"
+
+	maxThrottleWindow = 7 * 24 * time.Hour
+)
+
+type throttleSettings struct {
+	limit   int64
+	window  time.Duration
+	key     string
+	onLimit string
+}
+
+func parseThrottle(data map[string]interface{}) (*throttleSettings, error) {
+	limit, err := toFloat64(data["limit"])
+	if err != nil || limit < 1 || limit != float64(int64(limit)) {
+		return nil, fmt.Errorf("throttle limit must be a positive integer")
+	}
+
+	raw, _ := data["window"].(string)
+	window, err := time.ParseDuration(raw)
+	if err != nil || window < time.Second || window > maxThrottleWindow {
+		return nil, fmt.Errorf("throttle window must be a duration from 1s to %s", maxThrottleWindow)
+	}
+
+	settings := &throttleSettings{limit: int64(limit), window: window, onLimit: throttleQueue}
+	settings.key, _ = data["key"].(string)
+
+	if onLimit, _ := data["on_limit"].(string); onLimit != "" {
+		if onLimit != throttleQueue && onLimit != throttleOverflow {
+			return nil, fmt.Errorf("unknown throttle on_limit %q", onLimit)
+		}
+		settings.onLimit = onLimit
+	}
+
+	return settings, nil
+}
+
+// counterKey возвращает ключ счетчика: общий по key узла или свой у узла потока
+func (s *throttleSettings) counterKey(flowID, nodeID string, data map[string]interface{}) (string, error) {
+	if s.key == "" {
+		return "node:" + flowID + ":" + nodeID, nil
+	}
+
+	missing := make(map[string]bool)
+	value, err := renderTemplate(s.key, data, missing)
+	if err != nil {
+		return "", fmt.Errorf("invalid throttle key: %w", err)
+	}
+	if len(missing) > 0 {
+		return "", fmt.Errorf("throttle key variables not found in event data")
+	}
+	key := strings.TrimSpace(templateString(value))
+	if key == "" {
+		return "", fmt.Errorf("throttle key is empty")
+	}
+	return "key:" + key, nil
+}
+
+// Throttle counts runs passing throttle nodes in Redis, so limits hold
+// across flow-engine replicas
+type Throttle struct {
+	rdb *redis.Client
+}
+
+func NewThrottle(rdb *redis.Client) *Throttle {
+	return &Throttle{rdb: rdb}
+}
+
+// Место в окне занимается атомарно: проверка и увеличение счетчика в одном скрипте
+var throttleScript = redis.NewScript(`
+    local count = tonumber(redis.call("GET", KEYS[1]) or "0")
+    if count >= tonumber(ARGV[1]) then
+        return -1
+    end
+    count = redis.call("INCR", KEYS[1])
+    if count == 1 then
+        redis.call("PEXPIRE", KEYS[1], ARGV[2])
+    end
+    return count
+`)
+
+// acquire занимает место в текущем окне. Возвращает число занятых мест и конец окна.
+func (t *Throttle) acquire(ctx context.Context, key string, limit int64, window time.Duration, now time.Time) (bool, int64, time.Time, error) {
+	start := now.UTC().Truncate(window)
+	end := start.Add(window)
+
+	counter := fmt.Sprintf("%s%s:%d", throttleKeyPrefix, key, start.Unix())
+	// Счетчик живет дольше окна, чтобы часы реплик могли немного расходиться
+	ttl := (2 * window).Milliseconds()
+
+	count, err := throttleScript.Run(ctx, t.rdb, []string{counter}, limit, ttl).Int64()
+	if err != nil {
+		return false, 0, end, fmt.Errorf("failed to update throttle counter: %w", err)
+	}
+	if count < 0 {
+		return false, limit, end, nil
+	}
+	return true, count, end, nil
+}
+
+// SetThrottle sets the Redis counters throttle nodes use. Without them
+// throttle nodes fail the run.
+func (fe *FlowEngine) SetThrottle(throttle *Throttle) {
+	fe.throttle = throttle
+}
+
+type throttleResult int
+
+const (
+	throttlePassed throttleResult = iota
+	throttleLimited
+	throttleQueued
+)
+
+// executeThrottle занимает место в окне узла. Запуск сверх лимита ставится
+// в очередь или уходит по ребрам overflow.
+func (fe *FlowEngine) executeThrottle(ctx context.Context, step *ExecutionStep, node *FlowNode, data map[string]interface{}) (throttleResult, error) {
+	settings, err := parseThrottle(node.Data)
+	if err != nil {
+		return throttlePassed, err
+	}
+
+	execution := executionFromContext(ctx)
+	var flowID string
+	if execution != nil {
+		flowID = execution.FlowID
+	}
+	if call := subflowFromContext(ctx); call != nil {
+		flowID = call.flowID
+	}
+
+	key, err := settings.counterKey(flowID, node.ID, data)
+	if err != nil {
+		return throttlePassed, err
+	}
+	step.setDetail("key", key)
+
+	// Симуляция не расходует лимит
+	if fe.dryRun {
+		step.setDetail("skipped", true)
+		return throttlePassed, nil
+	}
+	if fe.throttle == nil {
+		return throttlePassed, fmt.Errorf("throttle node requires Redis")
+	}
+
+	acquired, used, windowEnd, err := fe.throttle.acquire(ctx, key, settings.limit, settings.window, time.Now())
+	if err != nil {
+		return throttlePassed, err
+	}
+	step.setDetail("used", used)
+	step.setDetail("limit", settings.limit)
+	if acquired {
+		return throttlePassed, nil
+	}
+
+	step.setDetail("limited", true)
+	if settings.onLimit == throttleOverflow {
+		return throttleLimited, nil
+	}
+
+	// Продолжение запуска хранит только граф основного потока
+	if subflowFromContext(ctx) != nil {
+		return throttlePassed, fmt.Errorf("throttle nodes inside a subflow can only use on_limit overflow")
+	}
+
+	run, err := fe.suspendRun(ctx, node, data, windowEnd)
+	if err != nil {
+		return throttlePassed, err
+	}
+	step.setDetail("pending_run_id", run.ID)
+	step.setDetail("resume_at", windowEnd)
+
+	fe.logger.Info("Flow run queued by throttle",
+		zap.String("flow_id", run.FlowID),
+		zap.String("node_id", node.ID),
+		zap.String("pending_run_id", run.ID),
+		zap.Time("resume_at", windowEnd))
+
+	return throttleQueued, nil
+}
+
+// acquireQueuedRun занимает место в окне для запуска, ожидающего в очереди
+// throttle узла. Если места нет, возвращает конец окна, до которого запуск
+// откладывается. Запуски других узлов проходят без проверки.
+func (fe *FlowEngine) acquireQueuedRun(ctx context.Context, run *models.FlowPendingRun, data map[string]interface{}) (bool, time.Time, error) {
+	config, err := parseFlowConfig(run.FlowData)
+	if err != nil {
+		return false, time.Time{}, err
+	}
+
+	node := fe.findNodeByID(run.NodeID, config)
+	if node == nil || node.Type != "throttle" {
+		return true, time.Time{}, nil
+	}
+	if fe.throttle == nil {
+		return false, time.Time{}, fmt.Errorf("throttle node requires Redis")
+	}
+
+	settings, err := parseThrottle(node.Data)
+	if err != nil {
+		return false, time.Time{}, err
+	}
+	key, err := settings.counterKey(run.FlowID, node.ID, data)
+	if err != nil {
+		return false, time.Time{}, err
+	}
+
+	acquired, _, windowEnd, err := fe.throttle.acquire(ctx, key, settings.limit, settings.window, time.Now())
+	if err != nil {
+		return false, time.Time{}, err
+	}
+	return acquired, windowEnd, nil
+}
+
+// overflowEdges отбирает ребра с типом overflow
+func overflowEdges(edges []FlowEdge) []FlowEdge {
+	var result []FlowEdge
+	for _, edge := range edges {
+		if edge.Type == overflowEdgeType {
+			result = append(result, edge)
+		}
+	}
+	return result
+}
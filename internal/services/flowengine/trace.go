@@ -0,0 +1,329 @@
+package flowengine
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"crm-dialer-integration/internal/models"
+)
+
+const (
+	OutcomeCompleted = "completed"
+	OutcomeNoMatch   = "no_match"
+	OutcomeFailed    = "failed"
+	OutcomeDelayed   = "delayed"
+
+	// OutcomeDuplicate marks runs skipped because an earlier run already
+	// handled an event with the same idempotency key
+	OutcomeDuplicate = "duplicate"
+
+	// OutcomeNotTriggered is only reported by simulations, real events
+	// are never run through flows whose trigger doesn't match.
+	OutcomeNotTriggered = "not_triggered"
+)
+
+const (
+	StepStatusOK     = "ok"
+	StepStatusFailed = "failed"
+)
+
+// ConditionTrace records how a condition rule or rule group was evaluated.
+// Switch nodes use it too, with the matched case and the edge followed.
+type ConditionTrace struct {
+	Combinator string            `json:"combinator,omitempty"`
+	Rules      []*ConditionTrace `json:"rules,omitempty"`
+	Field      string            `json:"field,omitempty"`
+	FieldType  string            `json:"field_type,omitempty"`
+	Operator   string            `json:"operator,omitempty"`
+	Value      interface{}       `json:"value,omitempty"`
+	Input      interface{}       `json:"input,omitempty"`
+	Previous   interface{}       `json:"previous,omitempty"`
+	Case       interface{}       `json:"case,omitempty"`
+	EdgeID     string            `json:"edge_id,omitempty"`
+	Exists     bool              `json:"exists,omitempty"`
+	Not        bool              `json:"not,omitempty"`
+	Result     bool              `json:"result"`
+}
+
+// PublishedMessage is a NATS message published by an action
+type PublishedMessage struct {
+	Subject string          `json:"subject"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+// ExecutionStep records a single node visited during a run
+type ExecutionStep struct {
+	ID         string                 `json:"id"`
+	NodeID     string                 `json:"node_id"`
+	NodeType   string                 `json:"node_type"`
+	Branch     string                 `json:"branch,omitempty"`
+	Status     string                 `json:"status"`
+	Condition  *ConditionTrace        `json:"condition,omitempty"`
+	ActionType string                 `json:"action_type,omitempty"`
+	Messages   []PublishedMessage     `json:"messages,omitempty"`
+	Details    map[string]interface{} `json:"details,omitempty"`
+	Error      string                 `json:"error,omitempty"`
+	StartedAt  time.Time              `json:"started_at"`
+	DurationMs int64                  `json:"duration_ms"`
+}
+
+// Execution records a run of one event through one flow
+type Execution struct {
+	ID             string                 `json:"id"`
+	FlowID         string                 `json:"flow_id"`
+	EventType      string                 `json:"event_type"`
+	LeadID         int64                  `json:"lead_id"`
+	EventData      map[string]interface{} `json:"-"`
+	Outcome        string                 `json:"outcome"`
+	Error          string                 `json:"error,omitempty"`
+	ResumedFrom    string                 `json:"resumed_from,omitempty"`
+	FlowVersion    int                    `json:"flow_version,omitempty"`
+	IdempotencyKey string                 `json:"idempotency_key,omitempty"`
+	DuplicateOf    string                 `json:"duplicate_of,omitempty"`
+	Steps          []*ExecutionStep       `json:"steps"`
+	StartedAt      time.Time              `json:"started_at"`
+	FinishedAt     time.Time              `json:"finished_at"`
+	DurationMs     int64                  `json:"duration_ms"`
+
+	// flowData is the graph being run, stored with runs paused by delay nodes
+	flowData  json.RawMessage
+	suspended bool
+	// stopProcessing выставляет узел end с stop_processing
+	stopProcessing bool
+	// lookups кеширует ответы CRM для узлов enrich запуска
+	lookups map[string]interface{}
+
+	mu sync.Mutex
+}
+
+func newExecution(flowID string, event map[string]interface{}) *Execution {
+	eventType, _ := event["event_type"].(string)
+	leadID, _ := toFloat64(event["lead_id"])
+
+	return &Execution{
+		ID:        uuid.New().String(),
+		FlowID:    flowID,
+		EventType: eventType,
+		LeadID:    int64(leadID),
+		EventData: event,
+		Steps:     []*ExecutionStep{},
+		StartedAt: time.Now(),
+	}
+}
+
+// startStep appends a step for the node. Runs without an execution get a
+// detached step so callers never have to check for nil.
+func (e *Execution) startStep(node *FlowNode) *ExecutionStep {
+	step := &ExecutionStep{
+		ID:        uuid.New().String(),
+		NodeID:    node.ID,
+		NodeType:  node.Type,
+		Status:    StepStatusOK,
+		StartedAt: time.Now(),
+	}
+	if e == nil {
+		return step
+	}
+
+	e.mu.Lock()
+	e.Steps = append(e.Steps, step)
+	e.mu.Unlock()
+
+	return step
+}
+
+// suspend marks the run as paused by a delay node. Branches may call it concurrently.
+func (e *Execution) suspend() {
+	e.mu.Lock()
+	e.suspended = true
+	e.mu.Unlock()
+}
+
+// stopFurtherFlows asks ProcessEvent not to run the remaining flows for the event
+func (e *Execution) stopFurtherFlows() {
+	if e == nil {
+		return
+	}
+	e.mu.Lock()
+	e.stopProcessing = true
+	e.mu.Unlock()
+}
+
+// lookup returns the cached result of a CRM request made earlier in the run,
+// or calls load and caches its result. The bool reports a cache hit.
+func (e *Execution) lookup(key string, load func() (interface{}, error)) (interface{}, bool, error) {
+	if e == nil {
+		value, err := load()
+		return value, false, err
+	}
+
+	e.mu.Lock()
+	value, ok := e.lookups[key]
+	e.mu.Unlock()
+	if ok {
+		return value, true, nil
+	}
+
+	value, err := load()
+	if err != nil {
+		return nil, false, err
+	}
+
+	e.mu.Lock()
+	if e.lookups == nil {
+		e.lookups = make(map[string]interface{})
+	}
+	e.lookups[key] = value
+	e.mu.Unlock()
+
+	return value, false, nil
+}
+
+func (e *Execution) finish(matched bool, err error) {
+	e.FinishedAt = time.Now()
+	e.DurationMs = e.FinishedAt.Sub(e.StartedAt).Milliseconds()
+
+	switch {
+	case err != nil:
+		e.Outcome = OutcomeFailed
+		e.Error = err.Error()
+	case e.suspended:
+		e.Outcome = OutcomeDelayed
+	case matched:
+		e.Outcome = OutcomeCompleted
+	default:
+		e.Outcome = OutcomeNoMatch
+	}
+}
+
+// finishDuplicate records a run skipped as a duplicate of an earlier run
+func (e *Execution) finishDuplicate(original string) {
+	e.DuplicateOf = original
+	e.FinishedAt = time.Now()
+	e.DurationMs = e.FinishedAt.Sub(e.StartedAt).Milliseconds()
+	e.Outcome = OutcomeDuplicate
+}
+
+func (s *ExecutionStep) finish(err error) {
+	s.DurationMs = time.Since(s.StartedAt).Milliseconds()
+	if err != nil {
+		s.Status = StepStatusFailed
+		s.Error = err.Error()
+	}
+}
+
+func (s *ExecutionStep) recordMessage(subject string, payload []byte) {
+	if s == nil {
+		return
+	}
+	s.Messages = append(s.Messages, PublishedMessage{
+		Subject: subject,
+		Payload: json.RawMessage(payload),
+	})
+}
+
+func (s *ExecutionStep) setDetail(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+	if s.Details == nil {
+		s.Details = make(map[string]interface{})
+	}
+	s.Details[key] = value
+}
+
+// toModel converts the execution into its database representation
+func (e *Execution) toModel() (*models.FlowExecution, error) {
+	eventData, err := json.Marshal(e.EventData)
+	if err != nil {
+		return nil, err
+	}
+
+	execution := &models.FlowExecution{
+		ID:             e.ID,
+		FlowID:         e.FlowID,
+		EventType:      e.EventType,
+		LeadID:         e.LeadID,
+		EventData:      eventData,
+		Outcome:        e.Outcome,
+		Error:          e.Error,
+		ResumedFrom:    e.ResumedFrom,
+		FlowVersion:    e.FlowVersion,
+		IdempotencyKey: e.IdempotencyKey,
+		DuplicateOf:    e.DuplicateOf,
+		StartedAt:      e.StartedAt,
+		FinishedAt:     e.FinishedAt,
+		DurationMs:     e.DurationMs,
+	}
+
+	for i, step := range e.Steps {
+		model := &models.FlowExecutionStep{
+			ID:          step.ID,
+			ExecutionID: e.ID,
+			Position:    i,
+			NodeID:      step.NodeID,
+			NodeType:    step.NodeType,
+			Branch:      step.Branch,
+			Status:      step.Status,
+			ActionType:  step.ActionType,
+			Error:       step.Error,
+			StartedAt:   step.StartedAt,
+			DurationMs:  step.DurationMs,
+		}
+		if step.Condition != nil {
+			if model.Condition, err = json.Marshal(step.Condition); err != nil {
+				return nil, err
+			}
+		}
+		if len(step.Messages) > 0 {
+			if model.Messages, err = json.Marshal(step.Messages); err != nil {
+				return nil, err
+			}
+		}
+		if len(step.Details) > 0 {
+			if model.Details, err = json.Marshal(step.Details); err != nil {
+				return nil, err
+			}
+		}
+		execution.Steps = append(execution.Steps, model)
+	}
+
+	return execution, nil
+}
+
+type executionKey struct{}
+type stepKey struct{}
+
+func withExecution(ctx context.Context, execution *Execution) context.Context {
+	return context.WithValue(ctx, executionKey{}, execution)
+}
+
+func executionFromContext(ctx context.Context) *Execution {
+	execution, _ := ctx.Value(executionKey{}).(*Execution)
+	return execution
+}
+
+// runReference returns the ids other services use to report command results
+// back to the run (see flow_step_results)
+func runReference(ctx context.Context) (executionID, stepID string) {
+	if execution := executionFromContext(ctx); execution != nil {
+		executionID = execution.ID
+	}
+	if step := stepFromContext(ctx); step != nil {
+		stepID = step.ID
+	}
+	return executionID, stepID
+}
+
+func withStep(ctx context.Context, step *ExecutionStep) context.Context {
+	return context.WithValue(ctx, stepKey{}, step)
+}
+
+func stepFromContext(ctx context.Context) *ExecutionStep {
+	step, _ := ctx.Value(stepKey{}).(*ExecutionStep)
+	return step
+}
@@ -0,0 +1,148 @@
+package flowengine
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+var eventTypes = map[string]bool{
+	"lead.add":         true,
+	"lead.update":      true,
+	"lead.delete":      true,
+	"lead.status":      true,
+	"lead.responsible": true,
+}
+
+// Trigger is declared in the start node data and limits the events a flow
+// is evaluated for. An empty list matches any value.
+//
+//	"trigger": {"event_types": ["lead.status"], "pipelines": [42], "statuses": [142, 143]}
+type Trigger struct {
+	EventTypes []string      `json:"event_types"`
+	Pipelines  []interface{} `json:"pipelines"`
+	Statuses   []interface{} `json:"statuses"`
+
+	pipelines map[string]bool
+	statuses  map[string]bool
+}
+
+func parseTrigger(config *FlowConfig) (*Trigger, error) {
+	trigger := &Trigger{}
+
+	for _, node := range config.Nodes {
+		if node.Type != "start" {
+			continue
+		}
+		if raw, ok := node.Data["trigger"]; ok && raw != nil {
+			data, err := json.Marshal(raw)
+			if err != nil {
+				return nil, err
+			}
+			if err := json.Unmarshal(data, trigger); err != nil {
+				return nil, fmt.Errorf("invalid trigger: %w", err)
+			}
+		}
+		break
+	}
+
+	trigger.pipelines = idSet(trigger.Pipelines)
+	trigger.statuses = idSet(trigger.Statuses)
+	return trigger, nil
+}
+
+// Matches reports whether the event passes the trigger filters
+func (t *Trigger) Matches(event map[string]interface{}) bool {
+	if len(t.EventTypes) > 0 {
+		eventType, _ := event["event_type"].(string)
+		matched := false
+		for _, et := range t.EventTypes {
+			if et == eventType {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+
+	if len(t.pipelines) > 0 && !t.pipelines[formatValue(event["pipeline_id"])] {
+		return false
+	}
+	if len(t.statuses) > 0 && !t.statuses[formatValue(event["status_id"])] {
+		return false
+	}
+
+	return true
+}
+
+func idSet(values []interface{}) map[string]bool {
+	set := make(map[string]bool, len(values))
+	for _, v := range values {
+		set[formatValue(v)] = true
+	}
+	return set
+}
+
+// triggerIndex groups active flows by the event types their triggers listen to
+type triggerIndex struct {
+	byEventType map[string][]*compiledFlow
+	anyEvent    []*compiledFlow
+	order       map[*compiledFlow]int
+}
+
+func newTriggerIndex(flows []*compiledFlow) *triggerIndex {
+	index := &triggerIndex{
+		byEventType: make(map[string][]*compiledFlow),
+		order:       make(map[*compiledFlow]int),
+	}
+
+	for _, entry := range flows {
+		if !entry.flow.IsActive {
+			continue
+		}
+
+		trigger := entry.trigger
+		index.order[entry] = len(index.order)
+
+		if len(trigger.EventTypes) == 0 {
+			index.anyEvent = append(index.anyEvent, entry)
+			continue
+		}
+		seen := make(map[string]bool, len(trigger.EventTypes))
+		for _, eventType := range trigger.EventTypes {
+			if seen[eventType] {
+				continue
+			}
+			seen[eventType] = true
+			index.byEventType[eventType] = append(index.byEventType[eventType], entry)
+		}
+	}
+
+	return index
+}
+
+// match returns flows whose trigger matches the event, in their original order
+func (idx *triggerIndex) match(event map[string]interface{}) []*compiledFlow {
+	eventType, _ := event["event_type"].(string)
+	specific := idx.byEventType[eventType]
+
+	var matched []*compiledFlow
+	i, j := 0, 0
+	for i < len(specific) || j < len(idx.anyEvent) {
+		var entry *compiledFlow
+		if j >= len(idx.anyEvent) || (i < len(specific) && idx.order[specific[i]] < idx.order[idx.anyEvent[j]]) {
+			entry = specific[i]
+			i++
+		} else {
+			entry = idx.anyEvent[j]
+			j++
+		}
+
+		if entry.trigger.Matches(event) {
+			matched = append(matched, entry)
+		}
+	}
+
+	return matched
+}
@@ -0,0 +1,878 @@
+package flowengine
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"crm-dialer-integration/internal/repository"
+)
+
+// ValidationIssue describes a single problem found in a flow graph
+type ValidationIssue struct {
+	NodeID  string `json:"node_id,omitempty"`
+	EdgeID  string `json:"edge_id,omitempty"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// ValidationResult groups the problems found in a flow graph.
+// A flow with errors must not be activated, warnings are informational.
+type ValidationResult struct {
+	Valid    bool              `json:"valid"`
+	Errors   []ValidationIssue `json:"errors"`
+	Warnings []ValidationIssue `json:"warnings"`
+}
+
+func (r *ValidationResult) addError(nodeID, edgeID, code, format string, args ...interface{}) {
+	r.Errors = append(r.Errors, ValidationIssue{
+		NodeID:  nodeID,
+		EdgeID:  edgeID,
+		Code:    code,
+		Message: fmt.Sprintf(format, args...),
+	})
+	r.Valid = false
+}
+
+func (r *ValidationResult) addWarning(nodeID, edgeID, code, format string, args ...interface{}) {
+	r.Warnings = append(r.Warnings, ValidationIssue{
+		NodeID:  nodeID,
+		EdgeID:  edgeID,
+		Code:    code,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+// actionParams lists the parameters each action type requires in node data
+var actionParams = map[string][]string{
+	"send_to_dialer":        {"campaign_id", "bucket_id"},
+	"update_lead":           {},
+	"add_note":              {},
+	"create_task":           {"text", "due"},
+	"http_request":          {"url"},
+	"add_to_bucket":         {"bucket_id"},
+	"change_priority":       {"priority"},
+	"change_scheduler_step": {"scheduler_step"},
+	"remove_from_dialer":    {},
+}
+
+// noteTypes lists AmoCRM note types add_note can create
+var noteTypes = map[string]bool{
+	"common":          true,
+	"service_message": true,
+	"call_in":         true,
+	"call_out":        true,
+}
+
+var conditionOperators = map[string]bool{
+	"equals":           true,
+	"not_equals":       true,
+	"greater_than":     true,
+	"less_than":        true,
+	"gte":              true,
+	"lte":              true,
+	"contains":         true,
+	"starts_with":      true,
+	"ends_with":        true,
+	"in":               true,
+	"not_in":           true,
+	"regex":            true,
+	"is_empty":         true,
+	"is_not_empty":     true,
+	"between":          true,
+	"before":           true,
+	"after":            true,
+	"within_last_days": true,
+	"changed_from":     true,
+	"changed_to":       true,
+}
+
+var nodeTypes = map[string]bool{
+	"start":     true,
+	"condition": true,
+	"switch":    true,
+	"split":     true,
+	"action":    true,
+	"delay":     true,
+	"set":       true,
+	"enrich":    true,
+	"throttle":  true,
+	"subflow":   true,
+	"end":       true,
+}
+
+type Validator struct {
+	repo *repository.Repository
+}
+
+func NewValidator(repo *repository.Repository) *Validator {
+	return &Validator{
+		repo: repo,
+	}
+}
+
+// Validate checks the structure of a flow and the references it makes to
+// pipelines, statuses, buckets and schedulers synced into the database.
+func (v *Validator) Validate(ctx context.Context, flowData json.RawMessage) (*ValidationResult, error) {
+	return v.ValidateFlow(ctx, "", flowData)
+}
+
+// ValidateFlow is Validate for a stored flow. The id lets it detect sub-flows
+// that call back into the flow being validated.
+func (v *Validator) ValidateFlow(ctx context.Context, flowID string, flowData json.RawMessage) (*ValidationResult, error) {
+	result := &ValidationResult{
+		Valid:    true,
+		Errors:   []ValidationIssue{},
+		Warnings: []ValidationIssue{},
+	}
+
+	var config FlowConfig
+	if err := json.Unmarshal(flowData, &config); err != nil {
+		result.addError("", "", "invalid_json", "flow data is not a valid flow config: %v", err)
+		return result, nil
+	}
+
+	validateStructure(&config, result)
+
+	if v.repo != nil {
+		if err := v.validateReferences(ctx, &config, result); err != nil {
+			return nil, err
+		}
+		if err := v.validateSubflows(ctx, flowID, &config, result); err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
+
+func validateStructure(config *FlowConfig, result *ValidationResult) {
+	nodes := make(map[string]*FlowNode, len(config.Nodes))
+	var startNodes []string
+
+	for i := range config.Nodes {
+		node := &config.Nodes[i]
+		if node.ID == "" {
+			result.addError("", "", "missing_node_id", "node #%d has no id", i)
+			continue
+		}
+		if _, exists := nodes[node.ID]; exists {
+			result.addError(node.ID, "", "duplicate_node_id", "node id %q is used more than once", node.ID)
+			continue
+		}
+		nodes[node.ID] = node
+
+		if !nodeTypes[node.Type] {
+			result.addError(node.ID, "", "unknown_node_type", "unknown node type %q", node.Type)
+		}
+		if node.Type == "start" {
+			startNodes = append(startNodes, node.ID)
+		}
+	}
+
+	switch len(startNodes) {
+	case 0:
+		result.addError("", "", "missing_start", "flow has no start node")
+	case 1:
+	default:
+		for _, id := range startNodes[1:] {
+			result.addError(id, "", "multiple_start", "flow has more than one start node")
+		}
+	}
+
+	outgoing := make(map[string][]FlowEdge)
+	for _, edge := range config.Edges {
+		if _, ok := nodes[edge.Source]; !ok {
+			result.addError("", edge.ID, "dangling_edge", "edge source %q does not exist", edge.Source)
+			continue
+		}
+		if _, ok := nodes[edge.Target]; !ok {
+			result.addError(edge.Source, edge.ID, "dangling_edge", "edge target %q does not exist", edge.Target)
+			continue
+		}
+		outgoing[edge.Source] = append(outgoing[edge.Source], edge)
+	}
+
+	checked := make(map[string]bool, len(nodes))
+	for _, node := range config.Nodes {
+		if node.ID == "" || checked[node.ID] {
+			continue
+		}
+		checked[node.ID] = true
+		edges := outgoing[node.ID]
+
+		if node.Type == "start" || node.Type == "delay" || node.Type == "subflow" || node.Type == "set" || node.Type == "enrich" || node.Type == "throttle" || node.Type == "split" {
+			for _, edge := range errorEdges(edges) {
+				result.addWarning(node.ID, edge.ID, "ignored_error_edge", "only action nodes follow error edges, this edge is never followed")
+			}
+		}
+		if node.Type != "throttle" {
+			for _, edge := range overflowEdges(edges) {
+				result.addWarning(node.ID, edge.ID, "ignored_overflow_edge", "only throttle nodes follow overflow edges, this edge is never followed")
+			}
+		}
+
+		switch node.Type {
+		case "start":
+			validateTrigger(config, &node, result)
+			if _, err := parseDedup(config); err != nil {
+				result.addError(node.ID, "", "invalid_dedup", "%v", err)
+			}
+			if len(edges) == 0 {
+				result.addWarning(node.ID, "", "no_outgoing_edges", "start node is not connected to anything")
+			}
+		case "condition":
+			validateCondition(&node, edges, result)
+		case "switch":
+			validateSwitch(&node, edges, result)
+		case "action":
+			validateAction(&node, result)
+			validateFailurePolicy(&node, edges, result)
+		case "delay":
+			validateDelay(&node, result)
+		case "set":
+			validateSet(&node, result)
+		case "enrich":
+			if _, err := parseEnrichTargets(node.Data); err != nil {
+				result.addError(node.ID, "", "invalid_enrich", "%v", err)
+			}
+		case "split":
+			validateSplit(&node, edges, result)
+		case "throttle":
+			validateThrottle(&node, edges, result)
+		case "subflow":
+			if flowID, _ := node.Data["flow_id"].(string); flowID == "" {
+				result.addError(node.ID, "", "missing_subflow", "subflow node has no flow_id")
+			}
+		case "end":
+			if len(edges) > 0 {
+				result.addWarning(node.ID, "", "end_has_edges", "outgoing edges of an end node are never followed")
+			}
+			if value, ok := node.Data["stop_processing"]; ok {
+				if _, ok := value.(bool); !ok {
+					result.addError(node.ID, "", "invalid_stop_processing", "stop_processing must be true or false")
+				}
+			}
+		}
+	}
+
+	if len(startNodes) > 0 {
+		reachable := reachableFrom(startNodes[0], outgoing)
+		for _, node := range config.Nodes {
+			if !reachable[node.ID] {
+				result.addWarning(node.ID, "", "unreachable", "node is not reachable from the start node")
+			}
+		}
+	}
+
+	detectCycles(config.Nodes, outgoing, result)
+}
+
+func validateSplit(node *FlowNode, edges []FlowEdge, result *ValidationResult) {
+	arms, err := splitArms(regularEdges(edges))
+	if err != nil {
+		result.addError(node.ID, "", "invalid_split", "%v", err)
+		return
+	}
+	if len(arms) == 1 {
+		result.addWarning(node.ID, "", "single_split_arm", "split node has a single edge, every run takes it")
+	}
+}
+
+func validateThrottle(node *FlowNode, edges []FlowEdge, result *ValidationResult) {
+	settings, err := parseThrottle(node.Data)
+	if err != nil {
+		result.addError(node.ID, "", "invalid_throttle", "%v", err)
+		return
+	}
+	if settings.key != "" {
+		if _, err := parseTemplate(settings.key); err != nil {
+			result.addError(node.ID, "", "invalid_throttle", "invalid throttle key: %v", err)
+		}
+	}
+
+	hasOverflow := len(overflowEdges(edges)) > 0
+	switch {
+	case settings.onLimit == throttleOverflow && !hasOverflow:
+		result.addError(node.ID, "", "missing_overflow_edge", "on_limit follows the overflow edge but the node has none")
+	case settings.onLimit == throttleQueue && hasOverflow:
+		result.addWarning(node.ID, "", "ignored_overflow_edge", "on_limit is %q, overflow edges are never followed", settings.onLimit)
+	}
+}
+
+func validateTrigger(config *FlowConfig, node *FlowNode, result *ValidationResult) {
+	trigger, err := parseTrigger(config)
+	if err != nil {
+		result.addError(node.ID, "", "invalid_trigger", "%v", err)
+		return
+	}
+
+	for _, eventType := range trigger.EventTypes {
+		if !eventTypes[eventType] {
+			result.addError(node.ID, "", "unknown_event_type", "trigger listens to unknown event type %q", eventType)
+		}
+	}
+}
+
+func validateCondition(node *FlowNode, edges []FlowEdge, result *ValidationResult) {
+	conditionData, ok := node.Data["conditionData"].(map[string]interface{})
+	if !ok {
+		result.addError(node.ID, "", "missing_condition", "condition node has no conditionData")
+	} else {
+		validateRule(node.ID, conditionData, result)
+	}
+
+	var hasTrue, hasFalse bool
+	for _, edge := range edges {
+		switch edge.Type {
+		case "true":
+			hasTrue = true
+		case "false":
+			hasFalse = true
+		default:
+			result.addWarning(node.ID, edge.ID, "untyped_condition_edge", "condition edge must be typed true or false and will never be followed")
+		}
+	}
+
+	switch {
+	case !hasTrue && !hasFalse:
+		result.addError(node.ID, "", "missing_condition_edges", "condition node has neither a true nor a false edge")
+	case !hasTrue:
+		result.addWarning(node.ID, "", "missing_true_edge", "condition node has no true edge, matching events stop here")
+	case !hasFalse:
+		result.addWarning(node.ID, "", "missing_false_edge", "condition node has no false edge, non-matching events stop here")
+	}
+}
+
+func validateSwitch(node *FlowNode, edges []FlowEdge, result *ValidationResult) {
+	switchData, ok := node.Data["switchData"].(map[string]interface{})
+	fieldType, _ := switchData["fieldType"].(string)
+	if !ok {
+		result.addError(node.ID, "", "missing_switch", "switch node has no switchData")
+	} else {
+		field, _ := switchData["field"].(string)
+		if field == "" && (fieldType == "" || fieldType == "amocrm_field") {
+			result.addError(node.ID, "", "missing_switch_field", "switch has no field")
+		}
+	}
+
+	var cases, defaults int
+	seen := make(map[string]string)
+	for i := range edges {
+		edge := &edges[i]
+		if edge.Type == "default" {
+			defaults++
+			if defaults > 1 {
+				result.addWarning(node.ID, edge.ID, "duplicate_default_edge", "switch node has more than one default edge, only the first is followed")
+			}
+			continue
+		}
+
+		values := switchCaseValues(edge, fieldType)
+		if len(values) == 0 {
+			result.addWarning(node.ID, edge.ID, "missing_case_value", "switch edge has no case value and will never be followed")
+			continue
+		}
+		if caseValue, _ := switchCase(edge); isCommaList(caseValue, fieldType) {
+			result.addWarning(node.ID, edge.ID, "comma_in_value", "case %q is matched as one value, use a JSON array to list several values", caseValue)
+		}
+		cases++
+		for _, value := range values {
+			if first, ok := seen[value]; ok {
+				result.addWarning(node.ID, edge.ID, "duplicate_case_value", "case %q is already handled by edge %q", value, first)
+				continue
+			}
+			seen[value] = edge.ID
+		}
+	}
+
+	switch {
+	case cases == 0 && defaults == 0:
+		result.addError(node.ID, "", "missing_switch_edges", "switch node has neither case nor default edges")
+	case defaults == 0:
+		result.addWarning(node.ID, "", "missing_default_edge", "switch node has no default edge, unmatched events stop here")
+	}
+}
+
+func validateRule(nodeID string, rule map[string]interface{}, result *ValidationResult) {
+	if raw, isGroup := rule["rules"]; isGroup {
+		rules, _ := raw.([]interface{})
+		if combinator := groupCombinator(rule); combinator != "and" && combinator != "or" {
+			result.addError(nodeID, "", "unknown_combinator", "unknown condition combinator %q", combinator)
+		}
+		if len(rules) == 0 {
+			result.addError(nodeID, "", "empty_condition_group", "condition group has no rules")
+		}
+		for _, sub := range rules {
+			subRule, ok := sub.(map[string]interface{})
+			if !ok {
+				result.addError(nodeID, "", "invalid_condition_rule", "condition rule must be an object")
+				continue
+			}
+			validateRule(nodeID, subRule, result)
+		}
+		return
+	}
+
+	field, _ := rule["field"].(string)
+	fieldType, _ := rule["fieldType"].(string)
+	operator, _ := rule["operator"].(string)
+
+	if field == "" && (fieldType == "" || fieldType == "amocrm_field") {
+		result.addError(nodeID, "", "missing_condition_field", "condition has no field")
+	}
+	if !conditionOperators[operator] {
+		result.addError(nodeID, "", "unknown_operator", "unknown condition operator %q", operator)
+	}
+
+	value := rule["value"]
+	switch operator {
+	case "regex":
+		if _, err := regexp.Compile(fmt.Sprintf("%v", value)); err != nil {
+			result.addError(nodeID, "", "invalid_condition_value", "invalid regular expression: %v", err)
+		}
+	case "in", "not_in":
+		if len(valueList(value, fieldType)) == 0 {
+			result.addError(nodeID, "", "invalid_condition_value", "operator %s requires a list of values", operator)
+		} else if isCommaList(value, fieldType) {
+			result.addWarning(nodeID, "", "comma_in_value", "value %q of operator %s is matched as one value, use a JSON array to list several values", value, operator)
+		}
+	case "between":
+		if len(conditionList(value)) != 2 {
+			result.addError(nodeID, "", "invalid_condition_value", "operator between requires exactly two values")
+		}
+	case "before", "after":
+		if _, ok := toTime(value); !ok {
+			result.addError(nodeID, "", "invalid_condition_value", "operator %s requires a date or unix timestamp", operator)
+		}
+	case "within_last_days":
+		if _, err := toFloat64(value); err != nil {
+			result.addError(nodeID, "", "invalid_condition_value", "operator within_last_days requires a number of days")
+		}
+	}
+}
+
+func validateAction(node *FlowNode, result *ValidationResult) {
+	actionType, _ := node.Data["type"].(string)
+	required, ok := actionParams[actionType]
+	if !ok {
+		result.addError(node.ID, "", "unknown_action_type", "unknown action type %q", actionType)
+		return
+	}
+
+	for _, param := range required {
+		if isEmptyParam(node.Data[param]) {
+			result.addError(node.ID, "", "missing_action_param", "action %s requires parameter %q", actionType, param)
+		}
+	}
+
+	switch actionType {
+	case "add_note":
+		validateNote(node, result)
+	case "create_task":
+		validateTask(node, result)
+	case "http_request":
+		validateHTTPRequest(node, result)
+	}
+
+	for _, err := range validateTemplates(node.Data) {
+		result.addError(node.ID, "", "invalid_template", "%v", err)
+	}
+
+	if actionType == "update_lead" && isEmptyParam(node.Data["fields"]) &&
+		isEmptyParam(node.Data["status_id"]) && isEmptyParam(node.Data["pipeline_id"]) {
+		result.addError(node.ID, "", "missing_action_param", "action update_lead requires fields, status_id or pipeline_id")
+	}
+}
+
+// validateFailurePolicy checks on_error of an action node against its edges
+func validateFailurePolicy(node *FlowNode, edges []FlowEdge, result *ValidationResult) {
+	hasErrorEdges := len(errorEdges(edges)) > 0
+	policy, err := parseFailurePolicy(node.Data, hasErrorEdges)
+	if err != nil {
+		result.addError(node.ID, "", "invalid_on_error", "%v", err)
+		return
+	}
+
+	switch {
+	case policy.final() == failureErrorEdge && !hasErrorEdges:
+		result.addError(node.ID, "", "missing_error_edge", "on_error follows the error edge but the node has none")
+	case policy.final() != failureErrorEdge && hasErrorEdges:
+		result.addWarning(node.ID, "", "ignored_error_edge", "on_error is %q, error edges are never followed", policy.final())
+	}
+}
+
+func validateDelay(node *FlowNode, result *ValidationResult) {
+	delayData, ok := node.Data["delayData"].(map[string]interface{})
+	if !ok {
+		result.addError(node.ID, "", "missing_delay", "delay node has no delayData")
+		return
+	}
+
+	// Check the settings with the same code that computes the resume time
+	if _, err := delayUntil(node.Data, map[string]interface{}{}, time.Now()); err != nil {
+		result.addError(node.ID, "", "invalid_delay", "%v", err)
+	}
+	if field, _ := delayData["timezone_field"].(string); field != "" && isEmptyParam(delayData["timezone"]) {
+		result.addWarning(node.ID, "", "missing_fallback_timezone", "leads without %q will use the server timezone", field)
+	}
+}
+
+func validateSet(node *FlowNode, result *ValidationResult) {
+	items, _ := node.Data["assignments"].([]interface{})
+	if len(items) == 0 {
+		result.addError(node.ID, "", "missing_assignments", "set node has no assignments")
+		return
+	}
+
+	names := make(map[string]bool, len(items))
+	for _, item := range items {
+		a, err := parseAssignment(item)
+		if err != nil {
+			result.addError(node.ID, "", "invalid_assignment", "%v", err)
+			continue
+		}
+		if names[a.name] {
+			result.addWarning(node.ID, "", "duplicate_assignment", "variable %q is assigned more than once", a.name)
+		}
+		names[a.name] = true
+	}
+}
+
+func validateNote(node *FlowNode, result *ValidationResult) {
+	noteType, _ := node.Data["note_type"].(string)
+	if noteType == "" {
+		noteType = "common"
+	}
+	if !noteTypes[noteType] {
+		result.addError(node.ID, "", "unknown_note_type", "unknown note type %q", noteType)
+		return
+	}
+
+	if (noteType == "common" || noteType == "service_message") && isEmptyParam(node.Data["text"]) {
+		result.addError(node.ID, "", "missing_action_param", "action add_note requires parameter %q", "text")
+	}
+	if entity, _ := node.Data["entity"].(string); entity != "" && entity != "lead" && entity != "contact" {
+		result.addError(node.ID, "", "invalid_action_param", "add_note entity must be lead or contact")
+	}
+}
+
+func validateTask(node *FlowNode, result *ValidationResult) {
+	if value, ok := node.Data["task_type_id"]; ok && !isEmptyParam(value) {
+		if id, err := toFloat64(value); err != nil || id <= 0 {
+			result.addError(node.ID, "", "invalid_action_param", "task_type_id must be a positive number")
+		}
+	}
+
+	// Check the settings with the same code that computes the task deadline
+	if !isEmptyParam(node.Data["due"]) {
+		if _, err := taskDueAt(node.Data, map[string]interface{}{}, time.Now()); err != nil {
+			result.addError(node.ID, "", "invalid_task_due", "%v", err)
+		}
+	}
+	if _, err := taskResponsible(node.Data, map[string]interface{}{}); err != nil {
+		result.addError(node.ID, "", "invalid_action_param", "%v", err)
+	}
+}
+
+func validateHTTPRequest(node *FlowNode, result *ValidationResult) {
+	if isEmptyParam(node.Data["url"]) {
+		return
+	}
+
+	// Templated URLs and secrets from the environment are only known at run time
+	data := make(map[string]interface{}, len(node.Data))
+	for key, value := range node.Data {
+		data[key] = value
+	}
+	if url, _ := data["url"].(string); strings.Contains(url, "{{") {
+		data["url"] = "https://template"
+	}
+	if signing, ok := data["hmac"].(map[string]interface{}); ok {
+		if name, _ := signing["secret_env"].(string); name != "" {
+			signing = map[string]interface{}{"secret": name, "algorithm": signing["algorithm"]}
+			data["hmac"] = signing
+		}
+	}
+
+	if _, err := parseHTTPAction(data); err != nil {
+		result.addError(node.ID, "", "invalid_action_param", "%v", err)
+	}
+}
+
+func reachableFrom(startID string, outgoing map[string][]FlowEdge) map[string]bool {
+	reachable := map[string]bool{startID: true}
+	queue := []string{startID}
+
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		for _, edge := range outgoing[id] {
+			if !reachable[edge.Target] {
+				reachable[edge.Target] = true
+				queue = append(queue, edge.Target)
+			}
+		}
+	}
+
+	return reachable
+}
+
+func detectCycles(nodes []FlowNode, outgoing map[string][]FlowEdge, result *ValidationResult) {
+	const (
+		unvisited = iota
+		inProgress
+		done
+	)
+	state := make(map[string]int, len(nodes))
+
+	var visit func(id string)
+	visit = func(id string) {
+		state[id] = inProgress
+		for _, edge := range outgoing[id] {
+			switch state[edge.Target] {
+			case unvisited:
+				visit(edge.Target)
+			case inProgress:
+				result.addError(edge.Source, edge.ID, "cycle", "edge to %q closes a cycle", edge.Target)
+			}
+		}
+		state[id] = done
+	}
+
+	for _, node := range nodes {
+		if state[node.ID] == unvisited {
+			visit(node.ID)
+		}
+	}
+}
+
+// validateReferences checks that ids used by conditions and actions exist in
+// the synced tables. Tables that were never synced are skipped with a warning.
+func (v *Validator) validateReferences(ctx context.Context, config *FlowConfig, result *ValidationResult) error {
+	pipelines, err := v.repo.GetAmoCRMPipelines(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to load pipelines: %w", err)
+	}
+	buckets, err := v.repo.GetDialerBuckets(ctx, "")
+	if err != nil {
+		return fmt.Errorf("failed to load buckets: %w", err)
+	}
+	schedulers, err := v.repo.GetDialerSchedulers(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to load schedulers: %w", err)
+	}
+
+	pipelineIDs := make(map[string]bool)
+	statusIDs := make(map[string]bool)
+	for _, pipeline := range pipelines {
+		pipelineIDs[strconv.FormatInt(pipeline.ID, 10)] = true
+		for _, status := range pipeline.Statuses {
+			statusIDs[strconv.FormatInt(status.ID, 10)] = true
+		}
+	}
+	bucketIDs := make(map[string]bool)
+	for _, bucket := range buckets {
+		bucketIDs[bucket.ID] = true
+	}
+	schedulerIDs := make(map[string]bool)
+	for _, scheduler := range schedulers {
+		schedulerIDs[scheduler.ID] = true
+	}
+
+	check := func(nodeID, kind string, known map[string]bool, value interface{}) {
+		if isEmptyParam(value) || formatValue(value) == "0" {
+			return
+		}
+		if len(known) == 0 {
+			result.addWarning(nodeID, "", "reference_not_checked", "no %ss are synced, %s reference was not checked", kind, kind)
+			return
+		}
+		if id := formatValue(value); !known[id] {
+			result.addError(nodeID, "", "unknown_"+kind, "%s %s does not exist", kind, id)
+		}
+	}
+
+	for _, node := range config.Nodes {
+		switch node.Type {
+		case "start":
+			if trigger, err := parseTrigger(config); err == nil {
+				for _, pipelineID := range trigger.Pipelines {
+					check(node.ID, "pipeline", pipelineIDs, pipelineID)
+				}
+				for _, statusID := range trigger.Statuses {
+					check(node.ID, "status", statusIDs, statusID)
+				}
+			}
+		case "condition":
+			conditionData, ok := node.Data["conditionData"].(map[string]interface{})
+			if !ok {
+				continue
+			}
+			walkRules(conditionData, func(rule map[string]interface{}) {
+				// Операторы in и not_in сравнивают со списком ID
+				for _, value := range conditionList(rule["value"]) {
+					switch fieldType, _ := rule["fieldType"].(string); fieldType {
+					case "pipeline":
+						check(node.ID, "pipeline", pipelineIDs, value)
+					case "status":
+						check(node.ID, "status", statusIDs, value)
+					case "bucket":
+						check(node.ID, "bucket", bucketIDs, value)
+					case "scheduler":
+						check(node.ID, "scheduler", schedulerIDs, value)
+					}
+				}
+			})
+		case "switch":
+			switchData, _ := node.Data["switchData"].(map[string]interface{})
+			fieldType, _ := switchData["fieldType"].(string)
+			kinds := map[string]map[string]bool{
+				"pipeline":  pipelineIDs,
+				"status":    statusIDs,
+				"bucket":    bucketIDs,
+				"scheduler": schedulerIDs,
+			}
+			known, ok := kinds[fieldType]
+			if !ok {
+				continue
+			}
+			for i := range config.Edges {
+				edge := &config.Edges[i]
+				if edge.Source != node.ID {
+					continue
+				}
+				for _, value := range switchCaseValues(edge, fieldType) {
+					check(node.ID, fieldType, known, value)
+				}
+			}
+		case "action":
+			check(node.ID, "pipeline", pipelineIDs, node.Data["pipeline_id"])
+			check(node.ID, "status", statusIDs, node.Data["status_id"])
+			check(node.ID, "bucket", bucketIDs, node.Data["bucket_id"])
+			check(node.ID, "scheduler", schedulerIDs, node.Data["scheduler_id"])
+		}
+	}
+
+	return nil
+}
+
+// validateSubflows follows subflow nodes through the published flows and reports
+// missing flows, call cycles, calls nested deeper than the engine allows and
+// delay nodes, which can't run inside a sub-flow.
+func (v *Validator) validateSubflows(ctx context.Context, flowID string, config *FlowConfig, result *ValidationResult) error {
+	configs := make(map[string]*FlowConfig)
+	load := func(id string) (*FlowConfig, error) {
+		if cached, ok := configs[id]; ok {
+			return cached, nil
+		}
+		flow, err := v.repo.GetPublishedIntegrationFlow(ctx, id)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load subflow: %w", err)
+		}
+		var loaded *FlowConfig
+		if flow != nil {
+			loaded = &FlowConfig{}
+			if err := json.Unmarshal(flow.FlowData, loaded); err != nil {
+				loaded = &FlowConfig{}
+			}
+		}
+		configs[id] = loaded
+		return loaded, nil
+	}
+
+	// walk returns the problem found below a sub-flow call, if any
+	var walk func(id string, path []string) (string, string, error)
+	walk = func(id string, path []string) (string, string, error) {
+		for _, called := range path {
+			if called == id {
+				return "subflow_cycle", "subflow call cycle: " + strings.Join(append(path, id), " -> "), nil
+			}
+		}
+		if len(path) > maxSubflowDepth {
+			return "subflow_too_deep", fmt.Sprintf("subflow calls are nested deeper than %d levels", maxSubflowDepth), nil
+		}
+
+		called, err := load(id)
+		if err != nil {
+			return "", "", err
+		}
+		if called == nil {
+			return "unknown_subflow", fmt.Sprintf("subflow %s does not exist or is not published", id), nil
+		}
+
+		path = append(path, id)
+		for _, node := range called.Nodes {
+			switch node.Type {
+			case "delay":
+				return "subflow_has_delay", fmt.Sprintf("subflow %s has a delay node, delays can't run inside a subflow", id), nil
+			case "throttle":
+				if settings, err := parseThrottle(node.Data); err == nil && settings.onLimit == throttleQueue {
+					return "subflow_has_throttle_queue", fmt.Sprintf("subflow %s has a throttle node that queues runs, inside a subflow it can only use on_limit overflow", id), nil
+				}
+			case "subflow":
+				next, _ := node.Data["flow_id"].(string)
+				if next == "" {
+					continue
+				}
+				if code, message, err := walk(next, path); code != "" || err != nil {
+					return code, message, err
+				}
+			}
+		}
+		return "", "", nil
+	}
+
+	root := []string{}
+	if flowID != "" {
+		root = append(root, flowID)
+	}
+	for _, node := range config.Nodes {
+		if node.Type != "subflow" {
+			continue
+		}
+		calledID, _ := node.Data["flow_id"].(string)
+		if calledID == "" {
+			continue
+		}
+		code, message, err := walk(calledID, root)
+		if err != nil {
+			return err
+		}
+		if code != "" {
+			result.addError(node.ID, "", code, "%s", message)
+		}
+	}
+
+	return nil
+}
+
+func isEmptyParam(value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		return true
+	case string:
+		return v == ""
+	case map[string]interface{}:
+		return len(v) == 0
+	case []interface{}:
+		return len(v) == 0
+	default:
+		return false
+	}
+}
+
+// isCommaList reports a string with commas that is matched as one value because
+// the field is not an ID field
+func isCommaList(value interface{}, fieldType string) bool {
+	s, ok := value.(string)
+	if !ok || !strings.Contains(s, ",") {
+		return false
+	}
+	_, isRef := refFieldTypes[fieldType]
+	return !isRef
+}
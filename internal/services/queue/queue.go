@@ -2,6 +2,7 @@ package queue
 
 import (
 	"context"
+	"fmt"
 	"sync"
 	"time"
 
@@ -11,6 +12,9 @@ import (
 const (
 	MaxRequestsPerSecond = 7
 	MaxEntitiesPerBatch  = 200
+
+	// CollectInterval is how long Collect waits for more entities of the same type
+	CollectInterval = time.Second
 )
 
 type QueueService struct {
@@ -18,8 +22,17 @@ type QueueService struct {
 	rateLimiter *RateLimiter
 	batchQueue  chan *BatchRequest
 	wg          sync.WaitGroup
+
+	mu       sync.RWMutex
+	handlers map[string]BatchHandler
+
+	pendingMu sync.Mutex
+	pending   map[string][]interface{}
 }
 
+// BatchHandler executes one batch of requests of the same type
+type BatchHandler func(ctx context.Context, entities []interface{}) error
+
 type BatchRequest struct {
 	Type     string
 	Entities []interface{}
@@ -37,6 +50,8 @@ func NewQueueService(logger *zap.Logger) *QueueService {
 		logger:      logger,
 		rateLimiter: NewRateLimiter(MaxRequestsPerSecond),
 		batchQueue:  make(chan *BatchRequest, 1000),
+		handlers:    make(map[string]BatchHandler),
+		pending:     make(map[string][]interface{}),
 	}
 
 	// Start processing goroutine
@@ -73,7 +88,23 @@ func (rl *RateLimiter) Wait() {
 	<-rl.tokens
 }
 
+// RegisterHandler sets the handler that executes batches of the request type
+func (qs *QueueService) RegisterHandler(requestType string, handler BatchHandler) {
+	qs.mu.Lock()
+	defer qs.mu.Unlock()
+	qs.handlers[requestType] = handler
+}
+
 func (qs *QueueService) AddToQueue(ctx context.Context, requestType string, entities []interface{}) error {
+	return qs.AddToQueueWithCallback(ctx, requestType, entities, func(err error) {
+		if err != nil {
+			qs.logger.Error("Batch processing failed", zap.Error(err))
+		}
+	})
+}
+
+// AddToQueueWithCallback queues entities and calls callback once per processed batch
+func (qs *QueueService) AddToQueueWithCallback(ctx context.Context, requestType string, entities []interface{}, callback func(error)) error {
 	// Split entities into batches
 	for i := 0; i < len(entities); i += MaxEntitiesPerBatch {
 		end := i + MaxEntitiesPerBatch
@@ -84,11 +115,7 @@ func (qs *QueueService) AddToQueue(ctx context.Context, requestType string, enti
 		batch := &BatchRequest{
 			Type:     requestType,
 			Entities: entities[i:end],
-			Callback: func(err error) {
-				if err != nil {
-					qs.logger.Error("Batch processing failed", zap.Error(err))
-				}
-			},
+			Callback: callback,
 		}
 
 		select {
@@ -101,6 +128,41 @@ func (qs *QueueService) AddToQueue(ctx context.Context, requestType string, enti
 	return nil
 }
 
+// Collect buffers a single entity. Buffered entities of the same type are queued
+// as one batch when MaxEntitiesPerBatch is reached or CollectInterval has passed.
+func (qs *QueueService) Collect(requestType string, entity interface{}) {
+	qs.pendingMu.Lock()
+	defer qs.pendingMu.Unlock()
+
+	qs.pending[requestType] = append(qs.pending[requestType], entity)
+
+	switch len(qs.pending[requestType]) {
+	case MaxEntitiesPerBatch:
+		qs.flushLocked(requestType)
+	case 1:
+		time.AfterFunc(CollectInterval, func() {
+			qs.pendingMu.Lock()
+			defer qs.pendingMu.Unlock()
+			qs.flushLocked(requestType)
+		})
+	}
+}
+
+func (qs *QueueService) flushLocked(requestType string) {
+	entities := qs.pending[requestType]
+	if len(entities) == 0 {
+		return
+	}
+	delete(qs.pending, requestType)
+
+	// Don't block the caller while the queue is full
+	go func() {
+		if err := qs.AddToQueue(context.Background(), requestType, entities); err != nil {
+			qs.logger.Error("Failed to queue collected batch", zap.Error(err))
+		}
+	}()
+}
+
 func (qs *QueueService) processQueue() {
 	for batch := range qs.batchQueue {
 		qs.rateLimiter.Wait()
@@ -123,6 +185,13 @@ func (qs *QueueService) processBatch(batch *BatchRequest) error {
 		zap.String("type", batch.Type),
 		zap.Int("count", len(batch.Entities)))
 
-	// TODO: Implement actual API call to AmoCRM
-	return nil
+	qs.mu.RLock()
+	handler, ok := qs.handlers[batch.Type]
+	qs.mu.RUnlock()
+
+	if !ok {
+		return fmt.Errorf("no handler registered for request type %s", batch.Type)
+	}
+
+	return handler(context.Background(), batch.Entities)
 }
@@ -0,0 +1,28 @@
+-- AmoCRM pipelines table
+CREATE TABLE amocrm_pipelines (
+                                  id BIGINT PRIMARY KEY,
+                                  name VARCHAR(255) NOT NULL,
+                                  sort INTEGER NOT NULL DEFAULT 0,
+                                  is_main BOOLEAN NOT NULL DEFAULT false,
+                                  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+                                  updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- AmoCRM pipeline statuses table
+CREATE TABLE amocrm_statuses (
+                                 id BIGINT NOT NULL,
+                                 pipeline_id BIGINT NOT NULL REFERENCES amocrm_pipelines(id) ON DELETE CASCADE,
+                                 name VARCHAR(255) NOT NULL,
+                                 sort INTEGER NOT NULL DEFAULT 0,
+                                 created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+                                 updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+                                 PRIMARY KEY (pipeline_id, id)
+);
+
+CREATE INDEX idx_amocrm_statuses_pipeline_id ON amocrm_statuses(pipeline_id);
+
+CREATE TRIGGER update_amocrm_pipelines_updated_at BEFORE UPDATE ON amocrm_pipelines
+    FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+
+CREATE TRIGGER update_amocrm_statuses_updated_at BEFORE UPDATE ON amocrm_statuses
+    FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
@@ -0,0 +1,36 @@
+-- Flow execution traces
+CREATE TABLE flow_executions (
+                                 id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+                                 flow_id UUID NOT NULL REFERENCES integration_flows(id) ON DELETE CASCADE,
+                                 event_type VARCHAR(100) NOT NULL,
+                                 lead_id BIGINT,
+                                 event_data JSONB NOT NULL,
+                                 outcome VARCHAR(50) NOT NULL,
+                                 error TEXT,
+                                 started_at TIMESTAMP NOT NULL,
+                                 finished_at TIMESTAMP NOT NULL,
+                                 duration_ms BIGINT NOT NULL DEFAULT 0
+);
+
+-- Nodes visited by a flow execution
+CREATE TABLE flow_execution_steps (
+                                      id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+                                      execution_id UUID NOT NULL REFERENCES flow_executions(id) ON DELETE CASCADE,
+                                      position INTEGER NOT NULL,
+                                      node_id VARCHAR(255) NOT NULL,
+                                      node_type VARCHAR(50) NOT NULL,
+                                      status VARCHAR(50) NOT NULL,
+                                      condition JSONB,
+                                      action_type VARCHAR(100),
+                                      messages JSONB,
+                                      error TEXT,
+                                      started_at TIMESTAMP NOT NULL,
+                                      duration_ms BIGINT NOT NULL DEFAULT 0
+);
+
+CREATE INDEX idx_flow_executions_flow_id ON flow_executions(flow_id);
+CREATE INDEX idx_flow_executions_lead_id ON flow_executions(lead_id);
+CREATE INDEX idx_flow_executions_event_type ON flow_executions(event_type);
+CREATE INDEX idx_flow_executions_outcome ON flow_executions(outcome);
+CREATE INDEX idx_flow_executions_started_at ON flow_executions(started_at);
+CREATE INDEX idx_flow_execution_steps_execution_id ON flow_execution_steps(execution_id, position);
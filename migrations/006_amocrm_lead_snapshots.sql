@@ -0,0 +1,10 @@
+-- Last known state of AmoCRM leads, used to pass previous values to flows
+CREATE TABLE amocrm_lead_snapshots (
+                                       lead_id BIGINT PRIMARY KEY,
+                                       data JSONB NOT NULL,
+                                       created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+                                       updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TRIGGER update_amocrm_lead_snapshots_updated_at BEFORE UPDATE ON amocrm_lead_snapshots
+    FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
@@ -0,0 +1,31 @@
+-- Flow runs paused by a delay node
+CREATE TABLE flow_pending_runs (
+                                   id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+                                   flow_id UUID NOT NULL REFERENCES integration_flows(id) ON DELETE CASCADE,
+                                   flow_data JSONB NOT NULL,
+                                   node_id VARCHAR(255) NOT NULL,
+                                   execution_id UUID,
+                                   lead_id BIGINT,
+                                   event_type VARCHAR(100) NOT NULL,
+                                   event_data JSONB NOT NULL,
+                                   status VARCHAR(50) NOT NULL DEFAULT 'pending',
+                                   attempts INTEGER NOT NULL DEFAULT 0,
+                                   error TEXT,
+                                   resume_at TIMESTAMP NOT NULL,
+                                   claimed_at TIMESTAMP,
+                                   created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+                                   updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_flow_pending_runs_due ON flow_pending_runs(status, resume_at);
+CREATE INDEX idx_flow_pending_runs_lead_id ON flow_pending_runs(lead_id);
+CREATE INDEX idx_flow_pending_runs_flow_id ON flow_pending_runs(flow_id);
+
+CREATE TRIGGER update_flow_pending_runs_updated_at BEFORE UPDATE ON flow_pending_runs
+    FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+
+-- Resumed runs are recorded as new executions linked to the paused one
+ALTER TABLE flow_executions ADD COLUMN resumed_from UUID;
+
+-- Node specific details of a step (delay resume time etc.)
+ALTER TABLE flow_execution_steps ADD COLUMN details JSONB;
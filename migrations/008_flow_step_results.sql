@@ -0,0 +1,12 @@
+-- Results of commands executed asynchronously for flow steps (e.g. crm.add_note)
+CREATE TABLE flow_step_results (
+                                   id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+                                   execution_id UUID NOT NULL,
+                                   step_id UUID NOT NULL,
+                                   command VARCHAR(100) NOT NULL,
+                                   status VARCHAR(50) NOT NULL,
+                                   error TEXT,
+                                   created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_flow_step_results_execution_id ON flow_step_results(execution_id);
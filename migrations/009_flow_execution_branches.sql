@@ -0,0 +1,2 @@
+-- Branch label of steps run by a fan-out (several outgoing edges of one node)
+ALTER TABLE flow_execution_steps ADD COLUMN branch VARCHAR(255);
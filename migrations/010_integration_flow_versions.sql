@@ -0,0 +1,25 @@
+-- Versions of flow graphs. integration_flows.flow_data is the working copy edited
+-- in the UI, the engine runs only the version referenced by published_version.
+CREATE TABLE integration_flow_versions (
+                                           id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+                                           flow_id UUID NOT NULL REFERENCES integration_flows(id) ON DELETE CASCADE,
+                                           version INTEGER NOT NULL,
+                                           flow_data JSONB NOT NULL,
+                                           status VARCHAR(50) NOT NULL DEFAULT 'draft',
+                                           created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+                                           published_at TIMESTAMP,
+                                           UNIQUE (flow_id, version)
+);
+
+CREATE INDEX idx_integration_flow_versions_status ON integration_flow_versions(flow_id, status);
+
+ALTER TABLE integration_flows ADD COLUMN published_version INTEGER;
+
+-- Existing flows keep running: their current graph becomes published version 1
+INSERT INTO integration_flow_versions (flow_id, version, flow_data, status, published_at)
+SELECT id, 1, flow_data, 'published', CURRENT_TIMESTAMP FROM integration_flows;
+
+UPDATE integration_flows SET published_version = 1;
+
+ALTER TABLE flow_executions ADD COLUMN flow_version INTEGER;
+ALTER TABLE flow_pending_runs ADD COLUMN flow_version INTEGER;
@@ -0,0 +1,8 @@
+-- Idempotency key of a run and, for skipped duplicates, the run that already handled the event
+ALTER TABLE flow_executions ADD COLUMN idempotency_key VARCHAR(255);
+ALTER TABLE flow_executions ADD COLUMN duplicate_of UUID;
+
+CREATE INDEX idx_flow_executions_idempotency_key ON flow_executions(idempotency_key);
+
+-- Runs resumed after a delay keep the key of the run that was paused
+ALTER TABLE flow_pending_runs ADD COLUMN idempotency_key VARCHAR(255);
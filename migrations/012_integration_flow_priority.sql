@@ -0,0 +1,12 @@
+-- Flows run for an event in priority order (lower first). stop_processing skips
+-- the remaining flows once this one matched the event.
+ALTER TABLE integration_flows ADD COLUMN priority INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE integration_flows ADD COLUMN stop_processing BOOLEAN NOT NULL DEFAULT false;
+
+-- Keep the current order, which was by name
+UPDATE integration_flows f
+SET priority = o.position * 10
+FROM (SELECT id, ROW_NUMBER() OVER (ORDER BY name) AS position FROM integration_flows) o
+WHERE f.id = o.id;
+
+CREATE INDEX idx_integration_flows_priority ON integration_flows(priority, name);
@@ -0,0 +1,2 @@
+-- Steps of split nodes record the chosen arm in details; execution stats count them per arm
+CREATE INDEX idx_flow_execution_steps_split ON flow_execution_steps(execution_id, node_id) WHERE node_type = 'split';
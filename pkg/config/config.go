@@ -37,6 +37,13 @@ type Config struct {
 	DialerAPIURL string
 	DialerAPIKey string
 
+	// Flow Engine
+	FlowSchedulerInterval int // seconds between checks for delayed runs
+	CRMRequestTimeout     int // seconds to wait for crm-service replies
+	FlowBranchWorkers     int // branches of fan-outs run concurrently, 1 - one after another
+	FlowCacheInterval     int // seconds between full reloads of the flow cache
+	FlowDedupTTL          int // seconds idempotency keys of runs are kept in Redis
+
 	// Logging
 	LogLevel string
 }
@@ -62,6 +69,12 @@ func Load() *Config {
 		DialerAPIURL: getEnv("DIALER_API_URL", ""),
 		DialerAPIKey: getEnv("DIALER_API_KEY", ""),
 
+		FlowSchedulerInterval: getEnvAsInt("FLOW_SCHEDULER_INTERVAL", 10),
+		CRMRequestTimeout:     getEnvAsInt("CRM_REQUEST_TIMEOUT", 10),
+		FlowBranchWorkers:     getEnvAsInt("FLOW_BRANCH_WORKERS", 4),
+		FlowCacheInterval:     getEnvAsInt("FLOW_CACHE_INTERVAL", 300),
+		FlowDedupTTL:          getEnvAsInt("FLOW_DEDUP_TTL", 600),
+
 		LogLevel: getEnv("LOG_LEVEL", "info"),
 	}
 }
@@ -10,6 +10,7 @@ import {
     Divider,
 } from '@mui/material';
 import SaveIcon from '@mui/icons-material/Save';
+import PublishIcon from '@mui/icons-material/Publish';
 import PlayArrowIcon from '@mui/icons-material/PlayArrow';
 import StopIcon from '@mui/icons-material/Stop';
 import { useStores } from '../../hooks/useStores';
@@ -21,6 +22,11 @@ export const FlowToolbar: React.FC = observer(() => {
         await flowStore.saveFlow();
     };
 
+    const handlePublish = async () => {
+        await flowStore.saveFlow();
+        await flowStore.publishFlow();
+    };
+
     const onDragStart = (event: React.DragEvent, nodeType: string) => {
         event.dataTransfer.setData('application/reactflow', nodeType);
         event.dataTransfer.effectAllowed = 'move';
@@ -74,6 +80,23 @@ export const FlowToolbar: React.FC = observer(() => {
                     Сохранить
                 </Button>
 
+                <Button
+                    variant="outlined"
+                    startIcon={<PublishIcon />}
+                    onClick={handlePublish}
+                    disabled={flowStore.isLoading}
+                    sx={{ ml: 1 }}
+                >
+                    Опубликовать
+                </Button>
+
+                {flowStore.currentFlow?.published_version && (
+                    <Typography variant="body2" color="text.secondary" sx={{ ml: 2 }}>
+                        v{flowStore.currentFlow.published_version}
+                        {flowStore.currentFlow.draft_version ? ` (черновик v${flowStore.currentFlow.draft_version})` : ''}
+                    </Typography>
+                )}
+
                 {flowStore.currentFlow?.is_active ? (
                     <IconButton color="error" title="Остановить поток">
                         <StopIcon />
@@ -26,6 +26,8 @@ import {
     Delete as DeleteIcon,
     MoreVert as MoreVertIcon,
     ContentCopy as ContentCopyIcon,
+    ArrowUpward as ArrowUpwardIcon,
+    ArrowDownward as ArrowDownwardIcon,
 } from '@mui/icons-material';
 import { observer } from 'mobx-react-lite';
 import { useStores } from '../../hooks/useStores';
@@ -73,6 +75,14 @@ export const FlowsPage: React.FC = observer(() => {
         }
     };
 
+    const handleMoveFlow = async (flowId: string, offset: number) => {
+        try {
+            await flowStore.moveFlow(flowId, offset);
+        } catch (error) {
+            console.error('Failed to reorder flows:', error);
+        }
+    };
+
     const handleDeleteFlow = async (flowId: string) => {
         if (window.confirm('Вы уверены, что хотите удалить этот поток?')) {
             try {
@@ -112,7 +122,7 @@ export const FlowsPage: React.FC = observer(() => {
             </Box>
 
             <Grid container spacing={3}>
-                {flowStore.flows.map((flow) => (
+                {flowStore.flows.map((flow, index) => (
                     <Grid item xs={12} sm={6} md={4} key={flow.id}>
                         <Card>
                             <CardContent>
@@ -126,6 +136,14 @@ export const FlowsPage: React.FC = observer(() => {
                                             color={flow.is_active ? 'success' : 'default'}
                                             size="small"
                                         />
+                                        {flow.stop_processing && (
+                                            <Chip
+                                                label="Останавливает обработку"
+                                                color="warning"
+                                                size="small"
+                                                sx={{ ml: 1 }}
+                                            />
+                                        )}
                                     </Box>
                                     <IconButton
                                         size="small"
@@ -135,6 +153,9 @@ export const FlowsPage: React.FC = observer(() => {
                                     </IconButton>
                                 </Box>
                                 <Typography variant="body2" color="text.secondary" sx={{ mt: 2 }}>
+                                    Приоритет: {flow.priority ?? '-'}
+                                </Typography>
+                                <Typography variant="body2" color="text.secondary">
                                     Создан: {new Date(flow.created_at).toLocaleDateString()}
                                 </Typography>
                                 <Typography variant="body2" color="text.secondary">
@@ -159,6 +180,20 @@ export const FlowsPage: React.FC = observer(() => {
                                     }
                                     label=""
                                 />
+                                <IconButton
+                                    size="small"
+                                    disabled={index === 0}
+                                    onClick={() => handleMoveFlow(flow.id, -1)}
+                                >
+                                    <ArrowUpwardIcon fontSize="small" />
+                                </IconButton>
+                                <IconButton
+                                    size="small"
+                                    disabled={index === flowStore.flows.length - 1}
+                                    onClick={() => handleMoveFlow(flow.id, 1)}
+                                >
+                                    <ArrowDownwardIcon fontSize="small" />
+                                </IconButton>
                             </CardActions>
                         </Card>
                     </Grid>
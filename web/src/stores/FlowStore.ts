@@ -124,6 +124,31 @@ export class FlowStore {
         }
     }
 
+    async publishFlow() {
+        if (!this.currentFlow) return;
+
+        this.isLoading = true;
+        this.error = null;
+        try {
+            const response = await api.post(`/api/v1/flows/${this.currentFlow.id}/publish`);
+            runInAction(() => {
+                if (this.currentFlow) {
+                    this.currentFlow = {
+                        ...this.currentFlow,
+                        published_version: response.data.published_version,
+                        draft_version: undefined,
+                    };
+                }
+                this.isLoading = false;
+            });
+        } catch (error) {
+            runInAction(() => {
+                this.error = 'Failed to publish flow';
+                this.isLoading = false;
+            });
+        }
+    }
+
     async deleteFlow(id: string) {
         try {
             await api.delete(`/api/v1/flows/${id}`);
@@ -160,6 +185,30 @@ export class FlowStore {
         }
     }
 
+    async reorderFlows(ids: string[]) {
+        try {
+            const response = await api.put('/api/v1/flows/order', { flow_ids: ids });
+            runInAction(() => {
+                this.flows = response.data;
+            });
+        } catch (error) {
+            runInAction(() => {
+                this.error = 'Failed to reorder flows';
+            });
+            throw error;
+        }
+    }
+
+    async moveFlow(id: string, offset: number) {
+        const index = this.flows.findIndex(f => f.id === id);
+        const target = index + offset;
+        if (index === -1 || target < 0 || target >= this.flows.length) return;
+
+        const ids = this.flows.map(f => f.id);
+        [ids[index], ids[target]] = [ids[target], ids[index]];
+        await this.reorderFlows(ids);
+    }
+
     updateNodes(nodes: FlowNode[]) {
         this.nodes = nodes;
     }
@@ -74,6 +74,10 @@ export interface IntegrationFlow {
     name: string;
     flow_data: any;
     is_active: boolean;
+    priority?: number;
+    stop_processing?: boolean;
+    published_version?: number;
+    draft_version?: number;
     created_at: string;
     updated_at: string;
 }